@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crabigateur-api/pkg/api"
+	"crabigateur-api/pkg/config"
+	"crabigateur-api/pkg/deck"
+	"crabigateur-api/pkg/repository"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "import error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	var configPath string
+	var connectionString string
+	var format string
+	var dryRun bool
+	var ankiOptions deck.AnkiOptions
+	var historyUser string
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] FILE\n\nImports the cards of a CSV file, a JSON array of cards, NDJSON or an Anki package, - reads standard input.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.StringVar(&configPath, "config", "", "YAML or TOML configuration file of the server, CRABI_* environment variables override it")
+	flag.StringVar(&connectionString, "dsn", "", "Postgres connection string, overrides the configuration")
+	flag.StringVar(&format, "format", "", "Format of the file, csv, json, ndjson or apkg, guessed from its extension by default")
+	flag.BoolVar(&dryRun, "dry-run", false, "Validate and report without saving anything")
+	flag.StringVar(&ankiOptions.WordField, "anki-word", "", "Note field holding the word, guessed from the note type by default")
+	flag.StringVar(&ankiOptions.TranslationsField, "anki-translations", "", "Note field holding the translations, guessed from the note type by default")
+	flag.StringVar(&ankiOptions.GenderField, "anki-gender", "", "Note field holding the gender, guessed from the note type by default")
+	flag.IntVar(&ankiOptions.Level, "anki-level", 1, "Level of the cards of notes without a Level field")
+	flag.StringVar(&historyUser, "anki-history", "", "Also import the review history of the Anki package for this existing user")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		return errors.New("expected one file")
+	}
+
+	ankiDeck, err := readDeck(flag.Arg(0), deck.Format(format), ankiOptions)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(configPath, os.LookupEnv)
+	if err != nil {
+		return err
+	}
+	if connectionString != "" {
+		cfg.Database.DSN = connectionString
+	}
+
+	db, err := sql.Open("postgres", cfg.Database.DSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	logger := slog.Default()
+	storage := repository.NewStorage(db, logger)
+	report, err := api.NewCardService(storage, logger).ImportCards(ctx, ankiDeck.Cards, dryRun)
+	if err != nil {
+		return err
+	}
+
+	for _, result := range report.Results {
+		if result.Status == api.ImportRejected {
+			fmt.Printf("card %d (%s): rejected, %s\n", result.Index, result.Word, result.Error)
+		}
+	}
+	if dryRun {
+		fmt.Print("dry run, nothing saved: ")
+	}
+	fmt.Printf("cards: %d created, %d updated, %d rejected\n", report.Created, report.Updated, report.Rejected)
+
+	if historyUser != "" && !dryRun {
+		userService := api.NewUserService(storage, cfg.LevelProgression(), cfg.Schedulers(), logger)
+		history, err := deck.ImportAnkiHistory(ctx, userService, historyUser, ankiDeck, report)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("history: %d lessons started, %d reviews applied, %d not applied\n", history.LessonsStarted, history.ReviewsApplied, history.ReviewsFailed)
+	}
+
+	if report.Rejected > 0 {
+		return fmt.Errorf("%d cards rejected", report.Rejected)
+	}
+	return nil
+}
+
+// readDeck reads the cards of the file at path, and the review history of an
+// Anki package. Other formats have no history.
+func readDeck(path string, format deck.Format, ankiOptions deck.AnkiOptions) (deck.AnkiDeck, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return deck.AnkiDeck{}, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	if format == "" {
+		if path == "-" {
+			return deck.AnkiDeck{}, errors.New("-format is needed to read standard input")
+		}
+		var err error
+		if format, err = deck.FormatOfFile(path); err != nil {
+			return deck.AnkiDeck{}, err
+		}
+	}
+
+	// a package is read from a file at random, standard input in memory
+	if format == deck.Apkg {
+		if file, ok := r.(*os.File); ok && file != os.Stdin {
+			info, err := file.Stat()
+			if err != nil {
+				return deck.AnkiDeck{}, err
+			}
+			return deck.ReadApkg(file, info.Size(), ankiOptions)
+		}
+		// standard input is capped like the collection the package holds
+		maxSize := ankiOptions.MaxCollectionSize
+		if maxSize <= 0 {
+			maxSize = deck.DefaultMaxCollectionSize
+		}
+		content, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+		if err != nil {
+			return deck.AnkiDeck{}, err
+		}
+		if int64(len(content)) > maxSize {
+			return deck.AnkiDeck{}, fmt.Errorf("package is larger than %d bytes", maxSize)
+		}
+		return deck.ReadApkg(bytes.NewReader(content), int64(len(content)), ankiOptions)
+	}
+
+	cards, err := deck.Read(r, format)
+	return deck.AnkiDeck{Cards: cards}, err
+}
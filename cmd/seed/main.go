@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"crabigateur-api/pkg/api"
+	"crabigateur-api/pkg/config"
+	"crabigateur-api/pkg/repository"
+	"crabigateur-api/pkg/seed"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "seed error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	var configPath string
+	var connectionString string
+	var starterDeck bool
+	var adminId string
+
+	flag.StringVar(&configPath, "config", "", "YAML or TOML configuration file of the server, CRABI_* environment variables override it")
+	flag.StringVar(&connectionString, "dsn", "", "Postgres connection string, overrides the configuration")
+	flag.BoolVar(&starterDeck, "starter-deck", false, "Also install the starter deck of French vocabulary")
+	flag.StringVar(&adminId, "admin", "", "Grant the admin role to this existing user, e.g. to bootstrap role management")
+	flag.Parse()
+
+	cfg, err := config.Load(configPath, os.LookupEnv)
+	if err != nil {
+		return err
+	}
+	if connectionString != "" {
+		cfg.Database.DSN = connectionString
+	}
+
+	db, err := sql.Open("postgres", cfg.Database.DSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	storage := repository.NewStorage(db, slog.Default())
+	seeder := seed.NewSeeder(storage)
+	var report seed.Report
+
+	if err := seeder.SeedStages(ctx, api.DefaultStages, &report); err != nil {
+		return err
+	}
+	fmt.Printf("stages: %d inserted, %d already present\n", report.StagesInserted, report.StagesSkipped)
+
+	if starterDeck {
+		cards, err := seed.StarterDeck()
+		if err != nil {
+			return err
+		}
+		if err := seeder.SeedCards(ctx, cards, &report); err != nil {
+			return err
+		}
+		fmt.Printf("cards: %d created, %d already present\n", report.CardsCreated, report.CardsSkipped)
+	}
+
+	if adminId != "" {
+		user, err := storage.UpdateUserRole(ctx, adminId, api.Admin)
+		if err != nil {
+			return err
+		}
+		if user.IsEmpty() {
+			return fmt.Errorf("no user with id %s", adminId)
+		}
+		fmt.Printf("user %s is now an admin\n", adminId)
+	}
+
+	return nil
+}
@@ -1,67 +1,158 @@
 package main
 
 import (
+	"context"
 	"crabigateur-api/pkg/api"
 	"crabigateur-api/pkg/app"
+	"crabigateur-api/pkg/config"
+	"crabigateur-api/pkg/logging"
 	"crabigateur-api/pkg/repository"
 	"database/sql"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
+	"slices"
+	"syscall"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
-
 func main() {
-	if err := run(); err != nil {
-		fmt.Fprintf(os.Stderr, "startup error: %s\\n", err)
+	var err error
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = runMigrate(os.Args[2:])
+	} else {
+		err = run()
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "startup error: %s\n", err)
 		os.Exit(1)
 	}
 }
 
 func run() error {
-	var connectionString string
+	var configPath string
+	var printConfig bool
+	var migrate bool
 
-	flag.StringVar(&connectionString, "dsn", "host=localhost port=5555 user=crabi password=gateur dbname=crabigateur sslmode=disable timezone=UTC connect_timeout=5", "Postgres connection string")
+	flag.StringVar(&configPath, "config", "", "YAML or TOML configuration file, CRABI_* environment variables override it")
+	flag.BoolVar(&printConfig, "print-config", false, "Print the configuration with secrets redacted and exit")
+	flag.BoolVar(&migrate, "migrate", false, "Apply pending schema migrations before serving (see the migrate subcommand to roll back)")
 	flag.Parse()
 
-	db, err := setupDatabase(connectionString)
+	cfg, err := config.Load(configPath, os.LookupEnv)
 	if err != nil {
 		return err
 	}
 
-	storage := repository.NewStorage(db)
+	if printConfig {
+		return cfg.Print(os.Stdout)
+	}
 
-	router := gin.Default()
-	router.Use(cors.Default())
-	
-	userService := api.NewUserService(storage)
-	cardService := api.NewCardService(storage)
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
 
-	server := app.NewServer(router, userService, cardService)
+	logger, err := logging.New(os.Stdout, cfg.LogOptions())
+	if err != nil {
+		return err
+	}
+	// services and libraries logging through the default logger get the same output
+	slog.SetDefault(logger)
+	logger.Info("configuration loaded", "config", cfg)
 
-	err = server.Run()
+	authConfig, err := cfg.AuthConfig()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	authenticator, err := app.NewAuthenticator(authConfig)
+	if err != nil {
+		return err
+	}
+
+	db, err := setupDatabase(cfg.Database)
+	if err != nil {
+		return err
+	}
+
+	migrator, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	if migrate || cfg.Database.Migrate {
+		if err := migrateUp(migrator); err != nil {
+			return err
+		}
+	}
+
+	storage := repository.Instrument(repository.NewStorage(db, logger))
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, "crabigateur"))
+
+	// request logging and panic recovery are set up by the server
+	router := gin.New()
+	router.Use(cors.New(corsConfig(cfg.CORS)))
+
+	userService := api.NewUserService(storage, cfg.LevelProgression(), cfg.Schedulers(), logger)
+	cardService := api.NewCardService(storage, logger)
+	userAccountService := api.NewUserAccountService(storage, cfg.DefaultScheduler())
+	apiKeyService := api.NewApiKeyService(storage, logger)
+	healthService := api.NewHealthService(storage, migrator, api.DefaultCheckTimeout, logger)
+
+	server := app.NewServer(router, logger, userService, cardService, userAccountService, apiKeyService, healthService, authenticator, cfg.ServerConfig())
+
+	// SIGINT and SIGTERM stop the server once in-flight requests are done
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = server.Run(ctx)
+
+	// every request is finished by now, so nothing uses the pool anymore
+	if closeErr := db.Close(); closeErr != nil {
+		logger.Error("closing the database", "error", closeErr)
+	}
+
+	return err
 }
 
-func setupDatabase(connString string) (*sql.DB, error) {
-	db, err := sql.Open("postgres", connString)
+func setupDatabase(database config.Database) (*sql.DB, error) {
+	db, err := sql.Open("postgres", database.DSN)
 	if err != nil {
 		return nil, err
 	}
 
+	db.SetMaxOpenConns(database.MaxOpenConns)
+	db.SetMaxIdleConns(database.MaxIdleConns)
+	db.SetConnMaxLifetime(database.ConnMaxLifetime)
+
 	// ping the DB to ensure that it is connected
 	err = db.Ping()
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return db, nil
-}
\ No newline at end of file
+}
+
+// corsConfig allows the configured origins to call the API with its
+// authentication and request id headers
+func corsConfig(origins config.CORS) cors.Config {
+	corsConfig := cors.DefaultConfig()
+	if slices.Contains(origins.AllowedOrigins, "*") {
+		corsConfig.AllowAllOrigins = true
+	} else {
+		corsConfig.AllowOrigins = origins.AllowedOrigins
+	}
+	corsConfig.AddAllowHeaders("Authorization", "X-API-Key", "X-Request-ID")
+	corsConfig.AddExposeHeaders("X-Request-ID")
+	return corsConfig
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crabigateur-api/pkg/config"
+	"crabigateur-api/pkg/migrations"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const migrateUsage = `usage: server migrate [-config FILE] [-dsn DSN] <command>
+
+commands:
+  up          apply every pending migration
+  down [N]    roll back the last N migrations (default 1)
+  version     print the current and latest schema versions
+  force N     record the schema as being at version N without running anything`
+
+// runMigrate implements the "migrate" subcommand, args being everything after it
+func runMigrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	configPath := flags.String("config", "", "YAML or TOML configuration file, CRABI_* environment variables override it")
+	connectionString := flags.String("dsn", "", "Postgres connection string, overrides the configuration")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), migrateUsage)
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("missing migrate command")
+	}
+
+	command, rest := flags.Arg(0), flags.Args()[1:]
+
+	cfg, err := config.Load(*configPath, os.LookupEnv)
+	if err != nil {
+		return err
+	}
+	if *connectionString != "" {
+		cfg.Database.DSN = *connectionString
+	}
+
+	db, err := setupDatabase(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		return migrateUp(migrator)
+	case "down":
+		steps := 1
+		if len(rest) > 0 {
+			steps, err = strconv.Atoi(rest[0])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps: %q", rest[0])
+			}
+		}
+		reverted, err := migrator.Down(steps)
+		for _, migration := range reverted {
+			fmt.Printf("rolled back %d_%s\n", migration.Version, migration.Name)
+		}
+		return err
+	case "version":
+		version, err := migrator.Version(context.Background())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("current version: %d\nlatest version: %d\n", version, migrator.Latest())
+		return nil
+	case "force":
+		if len(rest) == 0 {
+			return fmt.Errorf("force needs a version")
+		}
+		version, err := strconv.Atoi(rest[0])
+		if err != nil {
+			return fmt.Errorf("invalid version: %q", rest[0])
+		}
+		return migrator.Force(version)
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown migrate command: %q", command)
+	}
+}
+
+func newMigrator(db *sql.DB) (*migrations.Migrator, error) {
+	embedded, err := migrations.Embedded()
+	if err != nil {
+		return nil, err
+	}
+	return migrations.NewMigrator(db, embedded), nil
+}
+
+func migrateUp(migrator *migrations.Migrator) error {
+	applied, err := migrator.Up()
+	for _, migration := range applied {
+		fmt.Printf("applied %d_%s\n", migration.Version, migration.Name)
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package api
+
+import "context"
+
+type UserAccountService interface {
+	GetUser(ctx context.Context, userId string) (User, error)
+	CreateUser(ctx context.Context, user User) (User, error)
+	UpdateUser(ctx context.Context, userId string, update UserUpdate) (User, error)
+	DeleteUser(ctx context.Context, userId string) (bool, error)
+	SetUserRole(ctx context.Context, userId string, role Role) (User, error)
+	SetUserLevel(ctx context.Context, userId string, level int) (User, error)
+	GetUsersByRole(ctx context.Context, role Role) ([]User, error)
+}
+
+type UserAccountRepository interface {
+	GetUser(ctx context.Context, userId string) (User, error)
+	InsertUser(ctx context.Context, user User) (User, error)
+	UpdateUser(ctx context.Context, userId string, update UserUpdate) (User, error)
+	DeleteUser(ctx context.Context, userId string) (bool, error)
+	UpdateUserRole(ctx context.Context, userId string, role Role) (User, error)
+	UpdateUserLevel(ctx context.Context, userId string, level int) (User, error)
+	GetUsersByRole(ctx context.Context, role Role) ([]User, error)
+}
+
+type userAccountService struct {
+	storage          UserAccountRepository
+	defaultScheduler SchedulerType
+}
+
+// NewUserAccountService creates users with defaultScheduler, unless they pick
+// another scheduler
+func NewUserAccountService(accountRepo UserAccountRepository, defaultScheduler SchedulerType) UserAccountService {
+	return &userAccountService{
+		storage:          accountRepo,
+		defaultScheduler: defaultScheduler,
+	}
+}
+
+func (u *userAccountService) GetUser(ctx context.Context, userId string) (User, error) {
+	return u.storage.GetUser(ctx, userId)
+}
+
+func (u *userAccountService) CreateUser(ctx context.Context, user User) (User, error) {
+	user.Level = 1 // new learners always start on the first level, see SetUserLevel
+	if user.Scheduler == "" {
+		user.Scheduler = u.defaultScheduler
+	}
+	user.Role = Learner // roles are granted by an admin afterwards
+
+	return u.storage.InsertUser(ctx, user)
+}
+
+func (u *userAccountService) UpdateUser(ctx context.Context, userId string, update UserUpdate) (User, error) {
+	if update.Username == nil && update.Email == nil && update.Scheduler == nil {
+		// nothing to change, so just return the current state of the user
+		return u.storage.GetUser(ctx, userId)
+	}
+
+	return u.storage.UpdateUser(ctx, userId, update)
+}
+
+// DeleteUser deletes a user and its progress, reporting false when it does not
+// exist. Like its demotion, the deletion of the last admin is refused.
+func (u *userAccountService) DeleteUser(ctx context.Context, userId string) (bool, error) {
+	deleted, err := u.storage.DeleteUser(ctx, userId)
+	if err != nil || deleted {
+		return deleted, err
+	}
+
+	// nothing was deleted: either the user doesn't exist or the deletion was refused
+	current, err := u.storage.GetUser(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+	if !current.IsEmpty() {
+		return false, ErrLastAdminDeleted
+	}
+	return false, nil
+}
+
+// SetUserRole changes the role of a user, returning an empty User when it does
+// not exist. The last admin cannot be demoted, so roles stay manageable.
+func (u *userAccountService) SetUserRole(ctx context.Context, userId string, role Role) (User, error) {
+	updated, err := u.storage.UpdateUserRole(ctx, userId, role)
+	if err != nil {
+		return User{}, err
+	}
+	if !updated.IsEmpty() {
+		return updated, nil
+	}
+
+	// nothing was updated: either the user doesn't exist or the update was refused
+	current, err := u.storage.GetUser(ctx, userId)
+	if err != nil {
+		return User{}, err
+	}
+	if !current.IsEmpty() {
+		return User{}, ErrLastAdmin
+	}
+	return User{}, nil
+}
+
+// SetUserLevel moves a user to a level, returning an empty User when it does
+// not exist. Levels above the highest card level are refused.
+func (u *userAccountService) SetUserLevel(ctx context.Context, userId string, level int) (User, error) {
+	updated, err := u.storage.UpdateUserLevel(ctx, userId, level)
+	if err != nil {
+		return User{}, err
+	}
+	if !updated.IsEmpty() {
+		return updated, nil
+	}
+
+	// nothing was updated: either the user doesn't exist or the level is out of range
+	current, err := u.storage.GetUser(ctx, userId)
+	if err != nil {
+		return User{}, err
+	}
+	if !current.IsEmpty() {
+		return User{}, ErrLevelOutOfRange
+	}
+	return User{}, nil
+}
+
+func (u *userAccountService) GetUsersByRole(ctx context.Context, role Role) ([]User, error) {
+	return u.storage.GetUsersByRole(ctx, role)
+}
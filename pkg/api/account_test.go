@@ -0,0 +1,361 @@
+package api_test
+
+import (
+	"context"
+	"crabigateur-api/pkg/api"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Mock for UserAccountRepository
+type MockUserAccountRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserAccountRepository) GetUser(ctx context.Context, userId string) (api.User, error) {
+	args := m.Called(userId)
+	return args.Get(0).(api.User), args.Error(1)
+}
+
+func (m *MockUserAccountRepository) InsertUser(ctx context.Context, user api.User) (api.User, error) {
+	args := m.Called(user)
+	return args.Get(0).(api.User), args.Error(1)
+}
+
+func (m *MockUserAccountRepository) UpdateUser(ctx context.Context, userId string, update api.UserUpdate) (api.User, error) {
+	args := m.Called(userId, update)
+	return args.Get(0).(api.User), args.Error(1)
+}
+
+func (m *MockUserAccountRepository) DeleteUser(ctx context.Context, userId string) (bool, error) {
+	args := m.Called(userId)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockUserAccountRepository) UpdateUserRole(ctx context.Context, userId string, role api.Role) (api.User, error) {
+	args := m.Called(userId, role)
+	return args.Get(0).(api.User), args.Error(1)
+}
+
+func (m *MockUserAccountRepository) UpdateUserLevel(ctx context.Context, userId string, level int) (api.User, error) {
+	args := m.Called(userId, level)
+	return args.Get(0).(api.User), args.Error(1)
+}
+
+func (m *MockUserAccountRepository) GetUsersByRole(ctx context.Context, role api.Role) ([]api.User, error) {
+	args := m.Called(role)
+	return args.Get(0).([]api.User), args.Error(1)
+}
+
+func TestUserAccountService_CreateUser(t *testing.T) {
+	tests := []struct {
+		name       string
+		scheduler  api.SchedulerType // configured default, stages when empty
+		user       api.User
+		stored     api.User
+		mockResult api.User
+		mockError  error
+		expectErr  bool
+	}{
+		{
+			name:       "Defaults level to 1",
+			user:       api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com"},
+			stored:     api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Scheduler: api.PenaltyStages, Role: api.Learner},
+			mockResult: api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Scheduler: api.PenaltyStages, Role: api.Learner},
+			expectErr:  false,
+		},
+		{
+			name:       "Ignores a role in the payload",
+			user:       api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Role: api.Admin},
+			stored:     api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Scheduler: api.PenaltyStages, Role: api.Learner},
+			mockResult: api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Scheduler: api.PenaltyStages, Role: api.Learner},
+			expectErr:  false,
+		},
+		{
+			name:       "Ignores a level in the payload",
+			user:       api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 30},
+			stored:     api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Scheduler: api.PenaltyStages, Role: api.Learner},
+			mockResult: api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Scheduler: api.PenaltyStages, Role: api.Learner},
+			expectErr:  false,
+		},
+		{
+			name:       "Ignores a negative level",
+			user:       api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: -2},
+			stored:     api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Scheduler: api.PenaltyStages, Role: api.Learner},
+			mockResult: api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Scheduler: api.PenaltyStages, Role: api.Learner},
+			expectErr:  false,
+		},
+		{
+			name:       "Keeps explicit scheduler",
+			user:       api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Scheduler: api.FSRS},
+			stored:     api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Scheduler: api.FSRS, Role: api.Learner},
+			mockResult: api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Scheduler: api.FSRS},
+			expectErr:  false,
+		},
+		{
+			name:       "Uses the configured default scheduler",
+			scheduler:  api.FSRS,
+			user:       api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com"},
+			stored:     api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Scheduler: api.FSRS, Role: api.Learner},
+			mockResult: api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Scheduler: api.FSRS, Role: api.Learner},
+			expectErr:  false,
+		},
+		{
+			name:       "Repository Error",
+			user:       api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com"},
+			stored:     api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Scheduler: api.PenaltyStages, Role: api.Learner},
+			mockResult: api.User{},
+			mockError:  errors.New("repository error"),
+			expectErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduler := tt.scheduler
+			if scheduler == "" {
+				scheduler = api.PenaltyStages
+			}
+			mockRepo := new(MockUserAccountRepository)
+			service := api.NewUserAccountService(mockRepo, scheduler)
+
+			mockRepo.On("InsertUser", tt.stored).Return(tt.mockResult, tt.mockError)
+
+			result, err := service.CreateUser(context.Background(), tt.user)
+
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.mockResult, result)
+			}
+
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserAccountService_UpdateUser(t *testing.T) {
+	email := "gateur@example.com"
+	user := api.User{UserId: "123", Username: "crabi", Email: email, Level: 1}
+
+	t.Run("Applies update", func(t *testing.T) {
+		mockRepo := new(MockUserAccountRepository)
+		service := api.NewUserAccountService(mockRepo, api.PenaltyStages)
+
+		mockRepo.On("UpdateUser", "123", api.UserUpdate{Email: &email}).Return(user, nil)
+
+		result, err := service.UpdateUser(context.Background(), "123", api.UserUpdate{Email: &email})
+
+		assert.NoError(t, err)
+		assert.Equal(t, user, result)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Empty update returns current user", func(t *testing.T) {
+		mockRepo := new(MockUserAccountRepository)
+		service := api.NewUserAccountService(mockRepo, api.PenaltyStages)
+
+		mockRepo.On("GetUser", "123").Return(user, nil)
+
+		result, err := service.UpdateUser(context.Background(), "123", api.UserUpdate{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, user, result)
+		mockRepo.AssertExpectations(t)
+		mockRepo.AssertNotCalled(t, "UpdateUser", mock.Anything, mock.Anything)
+	})
+}
+
+func TestUserAccountService_SetUserRole(t *testing.T) {
+	editor := api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Role: api.Editor}
+	admin := api.User{UserId: "1", Username: "admin", Email: "admin@example.com", Level: 1, Role: api.Admin}
+
+	tests := []struct {
+		name        string
+		userId      string
+		role        api.Role
+		mockSetup   func(m *MockUserAccountRepository)
+		expected    api.User
+		expectedErr error
+	}{
+		{
+			name:   "Updates role",
+			userId: "123",
+			role:   api.Editor,
+			mockSetup: func(m *MockUserAccountRepository) {
+				m.On("UpdateUserRole", "123", api.Editor).Return(editor, nil)
+			},
+			expected: editor,
+		},
+		{
+			name:   "Unknown user",
+			userId: "404",
+			role:   api.Editor,
+			mockSetup: func(m *MockUserAccountRepository) {
+				m.On("UpdateUserRole", "404", api.Editor).Return(api.User{}, nil)
+				m.On("GetUser", "404").Return(api.User{}, nil)
+			},
+			expected: api.User{},
+		},
+		{
+			name:   "Last admin",
+			userId: "1",
+			role:   api.Learner,
+			mockSetup: func(m *MockUserAccountRepository) {
+				m.On("UpdateUserRole", "1", api.Learner).Return(api.User{}, nil)
+				m.On("GetUser", "1").Return(admin, nil)
+			},
+			expected:    api.User{},
+			expectedErr: api.ErrLastAdmin,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockUserAccountRepository)
+			service := api.NewUserAccountService(mockRepo, api.PenaltyStages)
+			tt.mockSetup(mockRepo)
+
+			result, err := service.SetUserRole(context.Background(), tt.userId, tt.role)
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expected, result)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserAccountService_SetUserLevel(t *testing.T) {
+	learner := api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Role: api.Learner}
+	promoted := api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 3, Role: api.Learner}
+
+	tests := []struct {
+		name        string
+		userId      string
+		mockSetup   func(m *MockUserAccountRepository)
+		expected    api.User
+		expectedErr error
+	}{
+		{
+			name:   "Success",
+			userId: "123",
+			mockSetup: func(m *MockUserAccountRepository) {
+				m.On("UpdateUserLevel", "123", 3).Return(promoted, nil)
+			},
+			expected: promoted,
+		},
+		{
+			name:   "Unknown user",
+			userId: "404",
+			mockSetup: func(m *MockUserAccountRepository) {
+				m.On("UpdateUserLevel", "404", 3).Return(api.User{}, nil)
+				m.On("GetUser", "404").Return(api.User{}, nil)
+			},
+			expected: api.User{},
+		},
+		{
+			name:   "Above the highest card level",
+			userId: "123",
+			mockSetup: func(m *MockUserAccountRepository) {
+				m.On("UpdateUserLevel", "123", 3).Return(api.User{}, nil)
+				m.On("GetUser", "123").Return(learner, nil)
+			},
+			expected:    api.User{},
+			expectedErr: api.ErrLevelOutOfRange,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockUserAccountRepository)
+			service := api.NewUserAccountService(mockRepo, api.PenaltyStages)
+			tt.mockSetup(mockRepo)
+
+			result, err := service.SetUserLevel(context.Background(), tt.userId, 3)
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expected, result)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserAccountService_DeleteUser(t *testing.T) {
+	admin := api.User{UserId: "1", Username: "admin", Email: "admin@example.com", Level: 1, Role: api.Admin}
+
+	tests := []struct {
+		name        string
+		userId      string
+		mockSetup   func(m *MockUserAccountRepository)
+		expected    bool
+		expectedErr error
+	}{
+		{
+			name:   "Deletes user",
+			userId: "123",
+			mockSetup: func(m *MockUserAccountRepository) {
+				m.On("DeleteUser", "123").Return(true, nil)
+			},
+			expected: true,
+		},
+		{
+			name:   "Unknown user",
+			userId: "404",
+			mockSetup: func(m *MockUserAccountRepository) {
+				m.On("DeleteUser", "404").Return(false, nil)
+				m.On("GetUser", "404").Return(api.User{}, nil)
+			},
+			expected: false,
+		},
+		{
+			name:   "Last admin",
+			userId: "1",
+			mockSetup: func(m *MockUserAccountRepository) {
+				m.On("DeleteUser", "1").Return(false, nil)
+				m.On("GetUser", "1").Return(admin, nil)
+			},
+			expected:    false,
+			expectedErr: api.ErrLastAdminDeleted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockUserAccountRepository)
+			service := api.NewUserAccountService(mockRepo, api.PenaltyStages)
+			tt.mockSetup(mockRepo)
+
+			deleted, err := service.DeleteUser(context.Background(), tt.userId)
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expected, deleted)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRole_Can(t *testing.T) {
+	assert.False(t, api.Learner.Can(api.CardsWrite))
+	assert.True(t, api.Editor.Can(api.CardsWrite))
+	assert.False(t, api.Editor.Can(api.RolesManage))
+	assert.True(t, api.Admin.Can(api.CardsWrite))
+	assert.True(t, api.Admin.Can(api.RolesManage))
+	assert.False(t, api.Role("").Can(api.CardsWrite))
+	assert.False(t, api.Role("root").IsValid())
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// apiKeyPrefix starts every key so leaked keys are easy to spot and scan for
+const apiKeyPrefix = "crabi"
+
+type ApiKey struct {
+	KeyId      int          `json:"key_id"`
+	Name       string       `json:"name"`
+	Prefix     string       `json:"prefix"`
+	Scopes     []Permission `json:"scopes"`
+	CreatedBy  string       `json:"created_by"`
+	CreatedAt  time.Time    `json:"created_at"`
+	LastUsedAt *time.Time   `json:"last_used_at"`
+	RevokedAt  *time.Time   `json:"revoked_at"`
+}
+
+// Can reports whether the key was granted permission
+func (k ApiKey) Can(permission Permission) bool {
+	for _, scope := range k.Scopes {
+		if scope == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// NewApiKey is the payload creating a key. Managing roles and keys is
+// reserved to users, so keys can't be scoped to it.
+type NewApiKey struct {
+	Name   string       `json:"name" binding:"required,max=100"`
+	Scopes []Permission `json:"scopes" binding:"required,min=1,dive,oneof=cards:write stats:read"`
+}
+
+// CreatedApiKey is only returned once: the key itself is not stored, only its hash
+type CreatedApiKey struct {
+	ApiKey
+	Key string `json:"key"`
+}
+
+type ApiKeyPath struct {
+	KeyId int `uri:"key_id" binding:"required,numeric"`
+}
+
+type ApiKeyService interface {
+	CreateApiKey(ctx context.Context, createdBy string, key NewApiKey) (CreatedApiKey, error)
+	ListApiKeys(ctx context.Context) ([]ApiKey, error)
+	RevokeApiKey(ctx context.Context, keyId int) (bool, error)
+	AuthenticateApiKey(ctx context.Context, key string) (ApiKey, error)
+}
+
+type ApiKeyRepository interface {
+	InsertApiKey(ctx context.Context, key ApiKey, hash []byte) (ApiKey, error)
+	GetApiKeys(ctx context.Context) ([]ApiKey, error)
+	GetApiKeyByPrefix(ctx context.Context, prefix string) (ApiKey, []byte, error)
+	RevokeApiKey(ctx context.Context, keyId int) (bool, error)
+	TouchApiKey(ctx context.Context, keyId int, usedAt time.Time) error
+}
+
+type apiKeyService struct {
+	storage ApiKeyRepository
+	logger  *slog.Logger
+}
+
+func NewApiKeyService(apiKeyRepo ApiKeyRepository, logger *slog.Logger) ApiKeyService {
+	return &apiKeyService{
+		storage: apiKeyRepo,
+		logger:  logger,
+	}
+}
+
+// CreateApiKey generates a key of the form crabi_<prefix>_<secret>. The prefix
+// identifies the key in listings and lookups, the secret is 256 random bits.
+func (u *apiKeyService) CreateApiKey(ctx context.Context, createdBy string, key NewApiKey) (CreatedApiKey, error) {
+	prefixBytes := make([]byte, 4)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return CreatedApiKey{}, fmt.Errorf("service - CreateApiKey: %w", err)
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return CreatedApiKey{}, fmt.Errorf("service - CreateApiKey: %w", err)
+	}
+
+	prefix := hex.EncodeToString(prefixBytes)
+	plain := fmt.Sprintf("%s_%s_%s", apiKeyPrefix, prefix, base64.RawURLEncoding.EncodeToString(secretBytes))
+
+	inserted, err := u.storage.InsertApiKey(ctx, ApiKey{
+		Name:      key.Name,
+		Prefix:    prefix,
+		Scopes:    key.Scopes,
+		CreatedBy: createdBy,
+	}, hashApiKey(plain))
+	if err != nil {
+		return CreatedApiKey{}, err
+	}
+
+	return CreatedApiKey{ApiKey: inserted, Key: plain}, nil
+}
+
+func (u *apiKeyService) ListApiKeys(ctx context.Context) ([]ApiKey, error) {
+	return u.storage.GetApiKeys(ctx)
+}
+
+func (u *apiKeyService) RevokeApiKey(ctx context.Context, keyId int) (bool, error) {
+	return u.storage.RevokeApiKey(ctx, keyId)
+}
+
+// AuthenticateApiKey returns the key matching the plain text key, or an empty
+// ApiKey when it is malformed, unknown or revoked
+func (u *apiKeyService) AuthenticateApiKey(ctx context.Context, key string) (ApiKey, error) {
+	// the secret is base64url and may itself contain underscores
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyPrefix {
+		return ApiKey{}, nil
+	}
+
+	stored, hash, err := u.storage.GetApiKeyByPrefix(ctx, parts[1])
+	if err != nil {
+		return ApiKey{}, err
+	}
+	if stored.KeyId == 0 || stored.RevokedAt != nil {
+		return ApiKey{}, nil
+	}
+	if subtle.ConstantTimeCompare(hash, hashApiKey(key)) != 1 {
+		return ApiKey{}, nil
+	}
+
+	// last use is informational, failing to record it doesn't fail the request
+	if err := u.storage.TouchApiKey(ctx, stored.KeyId, time.Now()); err != nil {
+		u.logger.WarnContext(ctx, "service - api key last use", "api_key_id", stored.KeyId, "error", err)
+	}
+
+	return stored, nil
+}
+
+// keys carry 256 bits of entropy, so a plain SHA-256 is enough to store them:
+// there is nothing to brute force that a slow password hash would protect
+func hashApiKey(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
@@ -0,0 +1,127 @@
+package api_test
+
+import (
+	"context"
+	"crabigateur-api/pkg/api"
+	"crabigateur-api/pkg/logging"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Mock for ApiKeyRepository
+type MockApiKeyRepository struct {
+	mock.Mock
+}
+
+func (m *MockApiKeyRepository) InsertApiKey(ctx context.Context, key api.ApiKey, hash []byte) (api.ApiKey, error) {
+	args := m.Called(key, hash)
+	return args.Get(0).(api.ApiKey), args.Error(1)
+}
+
+func (m *MockApiKeyRepository) GetApiKeys(ctx context.Context) ([]api.ApiKey, error) {
+	args := m.Called()
+	return args.Get(0).([]api.ApiKey), args.Error(1)
+}
+
+func (m *MockApiKeyRepository) GetApiKeyByPrefix(ctx context.Context, prefix string) (api.ApiKey, []byte, error) {
+	args := m.Called(prefix)
+	hash, _ := args.Get(1).([]byte)
+	return args.Get(0).(api.ApiKey), hash, args.Error(2)
+}
+
+func (m *MockApiKeyRepository) RevokeApiKey(ctx context.Context, keyId int) (bool, error) {
+	args := m.Called(keyId)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockApiKeyRepository) TouchApiKey(ctx context.Context, keyId int, usedAt time.Time) error {
+	args := m.Called(keyId, usedAt)
+	return args.Error(0)
+}
+
+func TestApiKeyService_CreateAndAuthenticate(t *testing.T) {
+	mockRepo := new(MockApiKeyRepository)
+	service := api.NewApiKeyService(mockRepo, logging.Discard())
+
+	var stored api.ApiKey
+	var storedHash []byte
+	mockRepo.On("InsertApiKey", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(0).(api.ApiKey)
+		stored.KeyId = 1
+		storedHash = args.Get(1).([]byte)
+	}).Return(api.ApiKey{KeyId: 1, Name: "pipeline"}, nil)
+
+	created, err := service.CreateApiKey(context.Background(), "123", api.NewApiKey{Name: "pipeline", Scopes: []api.Permission{api.CardsWrite}})
+	assert.NoError(t, err)
+
+	parts := strings.SplitN(created.Key, "_", 3)
+	assert.Len(t, parts, 3)
+	assert.Equal(t, "crabi", parts[0])
+	assert.Equal(t, stored.Prefix, parts[1])
+	assert.Equal(t, "123", stored.CreatedBy)
+	assert.Equal(t, []api.Permission{api.CardsWrite}, stored.Scopes)
+	assert.NotContains(t, string(storedHash), parts[2], "the secret must not be stored")
+
+	mockRepo.On("GetApiKeyByPrefix", stored.Prefix).Return(stored, storedHash, nil)
+	mockRepo.On("TouchApiKey", 1, mock.Anything).Return(nil)
+
+	t.Run("Valid key", func(t *testing.T) {
+		key, err := service.AuthenticateApiKey(context.Background(), created.Key)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, key.KeyId)
+		assert.True(t, key.Can(api.CardsWrite))
+		assert.False(t, key.Can(api.StatsRead))
+	})
+
+	t.Run("Wrong secret", func(t *testing.T) {
+		key, err := service.AuthenticateApiKey(context.Background(), parts[0]+"_"+parts[1]+"_wrong")
+		assert.NoError(t, err)
+		assert.Equal(t, api.ApiKey{}, key)
+	})
+
+	t.Run("Malformed key", func(t *testing.T) {
+		key, err := service.AuthenticateApiKey(context.Background(), "not-a-key")
+		assert.NoError(t, err)
+		assert.Equal(t, api.ApiKey{}, key)
+	})
+}
+
+func TestApiKeyService_AuthenticateApiKey(t *testing.T) {
+	revokedAt := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		mockSetup func(m *MockApiKeyRepository)
+	}{
+		{
+			name: "Unknown prefix",
+			mockSetup: func(m *MockApiKeyRepository) {
+				m.On("GetApiKeyByPrefix", "0a1b2c3d").Return(api.ApiKey{}, nil, nil)
+			},
+		},
+		{
+			name: "Revoked key",
+			mockSetup: func(m *MockApiKeyRepository) {
+				m.On("GetApiKeyByPrefix", "0a1b2c3d").Return(api.ApiKey{KeyId: 1, RevokedAt: &revokedAt}, []byte("hash"), nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockApiKeyRepository)
+			service := api.NewApiKeyService(mockRepo, logging.Discard())
+			tt.mockSetup(mockRepo)
+
+			key, err := service.AuthenticateApiKey(context.Background(), "crabi_0a1b2c3d_secret")
+
+			assert.NoError(t, err)
+			assert.Equal(t, api.ApiKey{}, key)
+			mockRepo.AssertNotCalled(t, "TouchApiKey", mock.Anything, mock.Anything)
+		})
+	}
+}
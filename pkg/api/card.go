@@ -1,49 +1,73 @@
 package api
 
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+)
+
 type CardService interface {
-	GetCardById(id int) (Card, error)
-	CreateCard(card Card) (Card, error)
-	UpdateCard(cardId int, card Card) (Card, error)
-	DeleteCard(cardId int) error
-	SearchCards(query CardQueryParams) ([]Card, error)
+	GetCardById(ctx context.Context, id int) (Card, error)
+	CreateCard(ctx context.Context, card Card) (Card, error)
+	UpdateCard(ctx context.Context, cardId int, card Card) (Card, error)
+	DeleteCard(ctx context.Context, cardId int) error
+	SearchCards(ctx context.Context, query CardQueryParams) ([]Card, error)
+	ImportCards(ctx context.Context, cards []Card, dryRun bool) (ImportReport, error)
+	ExportCards(ctx context.Context, fn func(Card) error) error
+	GetTenses(ctx context.Context) ([]string, error)
 }
 
 type CardRepository interface {
-	GetCard(id int) (Card, error)
-	InsertCard(word string, translation []string, wordType string, gender string, level int) (int, error)
-	UpdateCard(cardId int, word string, translation []string, wordType string, gender string, level int) error
-	InsertOrUpdateConjugation(isUpdate bool, cardId int, tense string, forms []string, isIrregular bool) error
-	InsertOrUpdateForm(isUpdate bool, cardId int, gender string, number string, form string) error
-	DeleteCard(cardId int) error
-	SearchCards(query CardQueryParams) ([]Card, error)
+	WithCardTx(ctx context.Context, fn func(CardRepository) error) error
+	GetCard(ctx context.Context, id int) (Card, error)
+	FindCardId(ctx context.Context, word string, gender string) (int, bool, error)
+	InsertCard(ctx context.Context, word string, translation []string, wordType string, gender string, level int) (int, error)
+	UpdateCard(ctx context.Context, cardId int, word string, translation []string, wordType string, gender string, level int) error
+	InsertOrUpdateConjugation(ctx context.Context, isUpdate bool, cardId int, tense string, forms []string, isIrregular bool) error
+	InsertOrUpdateForm(ctx context.Context, isUpdate bool, cardId int, gender string, number string, form string) error
+	DeleteCard(ctx context.Context, cardId int) error
+	SearchCards(ctx context.Context, query CardQueryParams) ([]Card, error)
+	ExportCards(ctx context.Context, fn func(Card) error) error
+	GetTenses(ctx context.Context) ([]string, error)
 }
 
 type cardService struct {
 	storage CardRepository
+	logger  *slog.Logger
 }
 
-func NewCardService(cardRepo CardRepository) CardService {
+func NewCardService(cardRepo CardRepository, logger *slog.Logger) CardService {
 	return &cardService{
 		storage: cardRepo,
+		logger:  logger,
 	}
 }
 
-func (u *cardService) GetCardById(id int) (Card, error) {
-	card, err := u.storage.GetCard(id)
+func (u *cardService) GetCardById(ctx context.Context, id int) (Card, error) {
+	card, err := u.storage.GetCard(ctx, id)
 	if err != nil {
 		return Card{}, err
 	}
 	return card, nil
 }
 
-func (u *cardService) CreateCard(card Card) (Card, error) {
-	cardId, err := u.storage.InsertCard(card.Word, card.Translation, card.WordType, card.Gender, card.Level)
-	if err != nil {
-		return Card{}, err
+// CreateCard stores a card with its forms. A regular verb gets the tenses of
+// ConjugateVerb that its forms leave out.
+func (u *cardService) CreateCard(ctx context.Context, card Card) (Card, error) {
+	if card.WordType == string(Verb) && !card.IrregularVerb {
+		card.Forms = withConjugations(card.Word, card.Forms)
 	}
-	card.CardId = cardId
 
-	err = u.processCardForms(false, card)
+	err := u.storage.WithCardTx(ctx, func(tx CardRepository) error {
+		cardId, err := tx.InsertCard(ctx, card.Word, card.Translation, card.WordType, card.Gender, card.Level)
+		if err != nil {
+			return err
+		}
+		card.CardId = cardId
+
+		return processCardForms(ctx, tx, false, card)
+	})
 	if err != nil {
 		return Card{}, err
 	}
@@ -51,14 +75,17 @@ func (u *cardService) CreateCard(card Card) (Card, error) {
 	return card, nil
 }
 
-func (u *cardService) UpdateCard(cardId int, card Card) (Card, error) {
-	err := u.storage.UpdateCard(cardId, card.Word, card.Translation, card.WordType, card.Gender, card.Level)
-	if err != nil {
-		return Card{}, err
-	}
+func (u *cardService) UpdateCard(ctx context.Context, cardId int, card Card) (Card, error) {
 	card.CardId = cardId // certifies cardId is set in case card payload doesn't include it
 
-	err = u.processCardForms(true, card)
+	err := u.storage.WithCardTx(ctx, func(tx CardRepository) error {
+		err := tx.UpdateCard(ctx, cardId, card.Word, card.Translation, card.WordType, card.Gender, card.Level)
+		if err != nil {
+			return err
+		}
+
+		return processCardForms(ctx, tx, true, card)
+	})
 	if err != nil {
 		return Card{}, err
 	}
@@ -66,14 +93,35 @@ func (u *cardService) UpdateCard(cardId int, card Card) (Card, error) {
 	return card, nil
 }
 
-func (u *cardService) processCardForms(isUpdate bool, card Card) error {
-	for key, value := range card.Forms {
+// withConjugations adds the tenses missing from forms, the given ones are kept.
+// Verbs ConjugateVerb refuses, e.g. pronominal ones, keep their forms as is.
+func withConjugations(infinitive string, forms map[string][]string) map[string][]string {
+	group, err := VerbGroupOf(infinitive)
+	if err != nil {
+		return forms
+	}
+	conjugations, err := ConjugateVerb(infinitive, group)
+	if err != nil {
+		return forms
+	}
+
+	for tense, tenseForms := range forms {
+		conjugations[tense] = tenseForms
+	}
+	return conjugations
+}
+
+// processCardForms writes the forms in the order of their keys, so that the
+// statements of a card are always the same
+func processCardForms(ctx context.Context, storage CardRepository, isUpdate bool, card Card) error {
+	for _, key := range slices.Sorted(maps.Keys(card.Forms)) {
+		value := card.Forms[key]
 		var err error
 		switch {
 		case card.WordType == "verb":
-			err = u.storage.InsertOrUpdateConjugation(isUpdate, card.CardId, key, value, card.IrregularVerb)
+			err = storage.InsertOrUpdateConjugation(ctx, isUpdate, card.CardId, key, value, card.IrregularVerb)
 		case card.WordType == "irregular":
-			err = u.insertIrregularForms(isUpdate, card.CardId, key, value)
+			err = insertIrregularForms(ctx, storage, isUpdate, card.CardId, key, value)
 		}
 		if err != nil {
 			return err
@@ -82,7 +130,7 @@ func (u *cardService) processCardForms(isUpdate bool, card Card) error {
 	return nil
 }
 
-func (u *cardService) insertIrregularForms(isUpdate bool, cardId int, key string, value []string) error {
+func insertIrregularForms(ctx context.Context, storage CardRepository, isUpdate bool, cardId int, key string, value []string) error {
 	var checkedValue string
 	if len(value) == 0 {
 		checkedValue = ""
@@ -92,19 +140,19 @@ func (u *cardService) insertIrregularForms(isUpdate bool, cardId int, key string
 
 	switch FormFlexion(key) {
 	case MascSing:
-		return u.storage.InsertOrUpdateForm(isUpdate, cardId, string(Masc), string(Sing), checkedValue)
+		return storage.InsertOrUpdateForm(ctx, isUpdate, cardId, string(Masc), string(Sing), checkedValue)
 	case MascPlur:
-		return u.storage.InsertOrUpdateForm(isUpdate, cardId, string(Masc), string(Plur), checkedValue)
+		return storage.InsertOrUpdateForm(ctx, isUpdate, cardId, string(Masc), string(Plur), checkedValue)
 	case FemSing:
-		return u.storage.InsertOrUpdateForm(isUpdate, cardId, string(Fem), string(Sing), checkedValue)
+		return storage.InsertOrUpdateForm(ctx, isUpdate, cardId, string(Fem), string(Sing), checkedValue)
 	case FemPlur:
-		return u.storage.InsertOrUpdateForm(isUpdate, cardId, string(Fem), string(Plur), checkedValue)
+		return storage.InsertOrUpdateForm(ctx, isUpdate, cardId, string(Fem), string(Plur), checkedValue)
 	}
 	return nil
 }
 
-func (u *cardService) DeleteCard(cardId int) error {
-	err := u.storage.DeleteCard(cardId)
+func (u *cardService) DeleteCard(ctx context.Context, cardId int) error {
+	err := u.storage.DeleteCard(ctx, cardId)
 	if err != nil {
 		return err
 	}
@@ -112,6 +160,17 @@ func (u *cardService) DeleteCard(cardId int) error {
 	return nil
 }
 
-func (u *cardService) SearchCards(query CardQueryParams) ([]Card, error) {
-	return u.storage.SearchCards(query)
+func (u *cardService) SearchCards(ctx context.Context, query CardQueryParams) ([]Card, error) {
+	return u.storage.SearchCards(ctx, query)
+}
+
+// ExportCards calls fn with every card as it is read from the storage, so that
+// the whole deck is never held in memory
+func (u *cardService) ExportCards(ctx context.Context, fn func(Card) error) error {
+	return u.storage.ExportCards(ctx, fn)
+}
+
+// GetTenses lists the tenses of the conjugated verbs, the columns of a CSV export
+func (u *cardService) GetTenses(ctx context.Context) ([]string, error) {
+	return u.storage.GetTenses(ctx)
 }
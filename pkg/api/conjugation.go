@@ -0,0 +1,227 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Tense names a conjugation in the forms of a verb card
+type Tense string
+
+const (
+	Present     Tense = "présent"
+	Imperfect   Tense = "imparfait"
+	Future      Tense = "futur simple"
+	Conditional Tense = "conditionnel"
+	PastPerfect Tense = "passé composé"
+	Subjunctive Tense = "subjonctif présent"
+	Imperative  Tense = "impératif" // tu, nous and vous only
+)
+
+// Tenses are the tenses ConjugateVerb generates
+var Tenses = []Tense{Present, Imperfect, Future, Conditional, PastPerfect, Subjunctive, Imperative}
+
+// VerbGroup is the ending of a regular verb, which tells how it is conjugated
+type VerbGroup string
+
+const (
+	GroupEr VerbGroup = "er" // parler
+	GroupIr VerbGroup = "ir" // finir, nous finissons
+	GroupRe VerbGroup = "re" // vendre
+)
+
+var (
+	imperfectEndings   = [6]string{"ais", "ais", "ait", "ions", "iez", "aient"}
+	futureEndings      = [6]string{"ai", "as", "a", "ons", "ez", "ont"}
+	subjunctiveEndings = [6]string{"e", "es", "e", "ions", "iez", "ent"}
+
+	avoirPresent = [6]string{"ai", "as", "a", "avons", "avez", "ont"}
+	etrePresent  = [6]string{"suis", "es", "est", "sommes", "êtes", "sont"}
+)
+
+// irregularEndings end the verbs of a group that its rules do not conjugate,
+// e.g. partir or prendre, and their compounds such as repartir or apprendre
+var irregularEndings = map[VerbGroup][]string{
+	GroupEr: {"aller", "envoyer"},
+	GroupIr: {"oir", "venir", "tenir", "partir", "sortir", "dormir", "servir", "sentir", "mentir", "courir",
+		"mourir", "ouvrir", "frir", "cueillir", "fuir", "quérir", "bouillir", "vêtir", "aillir"},
+	GroupRe: {"prendre", "indre", "soudre", "coudre", "moudre"},
+}
+
+// etreVerbs form their passé composé with être, the others with avoir
+var etreVerbs = []string{"arriver", "entrer", "rentrer", "monter", "remonter", "rester", "retourner",
+	"tomber", "retomber", "descendre", "redescendre", "décéder"}
+
+// muteAccentVerbs take an è rather than doubling the consonant of their -eler
+// or -eter ending, e.g. j'achète but j'appelle
+var muteAccentVerbs = []string{"acheter", "racheter", "geler", "congeler", "dégeler", "surgeler", "peler",
+	"modeler", "marteler", "harceler", "haleter", "crocheter", "fureter", "ciseler", "démanteler",
+	"écarteler", "receler", "déceler"}
+
+// a mute e or an é before the consonant ending the stem, e.g. lev(er) or
+// préfér(er), becomes è before a silent ending
+var (
+	muteEStem   = regexp.MustCompile(`e((?:ch|gn|gu|qu|[bcdfghjklmnpqrstvwxz])[lr]?)$`)
+	closedEStem = regexp.MustCompile(`é((?:ch|gn|gu|qu|[bcdfghjklmnpqrstvwxz])[lr]?)$`)
+)
+
+// VerbGroupOf tells the group of a verb from the ending of its infinitive.
+// Pronominal verbs, e.g. "se laver", are not conjugated.
+func VerbGroupOf(infinitive string) (VerbGroup, error) {
+	if strings.ContainsAny(infinitive, " '’") {
+		return "", fmt.Errorf("%w: cannot conjugate %q, only single word infinitives", ErrValidation, infinitive)
+	}
+
+	for _, group := range []VerbGroup{GroupEr, GroupIr, GroupRe} {
+		if len(infinitive) > len(group) && strings.HasSuffix(infinitive, string(group)) {
+			return group, nil
+		}
+	}
+	return "", fmt.Errorf("%w: cannot conjugate %q, infinitives end in -er, -ir or -re", ErrValidation, infinitive)
+}
+
+// ConjugateVerb conjugates a regular verb of group in every tense of Tenses,
+// keyed like the forms of a card. Tenses hold the six persons from je to ils,
+// the impératif tu, nous and vous. Past participles agree with the masculine
+// subject, e.g. "sont tombés". Verbs the group's rules do not conjugate, such
+// as aller or prendre, are refused.
+func ConjugateVerb(infinitive string, group VerbGroup) (map[string][]string, error) {
+	if actual, err := VerbGroupOf(infinitive); err != nil {
+		return nil, err
+	} else if actual != group {
+		return nil, fmt.Errorf("%w: %q is not a -%s verb", ErrValidation, infinitive, group)
+	}
+	for _, ending := range irregularEndings[group] {
+		if strings.HasSuffix(infinitive, ending) {
+			return nil, fmt.Errorf("%w: %q is an irregular verb", ErrValidation, infinitive)
+		}
+	}
+	if group == GroupRe && !strings.HasSuffix(infinitive, "dre") && !strings.HasSuffix(infinitive, "rompre") {
+		return nil, fmt.Errorf("%w: %q is an irregular verb", ErrValidation, infinitive)
+	}
+
+	stem := strings.TrimSuffix(infinitive, string(group))
+	var present, imperfect [6]string
+	var futureStem, participle string
+
+	switch group {
+	case GroupEr:
+		for i, ending := range [6]string{"e", "es", "e", "ons", "ez", "ent"} {
+			if i == 3 || i == 4 {
+				present[i] = soften(stem, ending) + ending
+			} else {
+				present[i] = silentStem(infinitive, false) + ending
+			}
+		}
+		for i, ending := range imperfectEndings {
+			imperfect[i] = soften(stem, ending) + ending
+		}
+		futureStem = silentStem(infinitive, true) + "er"
+		participle = stem + "é"
+	case GroupIr:
+		for i, ending := range [6]string{"is", "is", "it", "issons", "issez", "issent"} {
+			present[i] = stem + ending
+		}
+		for i, ending := range imperfectEndings {
+			imperfect[i] = stem + "iss" + ending
+		}
+		futureStem = infinitive
+		participle = stem + "i"
+	case GroupRe:
+		for i, ending := range [6]string{"s", "s", "", "ons", "ez", "ent"} {
+			present[i] = stem + ending
+		}
+		if !strings.HasSuffix(stem, "d") {
+			present[2] += "t" // il rompt
+		}
+		for i, ending := range imperfectEndings {
+			imperfect[i] = stem + ending
+		}
+		futureStem = stem + "r"
+		participle = stem + "u"
+	}
+
+	var future, conditional, pastPerfect, subjunctive [6]string
+	auxiliary, agreement := avoirPresent, [6]string{}
+	if slices.Contains(etreVerbs, infinitive) {
+		auxiliary, agreement = etrePresent, [6]string{3: "s", 4: "s", 5: "s"}
+	}
+	// the subjonctif is built on the stem of ils, its nous and vous forms are
+	// those of the imparfait
+	subjunctiveStem := strings.TrimSuffix(present[5], "ent")
+	for i := range 6 {
+		future[i] = futureStem + futureEndings[i]
+		conditional[i] = futureStem + imperfectEndings[i]
+		pastPerfect[i] = auxiliary[i] + " " + participle + agreement[i]
+		if i == 3 || i == 4 {
+			subjunctive[i] = imperfect[i]
+		} else {
+			subjunctive[i] = subjunctiveStem + subjunctiveEndings[i]
+		}
+	}
+
+	imperativeTu := present[1]
+	if group == GroupEr {
+		imperativeTu = strings.TrimSuffix(imperativeTu, "s") // tu parles, parle
+	}
+
+	return map[string][]string{
+		string(Present):     present[:],
+		string(Imperfect):   imperfect[:],
+		string(Future):      future[:],
+		string(Conditional): conditional[:],
+		string(PastPerfect): pastPerfect[:],
+		string(Subjunctive): subjunctive[:],
+		string(Imperative):  {imperativeTu, present[3], present[4]},
+	}, nil
+}
+
+// soften keeps the sound of the c and g ending the stem of a -cer or -ger verb
+// before an ending starting with a or o, e.g. commençons, mangeais
+func soften(stem, ending string) string {
+	if !strings.HasPrefix(ending, "a") && !strings.HasPrefix(ending, "o") {
+		return stem
+	}
+	if strings.HasSuffix(stem, "c") {
+		return strings.TrimSuffix(stem, "c") + "ç"
+	} else if strings.HasSuffix(stem, "g") {
+		return stem + "e"
+	}
+	return stem
+}
+
+// silentStem is the stem of an -er verb before a silent e: the e, es and ent
+// of the présent and the subjonctif, and the futur simple and conditionnel,
+// which keep the é of e.g. préférer
+func silentStem(infinitive string, future bool) string {
+	stem := strings.TrimSuffix(infinitive, string(GroupEr))
+
+	for _, ending := range []string{"ay", "oy", "uy"} {
+		if strings.HasSuffix(stem, ending) {
+			return strings.TrimSuffix(stem, "y") + "i" // paie, nettoie, essuie
+		}
+	}
+
+	if match := closedEStem.FindStringSubmatchIndex(stem); match != nil {
+		if future {
+			return stem
+		}
+		return stem[:match[0]] + "è" + stem[match[2]:]
+	}
+
+	if match := muteEStem.FindStringSubmatchIndex(stem); match != nil {
+		consonants := stem[match[2]:]
+		switch {
+		case len(consonants) == 2 && consonants[0] == consonants[1]:
+			return stem // interpelle
+		case (consonants == "l" || consonants == "t") && !slices.Contains(muteAccentVerbs, infinitive):
+			return stem + consonants // appelle, jette
+		default:
+			return stem[:match[0]] + "è" + consonants
+		}
+	}
+
+	return stem
+}
@@ -0,0 +1,182 @@
+package api_test
+
+import (
+	"context"
+	"crabigateur-api/pkg/api"
+	"crabigateur-api/pkg/logging"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestConjugateVerb(t *testing.T) {
+	tests := []struct {
+		infinitive string
+		group      api.VerbGroup
+		tense      api.Tense
+		expected   string // the forms separated by spaces, or by commas with an auxiliary
+	}{
+		{"parler", api.GroupEr, api.Present, "parle parles parle parlons parlez parlent"},
+		{"parler", api.GroupEr, api.Imperfect, "parlais parlais parlait parlions parliez parlaient"},
+		{"parler", api.GroupEr, api.Future, "parlerai parleras parlera parlerons parlerez parleront"},
+		{"parler", api.GroupEr, api.Conditional, "parlerais parlerais parlerait parlerions parleriez parleraient"},
+		{"parler", api.GroupEr, api.PastPerfect, "ai parlé, as parlé, a parlé, avons parlé, avez parlé, ont parlé"},
+		{"parler", api.GroupEr, api.Subjunctive, "parle parles parle parlions parliez parlent"},
+		{"parler", api.GroupEr, api.Imperative, "parle parlons parlez"},
+
+		{"commencer", api.GroupEr, api.Present, "commence commences commence commençons commencez commencent"},
+		{"commencer", api.GroupEr, api.Imperfect, "commençais commençais commençait commencions commenciez commençaient"},
+		{"manger", api.GroupEr, api.Present, "mange manges mange mangeons mangez mangent"},
+		{"manger", api.GroupEr, api.Imperfect, "mangeais mangeais mangeait mangions mangiez mangeaient"},
+		{"manger", api.GroupEr, api.Subjunctive, "mange manges mange mangions mangiez mangent"},
+		{"appeler", api.GroupEr, api.Present, "appelle appelles appelle appelons appelez appellent"},
+		{"appeler", api.GroupEr, api.Future, "appellerai appelleras appellera appellerons appellerez appelleront"},
+		{"jeter", api.GroupEr, api.Subjunctive, "jette jettes jette jetions jetiez jettent"},
+		{"acheter", api.GroupEr, api.Present, "achète achètes achète achetons achetez achètent"},
+		{"acheter", api.GroupEr, api.Conditional, "achèterais achèterais achèterait achèterions achèteriez achèteraient"},
+		{"lever", api.GroupEr, api.Imperative, "lève levons levez"},
+		{"préférer", api.GroupEr, api.Present, "préfère préfères préfère préférons préférez préfèrent"},
+		{"préférer", api.GroupEr, api.Future, "préférerai préféreras préférera préférerons préférerez préféreront"},
+		{"régner", api.GroupEr, api.Present, "règne règnes règne régnons régnez règnent"},
+		{"nettoyer", api.GroupEr, api.Present, "nettoie nettoies nettoie nettoyons nettoyez nettoient"},
+		{"nettoyer", api.GroupEr, api.Future, "nettoierai nettoieras nettoiera nettoierons nettoierez nettoieront"},
+		{"payer", api.GroupEr, api.Subjunctive, "paie paies paie payions payiez paient"},
+		{"étudier", api.GroupEr, api.Imperfect, "étudiais étudiais étudiait étudiions étudiiez étudiaient"},
+		{"créer", api.GroupEr, api.PastPerfect, "ai créé, as créé, a créé, avons créé, avez créé, ont créé"},
+		{"tomber", api.GroupEr, api.PastPerfect, "suis tombé, es tombé, est tombé, sommes tombés, êtes tombés, sont tombés"},
+
+		{"finir", api.GroupIr, api.Present, "finis finis finit finissons finissez finissent"},
+		{"finir", api.GroupIr, api.Imperfect, "finissais finissais finissait finissions finissiez finissaient"},
+		{"finir", api.GroupIr, api.Future, "finirai finiras finira finirons finirez finiront"},
+		{"finir", api.GroupIr, api.Conditional, "finirais finirais finirait finirions finiriez finiraient"},
+		{"finir", api.GroupIr, api.PastPerfect, "ai fini, as fini, a fini, avons fini, avez fini, ont fini"},
+		{"finir", api.GroupIr, api.Subjunctive, "finisse finisses finisse finissions finissiez finissent"},
+		{"finir", api.GroupIr, api.Imperative, "finis finissons finissez"},
+		{"obéir", api.GroupIr, api.Present, "obéis obéis obéit obéissons obéissez obéissent"},
+
+		{"vendre", api.GroupRe, api.Present, "vends vends vend vendons vendez vendent"},
+		{"vendre", api.GroupRe, api.Imperfect, "vendais vendais vendait vendions vendiez vendaient"},
+		{"vendre", api.GroupRe, api.Future, "vendrai vendras vendra vendrons vendrez vendront"},
+		{"vendre", api.GroupRe, api.Conditional, "vendrais vendrais vendrait vendrions vendriez vendraient"},
+		{"vendre", api.GroupRe, api.PastPerfect, "ai vendu, as vendu, a vendu, avons vendu, avez vendu, ont vendu"},
+		{"vendre", api.GroupRe, api.Subjunctive, "vende vendes vende vendions vendiez vendent"},
+		{"vendre", api.GroupRe, api.Imperative, "vends vendons vendez"},
+		{"rompre", api.GroupRe, api.Present, "romps romps rompt rompons rompez rompent"},
+		{"descendre", api.GroupRe, api.PastPerfect, "suis descendu, es descendu, est descendu, sommes descendus, êtes descendus, sont descendus"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.infinitive+" "+string(tt.tense), func(t *testing.T) {
+			separator := " "
+			if strings.Contains(tt.expected, ",") {
+				separator = ", "
+			}
+
+			forms, err := api.ConjugateVerb(tt.infinitive, tt.group)
+
+			assert.NoError(t, err)
+			assert.Len(t, forms, len(api.Tenses))
+			assert.Equal(t, strings.Split(tt.expected, separator), forms[string(tt.tense)])
+		})
+	}
+}
+
+func TestConjugateVerb_Refused(t *testing.T) {
+	tests := []struct {
+		infinitive string
+		group      api.VerbGroup
+		expectErr  string
+	}{
+		{"aller", api.GroupEr, `validation failed: "aller" is an irregular verb`},
+		{"renvoyer", api.GroupEr, `validation failed: "renvoyer" is an irregular verb`},
+		{"devenir", api.GroupIr, `validation failed: "devenir" is an irregular verb`},
+		{"partir", api.GroupIr, `validation failed: "partir" is an irregular verb`},
+		{"voir", api.GroupIr, `validation failed: "voir" is an irregular verb`},
+		{"apprendre", api.GroupRe, `validation failed: "apprendre" is an irregular verb`},
+		{"peindre", api.GroupRe, `validation failed: "peindre" is an irregular verb`},
+		{"faire", api.GroupRe, `validation failed: "faire" is an irregular verb`},
+		{"chanter", api.GroupIr, `validation failed: "chanter" is not a -ir verb`},
+		{"se laver", api.GroupEr, `validation failed: cannot conjugate "se laver", only single word infinitives`},
+		{"s'appeler", api.GroupEr, `validation failed: cannot conjugate "s'appeler", only single word infinitives`},
+		{"bonjour", api.GroupEr, `validation failed: cannot conjugate "bonjour", infinitives end in -er, -ir or -re`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.infinitive, func(t *testing.T) {
+			forms, err := api.ConjugateVerb(tt.infinitive, tt.group)
+
+			assert.EqualError(t, err, tt.expectErr)
+			assert.True(t, errors.Is(err, api.ErrValidation))
+			assert.Nil(t, forms)
+		})
+	}
+}
+
+func TestVerbGroupOf(t *testing.T) {
+	for infinitive, expected := range map[string]api.VerbGroup{"parler": api.GroupEr, "finir": api.GroupIr, "vendre": api.GroupRe} {
+		group, err := api.VerbGroupOf(infinitive)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, group)
+	}
+
+	_, err := api.VerbGroupOf("er")
+	assert.ErrorIs(t, err, api.ErrValidation)
+}
+
+func TestCardService_CreateCard(t *testing.T) {
+	// the engine writes paie, the other spelling shows the given tense is kept
+	givenPresent := []string{"paye", "payes", "paye", "payons", "payez", "payent"}
+
+	tests := []struct {
+		name           string
+		card           api.Card
+		expectedTenses []string
+	}{
+		{
+			name: "Regular verb gets the tenses left out",
+			card: api.Card{Level: 1, Word: "payer", WordType: "verb", Translation: []string{"to pay"},
+				Forms: map[string][]string{"présent": givenPresent}},
+			expectedTenses: []string{"conditionnel", "futur simple", "imparfait", "impératif", "passé composé", "présent", "subjonctif présent"},
+		},
+		{
+			name: "Irregular verb keeps its forms",
+			card: api.Card{Level: 1, Word: "aller", WordType: "verb", Translation: []string{"to go"}, IrregularVerb: true,
+				Forms: map[string][]string{"présent": {"vais", "vas", "va", "allons", "allez", "vont"}}},
+			expectedTenses: []string{"présent"},
+		},
+		{
+			name: "Verb the engine refuses keeps its forms",
+			card: api.Card{Level: 1, Word: "se laver", WordType: "verb", Translation: []string{"to wash"},
+				Forms: map[string][]string{"présent": {"me lave", "te laves", "se lave", "nous lavons", "vous lavez", "se lavent"}}},
+			expectedTenses: []string{"présent"},
+		},
+		{
+			name:           "Other words have no conjugation",
+			card:           api.Card{Level: 1, Word: "chat", WordType: "regular", Gender: "m", Translation: []string{"cat"}},
+			expectedTenses: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(MockCardRepository)
+			repo.On("InsertCard", tt.card.Word, tt.card.Translation, tt.card.WordType, tt.card.Gender, tt.card.Level).Return(5, nil)
+			var tenses []string
+			repo.On("InsertOrUpdateConjugation", false, 5, mock.Anything, mock.Anything, tt.card.IrregularVerb).
+				Run(func(args mock.Arguments) { tenses = append(tenses, args.String(2)) }).
+				Return(nil)
+
+			card, err := api.NewCardService(repo, logging.Discard()).CreateCard(context.Background(), tt.card)
+
+			assert.NoError(t, err)
+			assert.Equal(t, 5, card.CardId)
+			assert.Equal(t, tt.expectedTenses, tenses, "tenses are written in order")
+			if len(tt.card.Forms) > 0 {
+				assert.Equal(t, tt.card.Forms["présent"], card.Forms["présent"], "given tenses are kept")
+			}
+		})
+	}
+}
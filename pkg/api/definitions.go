@@ -76,7 +76,16 @@ type CardQueryParams struct {
 	Offset   *int   `form:"offset"`
 }
 
+type ImportParams struct {
+	DryRun bool `form:"dry_run"` // validate and report without saving
+}
+
+type ExportParams struct {
+	Format string `form:"format" binding:"omitempty,oneof=ndjson csv"` // ndjson by default
+}
+
 type Review struct {
+	ReviewId       string    `json:"review_id" binding:"omitempty,uuid"` // generated by the client, makes retries idempotent (without their level_up)
 	CardId         int       `json:"card_id" binding:"required"`
 	ReviewDate     time.Time `json:"review_date" binding:"required" time_format:"2006-01-02T15:04:05Z07:00"`
 	Success        *bool     `json:"success" binding:"required"`
@@ -84,14 +93,67 @@ type Review struct {
 }
 
 type Reviews struct {
-	Reviews []Review `json:"reviews" binding:"dive"`
+	Reviews []Review `json:"reviews" binding:"required,min=1,max=500,dive"`
 }
 
 type ReviewResult struct {
-	CardId   int    `json:"card_id"`
-	CardWord string `json:"card_word"`
-	Success  bool   `json:"success"`
-	StageId  string `json:"stage_id"`
+	CardId   int           `json:"card_id"`
+	CardWord string        `json:"card_word"`
+	Success  bool          `json:"success"`
+	StageId  string        `json:"stage_id"`
+	LevelUp  *LevelUpEvent `json:"level_up,omitempty"`
+}
+
+type BatchReviewResult struct {
+	Index  int           `json:"index"` // position of the review in the submitted batch
+	CardId int           `json:"card_id"`
+	Result *ReviewResult `json:"result,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+type LevelUpEvent struct {
+	PreviousLevel int `json:"previous_level"`
+	NewLevel      int `json:"new_level"`
+}
+
+type QuestionType string
+
+const (
+	TranslationQuestion QuestionType = "translation"
+	FormQuestion        QuestionType = "form"
+	GenderQuestion      QuestionType = "gender"
+)
+
+type Answer struct {
+	ReviewId       string       `json:"review_id" binding:"omitempty,uuid"`
+	CardId         int          `json:"card_id" binding:"required"`
+	ReviewDate     time.Time    `json:"review_date" binding:"required" time_format:"2006-01-02T15:04:05Z07:00"`
+	QuestionType   QuestionType `json:"question_type" binding:"required,oneof=translation form gender"`
+	Form           string       `json:"form" binding:"required_if=QuestionType form"` // key of Card.Forms, e.g. "f.s." or a tense
+	FormIndex      int          `json:"form_index" binding:"gte=0"`                   // position in the form list, e.g. the person of a conjugation
+	Answer         string       `json:"answer" binding:"required"`
+	IncorrectCount int          `json:"incorrect_count" binding:"gte=0"` // wrong attempts already made on this card
+}
+
+type Verdict string
+
+const (
+	Correct       Verdict = "correct"
+	MissingAccent Verdict = "missing_accent"
+	Typo          Verdict = "typo"
+	Incorrect     Verdict = "incorrect"
+)
+
+type Grade struct {
+	Verdict  Verdict  `json:"verdict"`
+	Correct  bool     `json:"correct"`
+	Expected []string `json:"expected"`
+	Matched  string   `json:"matched,omitempty"`
+}
+
+type AnswerResult struct {
+	Grade  Grade        `json:"grade"`
+	Review ReviewResult `json:"review"`
 }
 
 type QuizList struct {
@@ -114,3 +176,25 @@ type CardTag struct {
 	Word string `json:"card_word"`
 	Type string `json:"word_type"`
 }
+
+type User struct {
+	UserId     string        `json:"user_id" binding:"required,numeric,max=255"`
+	Username   string        `json:"username" binding:"required,username"`
+	Email      string        `json:"email" binding:"required,email,max=255"`
+	Level      int           `json:"level"` // only changed through SetUserLevel or a promotion, 1 on creation
+	Scheduler  SchedulerType `json:"scheduler" binding:"omitempty,oneof=stages fsrs"`
+	Role       Role          `json:"role"` // only changed through SetUserRole, never from a user payload
+	DateJoined time.Time     `json:"date_joined"`
+}
+
+// UserUpdate holds what learners may change themselves, their level goes
+// through the admin only SetUserLevel
+type UserUpdate struct {
+	Username  *string        `json:"username" binding:"omitempty,username"`
+	Email     *string        `json:"email" binding:"omitempty,email,max=255"`
+	Scheduler *SchedulerType `json:"scheduler" binding:"omitempty,oneof=stages fsrs"`
+}
+
+type LevelUpdate struct {
+	Level int `json:"level" binding:"required,gte=1"`
+}
@@ -0,0 +1,46 @@
+package api
+
+import "errors"
+
+// Kinds of failure. Errors returned by services and repositories wrap one of
+// them, so callers can tell a missing row from a broken database without
+// parsing messages.
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrDuplicate  = errors.New("already exists")
+	ErrConflict   = errors.New("conflict")
+	ErrValidation = errors.New("validation failed")
+)
+
+// Error is a failure of a known kind whose message can be shown to API clients
+type Error struct {
+	Kind    error
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+func newError(kind error, message string) error {
+	return &Error{Kind: kind, Message: message}
+}
+
+var (
+	ErrCardNotFound     = newError(ErrNotFound, "Card not found")
+	ErrUserNotFound     = newError(ErrNotFound, "User not found")
+	ErrApiKeyNotFound   = newError(ErrNotFound, "API key not found")
+	ErrLessonNotFound   = newError(ErrNotFound, "Card has not been learnt in a lesson yet")
+	ErrDuplicateCard    = newError(ErrDuplicate, "A card with this word already exists")
+	ErrDuplicateUser    = newError(ErrDuplicate, "A user with this id already exists")
+	ErrInvalidQuestion  = newError(ErrValidation, "Invalid question for this card")
+	ErrLevelOutOfRange  = newError(ErrValidation, "Level is above the highest card level")
+	ErrStaleReview      = newError(ErrConflict, "Review is older than the last applied review of this card")
+	ErrReviewIdConflict = newError(ErrConflict, "Review id was already used for another card")
+	ErrLastAdmin        = newError(ErrConflict, "The last admin cannot be demoted")
+	ErrLastAdminDeleted = newError(ErrConflict, "The last admin cannot be deleted")
+)
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// FSRS (Free Spaced Repetition Scheduler) models each card's memory with a
+// difficulty in [1, 10], a stability in days (the interval after which recall
+// probability drops to 90%) and the retrievability at review time.
+// This implements the FSRS-4.5 long-term scheduling formulas.
+
+const (
+	fsrsDecay  = -0.5
+	fsrsFactor = 19.0 / 81.0 // 0.9^(1/decay) - 1, so that R(S, S) = 0.9
+)
+
+type FSRSParameters struct {
+	Weights          [17]float64
+	DesiredRetention float64 // recall probability at which the next review is scheduled
+	MaximumInterval  int     // upper bound of an interval, in days
+}
+
+var DefaultFSRSParameters = FSRSParameters{
+	Weights: [17]float64{
+		0.4872, 1.4003, 3.7145, 13.8206, 5.1618, 1.2298, 0.8975, 0.031, 1.6474,
+		0.1367, 1.0461, 2.1072, 0.0793, 0.3246, 1.587, 0.2272, 2.8755,
+	},
+	DesiredRetention: 0.9,
+	MaximumInterval:  36500,
+}
+
+// FSRSRating is the grade of a review on the usual FSRS scale.
+type FSRSRating int
+
+const (
+	Again FSRSRating = 1
+	Hard  FSRSRating = 2
+	Good  FSRSRating = 3
+	Easy  FSRSRating = 4
+)
+
+// RatingFor maps a review onto an FSRS grade: a failed review is Again, a success
+// that needed retries is Hard and a clean success is Good. Reviews carry no
+// signal for Easy.
+func RatingFor(success bool, incorrectCount int) FSRSRating {
+	switch {
+	case !success:
+		return Again
+	case incorrectCount > 0:
+		return Hard
+	default:
+		return Good
+	}
+}
+
+type fsrsScheduler struct {
+	params FSRSParameters
+}
+
+func NewFSRSScheduler(params FSRSParameters) Scheduler {
+	return &fsrsScheduler{
+		params: params,
+	}
+}
+
+func (f *fsrsScheduler) Schedule(input ScheduleInput) (ScheduleResult, error) {
+	rating := RatingFor(input.Success, input.IncorrectCount)
+
+	var memory MemoryState
+	if input.Memory.Stability <= 0 || input.Memory.LastReview.IsZero() {
+		memory = MemoryState{
+			Difficulty:     f.params.InitialDifficulty(rating),
+			Stability:      f.params.InitialStability(rating),
+			Retrievability: 1,
+		}
+	} else {
+		elapsedDays := max(0, input.ReviewDate.Sub(input.Memory.LastReview).Hours()/24)
+		memory = f.params.NextMemoryState(input.Memory, elapsedDays, rating)
+	}
+	memory.LastReview = input.ReviewDate
+
+	interval := f.params.NextInterval(memory.Stability)
+	stage, err := stageForInterval(input.Stages, interval)
+	if err != nil {
+		return ScheduleResult{}, err
+	}
+
+	return ScheduleResult{
+		Stage:          stage,
+		NextReviewDate: input.ReviewDate.AddDate(0, 0, interval),
+		Memory:         memory,
+	}, nil
+}
+
+// NextMemoryState updates a card's memory after a review elapsedDays after the previous one.
+func (p FSRSParameters) NextMemoryState(memory MemoryState, elapsedDays float64, rating FSRSRating) MemoryState {
+	retrievability := Retrievability(elapsedDays, memory.Stability)
+
+	var stability float64
+	if rating == Again {
+		stability = min(p.forgetStability(memory.Difficulty, memory.Stability, retrievability), memory.Stability)
+	} else {
+		stability = p.recallStability(memory.Difficulty, memory.Stability, retrievability, rating)
+	}
+
+	return MemoryState{
+		Difficulty:     p.nextDifficulty(memory.Difficulty, rating),
+		Stability:      stability,
+		Retrievability: retrievability,
+	}
+}
+
+// Retrievability is the probability of recalling a card elapsedDays after its last
+// review: R(t, S) = (1 + factor * t / S) ^ decay.
+func Retrievability(elapsedDays float64, stability float64) float64 {
+	return math.Pow(1+fsrsFactor*elapsedDays/stability, fsrsDecay)
+}
+
+func (p FSRSParameters) InitialStability(rating FSRSRating) float64 {
+	return max(p.Weights[rating-1], 0.1)
+}
+
+func (p FSRSParameters) InitialDifficulty(rating FSRSRating) float64 {
+	w := p.Weights
+	return clampDifficulty(w[4] - float64(rating-3)*w[5])
+}
+
+func (p FSRSParameters) nextDifficulty(difficulty float64, rating FSRSRating) float64 {
+	w := p.Weights
+	next := difficulty - w[6]*float64(rating-3)
+	// mean reversion towards the difficulty of a first "Good" answer
+	return clampDifficulty(w[7]*p.InitialDifficulty(Good) + (1-w[7])*next)
+}
+
+func (p FSRSParameters) recallStability(difficulty, stability, retrievability float64, rating FSRSRating) float64 {
+	w := p.Weights
+	hardPenalty, easyBonus := 1.0, 1.0
+	if rating == Hard {
+		hardPenalty = w[15]
+	}
+	if rating == Easy {
+		easyBonus = w[16]
+	}
+
+	return stability * (1 + math.Exp(w[8])*
+		(11-difficulty)*
+		math.Pow(stability, -w[9])*
+		(math.Exp(w[10]*(1-retrievability))-1)*
+		hardPenalty*easyBonus)
+}
+
+func (p FSRSParameters) forgetStability(difficulty, stability, retrievability float64) float64 {
+	w := p.Weights
+	return w[11] *
+		math.Pow(difficulty, -w[12]) *
+		(math.Pow(stability+1, w[13]) - 1) *
+		math.Exp(w[14]*(1-retrievability))
+}
+
+// NextInterval is the number of days until the recall probability of a card with
+// the given stability drops to the desired retention.
+func (p FSRSParameters) NextInterval(stability float64) int {
+	interval := stability / fsrsFactor * (math.Pow(p.DesiredRetention, 1/fsrsDecay) - 1)
+	return min(max(int(math.Round(interval)), 1), p.MaximumInterval)
+}
+
+func clampDifficulty(difficulty float64) float64 {
+	return min(max(difficulty, 1), 10)
+}
+
+// stageForInterval keeps FSRS cards visible to the stage-based parts of the API
+// (stats, level progression) by picking the highest stage whose interval fits in
+// the FSRS interval. The last stage is never assigned since FSRS cards never burn.
+func stageForInterval(stages StageTable, intervalDays int) (int, error) {
+	last := stages.Max()
+	if last < 2 {
+		return 0, fmt.Errorf("scheduler - not enough SRS stages to place FSRS cards")
+	}
+
+	interval := time.Duration(intervalDays) * 24 * time.Hour
+	stage := 1
+	for _, s := range stages {
+		if s.StageId < last && s.StageId > stage && s.Interval <= interval {
+			stage = s.StageId
+		}
+	}
+	return stage, nil
+}
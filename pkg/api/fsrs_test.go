@@ -0,0 +1,143 @@
+package api_test
+
+import (
+	"crabigateur-api/pkg/api"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const fsrsTolerance = 1e-6
+
+func TestRatingFor(t *testing.T) {
+	tests := []struct {
+		name           string
+		success        bool
+		incorrectCount int
+		expected       api.FSRSRating
+	}{
+		{name: "Failed review", success: false, incorrectCount: 2, expected: api.Again},
+		{name: "Success after mistakes", success: true, incorrectCount: 1, expected: api.Hard},
+		{name: "Clean success", success: true, incorrectCount: 0, expected: api.Good},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, api.RatingFor(tt.success, tt.incorrectCount))
+		})
+	}
+}
+
+func TestRetrievability(t *testing.T) {
+	assert.InDelta(t, 1.0, api.Retrievability(0, 3.7145), fsrsTolerance)
+	assert.InDelta(t, 0.9, api.Retrievability(3.7145, 3.7145), fsrsTolerance)
+	assert.InDelta(t, 0.8934995006528037, api.Retrievability(4, 3.7145), fsrsTolerance)
+}
+
+func TestFSRSParameters_InitialState(t *testing.T) {
+	params := api.DefaultFSRSParameters
+
+	tests := []struct {
+		rating             api.FSRSRating
+		expectedStability  float64
+		expectedDifficulty float64
+	}{
+		{rating: api.Again, expectedStability: 0.4872, expectedDifficulty: 7.6214},
+		{rating: api.Hard, expectedStability: 1.4003, expectedDifficulty: 6.3916},
+		{rating: api.Good, expectedStability: 3.7145, expectedDifficulty: 5.1618},
+		{rating: api.Easy, expectedStability: 13.8206, expectedDifficulty: 3.932},
+	}
+
+	for _, tt := range tests {
+		assert.InDelta(t, tt.expectedStability, params.InitialStability(tt.rating), fsrsTolerance)
+		assert.InDelta(t, tt.expectedDifficulty, params.InitialDifficulty(tt.rating), fsrsTolerance)
+	}
+}
+
+func TestFSRSParameters_NextMemoryState(t *testing.T) {
+	params := api.DefaultFSRSParameters
+	afterFirstGood := api.MemoryState{Difficulty: 5.1618, Stability: 3.7145, Retrievability: 1}
+
+	tests := []struct {
+		name     string
+		rating   api.FSRSRating
+		expected api.MemoryState
+	}{
+		{
+			name:     "Good after four days",
+			rating:   api.Good,
+			expected: api.MemoryState{Difficulty: 5.1618, Stability: 14.808100506496405, Retrievability: 0.8934995006528037},
+		},
+		{
+			name:     "Hard after four days",
+			rating:   api.Hard,
+			expected: api.MemoryState{Difficulty: 6.0314775, Stability: 6.234966035075983, Retrievability: 0.8934995006528037},
+		},
+		{
+			name:     "Again after four days",
+			rating:   api.Again,
+			expected: api.MemoryState{Difficulty: 6.901155, Stability: 1.4332344897795595, Retrievability: 0.8934995006528037},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory := params.NextMemoryState(afterFirstGood, 4, tt.rating)
+
+			assert.InDelta(t, tt.expected.Difficulty, memory.Difficulty, fsrsTolerance)
+			assert.InDelta(t, tt.expected.Stability, memory.Stability, fsrsTolerance)
+			assert.InDelta(t, tt.expected.Retrievability, memory.Retrievability, fsrsTolerance)
+		})
+	}
+}
+
+func TestFSRSParameters_NextInterval(t *testing.T) {
+	params := api.DefaultFSRSParameters
+
+	assert.Equal(t, 1, params.NextInterval(0.4872))
+	assert.Equal(t, 4, params.NextInterval(3.7145))
+	assert.Equal(t, 15, params.NextInterval(14.808100506496405))
+	assert.Equal(t, params.MaximumInterval, params.NextInterval(1e9))
+}
+
+func TestFSRSScheduler_Schedule(t *testing.T) {
+	scheduler := api.NewFSRSScheduler(api.DefaultFSRSParameters)
+	firstReview := time.Date(2024, 12, 1, 10, 0, 0, 0, time.UTC)
+	secondReview := firstReview.AddDate(0, 0, 4)
+
+	first, err := scheduler.Schedule(api.ScheduleInput{
+		Stage:      0,
+		Success:    true,
+		ReviewDate: firstReview,
+		Stages:     testStages,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, first.Stage)
+	assert.Equal(t, firstReview.AddDate(0, 0, 4), first.NextReviewDate)
+	assert.Equal(t, firstReview, first.Memory.LastReview)
+
+	second, err := scheduler.Schedule(api.ScheduleInput{
+		Stage:      first.Stage,
+		Success:    true,
+		ReviewDate: secondReview,
+		Stages:     testStages,
+		Memory:     first.Memory,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 6, second.Stage) // 15 days fits Guru 2 (14 days) but not Master (30 days)
+	assert.Equal(t, secondReview.AddDate(0, 0, 15), second.NextReviewDate)
+	assert.InDelta(t, 14.808100506496405, second.Memory.Stability, fsrsTolerance)
+
+	failed, err := scheduler.Schedule(api.ScheduleInput{
+		Stage:          first.Stage,
+		Success:        false,
+		IncorrectCount: 2,
+		ReviewDate:     secondReview,
+		Stages:         testStages,
+		Memory:         first.Memory,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, failed.Stage) // a one day interval maps to Apprentice 3
+	assert.Equal(t, secondReview.AddDate(0, 0, 1), failed.NextReviewDate)
+}
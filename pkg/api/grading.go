@@ -0,0 +1,155 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// GradeAnswer checks a typed answer against the card. Answers are compared after
+// Unicode normalization and case folding; an answer that only differs in accents is
+// reported as MissingAccent, and translations additionally tolerate small typos.
+func GradeAnswer(card Card, answer Answer) (Grade, error) {
+	expected, err := expectedAnswers(card, answer)
+	if err != nil {
+		return Grade{}, err
+	}
+
+	grade := Grade{Verdict: Incorrect, Expected: expected}
+	allowTypos := answer.QuestionType == TranslationQuestion
+
+	for _, candidate := range expected {
+		verdict := gradeAgainst(answer.Answer, candidate, allowTypos, card.WordType == string(Verb))
+		if verdict.betterThan(grade.Verdict) {
+			grade.Verdict = verdict
+			grade.Matched = candidate
+		}
+	}
+	grade.Correct = grade.Verdict != Incorrect
+
+	return grade, nil
+}
+
+func expectedAnswers(card Card, answer Answer) ([]string, error) {
+	switch answer.QuestionType {
+	case TranslationQuestion:
+		if len(card.Translation) == 0 {
+			return nil, fmt.Errorf("%w: card %d has no translations", ErrInvalidQuestion, card.CardId)
+		}
+		return card.Translation, nil
+	case FormQuestion:
+		forms, ok := card.Forms[answer.Form]
+		if !ok || answer.FormIndex >= len(forms) {
+			return nil, fmt.Errorf("%w: card %d has no form %q at index %d", ErrInvalidQuestion, card.CardId, answer.Form, answer.FormIndex)
+		}
+		return []string{forms[answer.FormIndex]}, nil
+	case GenderQuestion:
+		if card.Gender == "" {
+			return nil, fmt.Errorf("%w: card %d has no gender", ErrInvalidQuestion, card.CardId)
+		}
+		return genderSpellings[card.Gender], nil
+	}
+	return nil, fmt.Errorf("%w: unknown question type %q", ErrInvalidQuestion, answer.QuestionType)
+}
+
+var genderSpellings = map[string][]string{
+	string(Masc): {"m", "masculine", "masculin", "le"},
+	string(Fem):  {"f", "feminine", "féminin", "la"},
+}
+
+func gradeAgainst(answer string, expected string, allowTypos bool, isVerb bool) Verdict {
+	a, e := normalizeAnswer(answer), normalizeAnswer(expected)
+	if isVerb {
+		// "eat" is as good as "to eat" for a verb translation
+		a, e = strings.TrimPrefix(a, "to "), strings.TrimPrefix(e, "to ")
+	}
+	if a == "" {
+		return Incorrect
+	}
+	if a == e {
+		return Correct
+	}
+
+	a, e = foldAccents(a), foldAccents(e)
+	if a == e {
+		return MissingAccent
+	}
+
+	if allowTypos && Levenshtein(a, e) <= typoTolerance(e) {
+		return Typo
+	}
+	return Incorrect
+}
+
+// normalizeAnswer puts answers in NFC form, lowercases them and collapses whitespace
+// so that visually identical strings compare equal.
+func normalizeAnswer(s string) string {
+	s = norm.NFC.String(s)
+	s = strings.ToLower(s)
+	s = strings.NewReplacer("’", "'", "‘", "'").Replace(s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+var accentRemover = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// foldAccents strips diacritics and expands ligatures, e.g. "œuf" and "oeuf" or
+// "élève" and "eleve" fold to the same string.
+func foldAccents(s string) string {
+	folded, _, err := transform.String(accentRemover, s)
+	if err != nil {
+		folded = s
+	}
+	return strings.NewReplacer("œ", "oe", "æ", "ae").Replace(folded)
+}
+
+// typoTolerance is the number of edits accepted as a typo for an expected answer:
+// none for very short words, where one edit is often a different word.
+func typoTolerance(expected string) int {
+	length := len([]rune(expected))
+	switch {
+	case length < 4:
+		return 0
+	case length < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Levenshtein returns the edit distance between two strings, counted in runes.
+func Levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+func (v Verdict) betterThan(other Verdict) bool {
+	return verdictRank[v] > verdictRank[other]
+}
+
+var verdictRank = map[Verdict]int{
+	Incorrect:     0,
+	Typo:          1,
+	MissingAccent: 2,
+	Correct:       3,
+}
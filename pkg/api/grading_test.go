@@ -0,0 +1,172 @@
+package api_test
+
+import (
+	"crabigateur-api/pkg/api"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{a: "", b: "", expected: 0},
+		{a: "chat", b: "", expected: 4},
+		{a: "chat", b: "chat", expected: 0},
+		{a: "house", b: "hous", expected: 1},
+		{a: "kitten", b: "sitting", expected: 3},
+		{a: "élève", b: "eleve", expected: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+			assert.Equal(t, tt.expected, api.Levenshtein(tt.a, tt.b))
+		})
+	}
+}
+
+func TestGradeAnswer(t *testing.T) {
+	noun := api.Card{CardId: 1, WordType: "regular", Word: "élève", Gender: "m", Translation: []string{"student", "pupil"}}
+	egg := api.Card{CardId: 2, WordType: "regular", Word: "œuf", Gender: "m", Translation: []string{"egg"}}
+	adjective := api.Card{CardId: 3, WordType: "irregular", Word: "beau", Translation: []string{"beautiful"},
+		Forms: map[string][]string{"m.s.": {"beau"}, "f.s.": {"belle"}, "m.p.": {"beaux"}, "f.p.": {"belles"}}}
+	verb := api.Card{CardId: 4, WordType: "verb", Word: "préférer", Translation: []string{"to prefer"},
+		Forms: map[string][]string{"présent": {"préfère", "préfères", "préfère", "préférons", "préférez", "préfèrent"}}}
+
+	tests := []struct {
+		name            string
+		card            api.Card
+		answer          api.Answer
+		expectedVerdict api.Verdict
+		expectedCorrect bool
+		expectErr       bool
+	}{
+		{
+			name:            "Exact translation",
+			card:            noun,
+			answer:          api.Answer{QuestionType: api.TranslationQuestion, Answer: "pupil"},
+			expectedVerdict: api.Correct,
+			expectedCorrect: true,
+		},
+		{
+			name:            "Translation ignores case and spacing",
+			card:            noun,
+			answer:          api.Answer{QuestionType: api.TranslationQuestion, Answer: "  Student "},
+			expectedVerdict: api.Correct,
+			expectedCorrect: true,
+		},
+		{
+			name:            "Translation with a typo",
+			card:            noun,
+			answer:          api.Answer{QuestionType: api.TranslationQuestion, Answer: "studnet"},
+			expectedVerdict: api.Incorrect, // a swap costs two edits, above the tolerance for 7 letters
+			expectedCorrect: false,
+		},
+		{
+			name:            "Translation with a missing letter",
+			card:            noun,
+			answer:          api.Answer{QuestionType: api.TranslationQuestion, Answer: "studen"},
+			expectedVerdict: api.Typo,
+			expectedCorrect: true,
+		},
+		{
+			name:            "Short translations allow no typo",
+			card:            egg,
+			answer:          api.Answer{QuestionType: api.TranslationQuestion, Answer: "eg"},
+			expectedVerdict: api.Incorrect,
+			expectedCorrect: false,
+		},
+		{
+			name:            "Verb translation without to",
+			card:            verb,
+			answer:          api.Answer{QuestionType: api.TranslationQuestion, Answer: "prefer"},
+			expectedVerdict: api.Correct,
+			expectedCorrect: true,
+		},
+		{
+			name:            "Wrong translation",
+			card:            noun,
+			answer:          api.Answer{QuestionType: api.TranslationQuestion, Answer: "teacher"},
+			expectedVerdict: api.Incorrect,
+			expectedCorrect: false,
+		},
+		{
+			name:            "Irregular form",
+			card:            adjective,
+			answer:          api.Answer{QuestionType: api.FormQuestion, Form: "f.p.", Answer: "belles"},
+			expectedVerdict: api.Correct,
+			expectedCorrect: true,
+		},
+		{
+			name:            "Forms allow no typo",
+			card:            adjective,
+			answer:          api.Answer{QuestionType: api.FormQuestion, Form: "f.p.", Answer: "belle"},
+			expectedVerdict: api.Incorrect,
+			expectedCorrect: false,
+		},
+		{
+			name:            "Conjugation with accents",
+			card:            verb,
+			answer:          api.Answer{QuestionType: api.FormQuestion, Form: "présent", FormIndex: 5, Answer: "préfèrent"},
+			expectedVerdict: api.Correct,
+			expectedCorrect: true,
+		},
+		{
+			name:            "Conjugation missing accents",
+			card:            verb,
+			answer:          api.Answer{QuestionType: api.FormQuestion, Form: "présent", FormIndex: 5, Answer: "preferent"},
+			expectedVerdict: api.MissingAccent,
+			expectedCorrect: true,
+		},
+		{
+			name:            "Decomposed accents are normalized",
+			card:            verb,
+			answer:          api.Answer{QuestionType: api.FormQuestion, Form: "présent", FormIndex: 0, Answer: "pre\u0301fe\u0300re"},
+			expectedVerdict: api.Correct,
+			expectedCorrect: true,
+		},
+		{
+			name:            "Gender",
+			card:            noun,
+			answer:          api.Answer{QuestionType: api.GenderQuestion, Answer: "Masculin"},
+			expectedVerdict: api.Correct,
+			expectedCorrect: true,
+		},
+		{
+			name:            "Wrong gender",
+			card:            noun,
+			answer:          api.Answer{QuestionType: api.GenderQuestion, Answer: "f"},
+			expectedVerdict: api.Incorrect,
+			expectedCorrect: false,
+		},
+		{
+			name:      "Unknown form",
+			card:      adjective,
+			answer:    api.Answer{QuestionType: api.FormQuestion, Form: "imparfait", Answer: "belle"},
+			expectErr: true,
+		},
+		{
+			name:      "Gender of a card without gender",
+			card:      verb,
+			answer:    api.Answer{QuestionType: api.GenderQuestion, Answer: "m"},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grade, err := api.GradeAnswer(tt.card, tt.answer)
+
+			if tt.expectErr {
+				assert.ErrorIs(t, err, api.ErrInvalidQuestion)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedVerdict, grade.Verdict)
+			assert.Equal(t, tt.expectedCorrect, grade.Correct)
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultCheckTimeout bounds each readiness check, so a hanging database
+// fails the probe instead of piling up requests
+const DefaultCheckTimeout = 2 * time.Second
+
+type CheckStatus string
+
+const (
+	CheckOk   CheckStatus = "ok"
+	CheckFail CheckStatus = "fail"
+)
+
+type CheckResult struct {
+	Status    CheckStatus `json:"status"`
+	LatencyMs int64       `json:"latency_ms"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// Readiness is the result of every check, keyed by check name. Ready only when
+// all of them passed.
+type Readiness struct {
+	Ready  bool                   `json:"ready"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+type HealthService interface {
+	Readiness(ctx context.Context) Readiness
+}
+
+type HealthRepository interface {
+	Ping(ctx context.Context) error
+	GetSRSStages(ctx context.Context) (StageTable, error)
+}
+
+// SchemaVersion tells the version the database schema is at and the one the
+// server expects, as migrations.Migrator does
+type SchemaVersion interface {
+	Version(ctx context.Context) (int, error)
+	Latest() int
+}
+
+type healthService struct {
+	storage HealthRepository
+	schema  SchemaVersion
+	timeout time.Duration
+	logger  *slog.Logger
+}
+
+func NewHealthService(healthRepo HealthRepository, schema SchemaVersion, timeout time.Duration, logger *slog.Logger) HealthService {
+	return &healthService{
+		storage: healthRepo,
+		schema:  schema,
+		timeout: timeout,
+		logger:  logger,
+	}
+}
+
+// Readiness runs the checks concurrently. Their errors are logged, the result
+// only tells what is wrong without the details of the failure.
+func (h *healthService) Readiness(ctx context.Context) Readiness {
+	checks := map[string]func(ctx context.Context) (string, error){
+		"database":   h.checkDatabase,
+		"migrations": h.checkMigrations,
+		"srs_stages": h.checkStages,
+	}
+
+	readiness := Readiness{Ready: true, Checks: make(map[string]CheckResult, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, h.timeout)
+			defer cancel()
+
+			start := time.Now()
+			message, err := check(checkCtx)
+			result := CheckResult{Status: CheckOk, LatencyMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				h.logger.WarnContext(ctx, "service - readiness check failed", "check", name, "error", err)
+				result.Status = CheckFail
+				result.Error = message
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			readiness.Checks[name] = result
+			if err != nil {
+				readiness.Ready = false
+			}
+		}()
+	}
+	wg.Wait()
+
+	return readiness
+}
+
+func (h *healthService) checkDatabase(ctx context.Context) (string, error) {
+	if err := h.storage.Ping(ctx); err != nil {
+		return "Database unreachable", err
+	}
+	return "", nil
+}
+
+func (h *healthService) checkMigrations(ctx context.Context) (string, error) {
+	version, err := h.schema.Version(ctx)
+	if err != nil {
+		return "Schema version unavailable", err
+	}
+	if latest := h.schema.Latest(); version != latest {
+		message := fmt.Sprintf("Schema at version %d, expected %d", version, latest)
+		return message, errors.New(message)
+	}
+	return "", nil
+}
+
+func (h *healthService) checkStages(ctx context.Context) (string, error) {
+	stages, err := h.storage.GetSRSStages(ctx)
+	if err != nil {
+		return "SRS stages unavailable", err
+	}
+	if len(stages) == 0 {
+		return "No SRS stages, the database is not seeded", errors.New("SRSStages is empty")
+	}
+	return "", nil
+}
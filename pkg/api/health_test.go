@@ -0,0 +1,103 @@
+package api_test
+
+import (
+	"context"
+	"crabigateur-api/pkg/api"
+	"crabigateur-api/pkg/logging"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stubHealthRepository struct {
+	pingErr   error
+	stages    api.StageTable
+	stagesErr error
+	delay     time.Duration
+}
+
+func (s *stubHealthRepository) Ping(ctx context.Context) error {
+	select {
+	case <-time.After(s.delay):
+		return s.pingErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *stubHealthRepository) GetSRSStages(ctx context.Context) (api.StageTable, error) {
+	return s.stages, s.stagesErr
+}
+
+type stubSchema struct {
+	version int
+	latest  int
+}
+
+func (s stubSchema) Version(ctx context.Context) (int, error) { return s.version, nil }
+func (s stubSchema) Latest() int                              { return s.latest }
+
+func TestHealthService_Readiness(t *testing.T) {
+	stages := api.StageTable{{StageId: 1, Name: "Lesson"}}
+
+	tests := []struct {
+		name     string
+		storage  *stubHealthRepository
+		schema   stubSchema
+		expected map[string]api.CheckStatus
+		errors   map[string]string
+	}{
+		{
+			name:     "All checks pass",
+			storage:  &stubHealthRepository{stages: stages},
+			schema:   stubSchema{version: 4, latest: 4},
+			expected: map[string]api.CheckStatus{"database": api.CheckOk, "migrations": api.CheckOk, "srs_stages": api.CheckOk},
+		},
+		{
+			name:     "Database down",
+			storage:  &stubHealthRepository{pingErr: errors.New("connection refused"), stagesErr: errors.New("connection refused")},
+			schema:   stubSchema{version: 4, latest: 4},
+			expected: map[string]api.CheckStatus{"database": api.CheckFail, "migrations": api.CheckOk, "srs_stages": api.CheckFail},
+			errors:   map[string]string{"database": "Database unreachable", "srs_stages": "SRS stages unavailable"},
+		},
+		{
+			name:     "Database too slow",
+			storage:  &stubHealthRepository{stages: stages, delay: time.Second},
+			schema:   stubSchema{version: 4, latest: 4},
+			expected: map[string]api.CheckStatus{"database": api.CheckFail, "migrations": api.CheckOk, "srs_stages": api.CheckOk},
+			errors:   map[string]string{"database": "Database unreachable"},
+		},
+		{
+			name:     "Pending migrations",
+			storage:  &stubHealthRepository{stages: stages},
+			schema:   stubSchema{version: 3, latest: 4},
+			expected: map[string]api.CheckStatus{"database": api.CheckOk, "migrations": api.CheckFail, "srs_stages": api.CheckOk},
+			errors:   map[string]string{"migrations": "Schema at version 3, expected 4"},
+		},
+		{
+			name:     "Stages not seeded",
+			storage:  &stubHealthRepository{},
+			schema:   stubSchema{version: 4, latest: 4},
+			expected: map[string]api.CheckStatus{"database": api.CheckOk, "migrations": api.CheckOk, "srs_stages": api.CheckFail},
+			errors:   map[string]string{"srs_stages": "No SRS stages, the database is not seeded"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := api.NewHealthService(tt.storage, tt.schema, 50*time.Millisecond, logging.Discard())
+			readiness := service.Readiness(context.Background())
+
+			ready := true
+			for name, status := range tt.expected {
+				assert.Equal(t, status, readiness.Checks[name].Status, name)
+				assert.Equal(t, tt.errors[name], readiness.Checks[name].Error, name)
+				ready = ready && status == api.CheckOk
+			}
+			assert.Len(t, readiness.Checks, len(tt.expected))
+			assert.Equal(t, ready, readiness.Ready)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"errors"
+)
+
+type ImportStatus string
+
+const (
+	ImportCreated  ImportStatus = "created"
+	ImportUpdated  ImportStatus = "updated"
+	ImportRejected ImportStatus = "rejected"
+)
+
+type ImportResult struct {
+	Index  int          `json:"index"` // position of the card in the submitted list
+	Word   string       `json:"word"`
+	Gender string       `json:"gender,omitempty"`
+	Status ImportStatus `json:"status"`
+	CardId int          `json:"card_id,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+type ImportReport struct {
+	DryRun   bool           `json:"dry_run"`
+	Created  int            `json:"created"`
+	Updated  int            `json:"updated"`
+	Rejected int            `json:"rejected"`
+	Results  []ImportResult `json:"results"`
+}
+
+// errDryRun rolls back the transaction of a dry run once every card is imported
+var errDryRun = errors.New("dry run")
+
+// ImportCards creates the cards whose word and gender, the key of
+// unique_word_gender, are new and updates the others, in a single transaction.
+// A card failing validation or storage is rejected without stopping the
+// import. A dry run reports the same results and rolls everything back.
+func (u *cardService) ImportCards(ctx context.Context, cards []Card, dryRun bool) (ImportReport, error) {
+	report := ImportReport{DryRun: dryRun, Results: make([]ImportResult, len(cards))}
+
+	err := u.storage.WithCardTx(ctx, func(tx CardRepository) error {
+		for i, card := range cards {
+			result := ImportResult{Index: i, Word: card.Word, Gender: card.Gender}
+
+			err := tx.WithCardTx(ctx, func(item CardRepository) error {
+				var err error
+				result.Status, result.CardId, err = importCard(ctx, item, card)
+				return err
+			})
+			if err != nil {
+				u.logger.WarnContext(ctx, "service - card import rejected", "index", i, "word", card.Word, "error", err)
+				result.Status = ImportRejected
+				result.CardId = 0
+				result.Error = importErrorMessage(err)
+			}
+
+			switch result.Status {
+			case ImportCreated:
+				report.Created++
+			case ImportUpdated:
+				report.Updated++
+			case ImportRejected:
+				report.Rejected++
+			}
+			report.Results[i] = result
+		}
+
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return ImportReport{}, err
+	}
+
+	return report, nil
+}
+
+func importCard(ctx context.Context, storage CardRepository, card Card) (ImportStatus, int, error) {
+	if err := ValidateCard(card); err != nil {
+		return ImportRejected, 0, err
+	}
+
+	cardId, exists, err := storage.FindCardId(ctx, card.Word, card.Gender)
+	if err != nil {
+		return ImportRejected, 0, err
+	}
+
+	if exists {
+		card.CardId = cardId
+		if err := storage.UpdateCard(ctx, cardId, card.Word, card.Translation, card.WordType, card.Gender, card.Level); err != nil {
+			return ImportRejected, 0, err
+		}
+		return ImportUpdated, cardId, processCardForms(ctx, storage, true, card)
+	}
+
+	cardId, err = storage.InsertCard(ctx, card.Word, card.Translation, card.WordType, card.Gender, card.Level)
+	if err != nil {
+		return ImportRejected, 0, err
+	}
+	card.CardId = cardId
+	return ImportCreated, cardId, processCardForms(ctx, storage, false, card)
+}
+
+// importErrorMessage tells the client why a card was rejected: validation
+// failures and known errors are shown, unexpected errors are not
+func importErrorMessage(err error) string {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Message
+	}
+	if errors.Is(err, ErrValidation) {
+		return err.Error()
+	}
+	return "Card could not be imported"
+}
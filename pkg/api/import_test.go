@@ -0,0 +1,160 @@
+package api_test
+
+import (
+	"context"
+	"crabigateur-api/pkg/api"
+	"crabigateur-api/pkg/logging"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// Mock for CardRepository
+type MockCardRepository struct {
+	mock.Mock
+}
+
+// WithCardTx runs fn directly against the mock, transactions are covered by the repository tests
+func (m *MockCardRepository) WithCardTx(ctx context.Context, fn func(api.CardRepository) error) error {
+	return fn(m)
+}
+
+func (m *MockCardRepository) GetCard(ctx context.Context, id int) (api.Card, error) {
+	args := m.Called(id)
+	return args.Get(0).(api.Card), args.Error(1)
+}
+
+func (m *MockCardRepository) FindCardId(ctx context.Context, word string, gender string) (int, bool, error) {
+	args := m.Called(word, gender)
+	return args.Int(0), args.Bool(1), args.Error(2)
+}
+
+func (m *MockCardRepository) InsertCard(ctx context.Context, word string, translation []string, wordType string, gender string, level int) (int, error) {
+	args := m.Called(word, translation, wordType, gender, level)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockCardRepository) UpdateCard(ctx context.Context, cardId int, word string, translation []string, wordType string, gender string, level int) error {
+	args := m.Called(cardId, word, translation, wordType, gender, level)
+	return args.Error(0)
+}
+
+func (m *MockCardRepository) InsertOrUpdateConjugation(ctx context.Context, isUpdate bool, cardId int, tense string, forms []string, isIrregular bool) error {
+	args := m.Called(isUpdate, cardId, tense, forms, isIrregular)
+	return args.Error(0)
+}
+
+func (m *MockCardRepository) InsertOrUpdateForm(ctx context.Context, isUpdate bool, cardId int, gender string, number string, form string) error {
+	args := m.Called(isUpdate, cardId, gender, number, form)
+	return args.Error(0)
+}
+
+func (m *MockCardRepository) DeleteCard(ctx context.Context, cardId int) error {
+	args := m.Called(cardId)
+	return args.Error(0)
+}
+
+func (m *MockCardRepository) SearchCards(ctx context.Context, query api.CardQueryParams) ([]api.Card, error) {
+	args := m.Called(query)
+	return args.Get(0).([]api.Card), args.Error(1)
+}
+
+func (m *MockCardRepository) ExportCards(ctx context.Context, fn func(api.Card) error) error {
+	args := m.Called()
+	for _, card := range args.Get(0).([]api.Card) {
+		if err := fn(card); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockCardRepository) GetTenses(ctx context.Context) ([]string, error) {
+	args := m.Called()
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func TestCardService_ImportCards(t *testing.T) {
+	chat := api.Card{Level: 1, Word: "chat", WordType: "regular", Gender: "m", Translation: []string{"cat"}}
+	parler := api.Card{Level: 1, Word: "parler", WordType: "verb", Translation: []string{"to speak"},
+		Forms: map[string][]string{"présent": {"parle", "parles", "parle", "parlons", "parlez", "parlent"}}}
+	invalid := api.Card{Level: 1, Word: "chien", WordType: "animal", Gender: "m"}
+
+	tests := []struct {
+		name      string
+		cards     []api.Card
+		dryRun    bool
+		mockSetup func(m *MockCardRepository)
+		expected  api.ImportReport
+	}{
+		{
+			name:  "Creates new cards and updates existing ones",
+			cards: []api.Card{chat, parler},
+			mockSetup: func(m *MockCardRepository) {
+				m.On("FindCardId", "chat", "m").Return(0, false, nil)
+				m.On("InsertCard", "chat", []string{"cat"}, "regular", "m", 1).Return(9, nil)
+				m.On("FindCardId", "parler", "").Return(3, true, nil)
+				m.On("UpdateCard", 3, "parler", []string{"to speak"}, "verb", "", 1).Return(nil)
+				m.On("InsertOrUpdateConjugation", true, 3, "présent", parler.Forms["présent"], false).Return(nil)
+			},
+			expected: api.ImportReport{Created: 1, Updated: 1, Results: []api.ImportResult{
+				{Index: 0, Word: "chat", Gender: "m", Status: api.ImportCreated, CardId: 9},
+				{Index: 1, Word: "parler", Status: api.ImportUpdated, CardId: 3},
+			}},
+		},
+		{
+			name:  "Rejected cards do not stop the import",
+			cards: []api.Card{invalid, chat},
+			mockSetup: func(m *MockCardRepository) {
+				m.On("FindCardId", "chat", "m").Return(0, false, nil)
+				m.On("InsertCard", "chat", []string{"cat"}, "regular", "m", 1).Return(9, nil)
+			},
+			expected: api.ImportReport{Created: 1, Rejected: 1, Results: []api.ImportResult{
+				{Index: 0, Word: "chien", Gender: "m", Status: api.ImportRejected,
+					Error: "validation failed: Key: 'Card.WordType' Error:Field validation for 'WordType' failed on the 'wordtypevalid' tag"},
+				{Index: 1, Word: "chat", Gender: "m", Status: api.ImportCreated, CardId: 9},
+			}},
+		},
+		{
+			name:  "Storage failures reject the card without leaking details",
+			cards: []api.Card{parler},
+			mockSetup: func(m *MockCardRepository) {
+				m.On("FindCardId", "parler", "").Return(0, false, nil)
+				m.On("InsertCard", "parler", []string{"to speak"}, "verb", "", 1).Return(4, nil)
+				m.On("InsertOrUpdateConjugation", false, 4, "présent", parler.Forms["présent"], false).
+					Return(errors.New("storage - ConjugationsInsert: pq: connection reset"))
+			},
+			expected: api.ImportReport{Rejected: 1, Results: []api.ImportResult{
+				{Index: 0, Word: "parler", Status: api.ImportRejected, Error: "Card could not be imported"},
+			}},
+		},
+		{
+			name:   "Dry run reports without failing",
+			cards:  []api.Card{chat},
+			dryRun: true,
+			mockSetup: func(m *MockCardRepository) {
+				m.On("FindCardId", "chat", "m").Return(0, false, nil)
+				m.On("InsertCard", "chat", []string{"cat"}, "regular", "m", 1).Return(9, nil)
+			},
+			expected: api.ImportReport{DryRun: true, Created: 1, Results: []api.ImportResult{
+				{Index: 0, Word: "chat", Gender: "m", Status: api.ImportCreated, CardId: 9},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockCardRepository)
+			tt.mockSetup(mockRepo)
+
+			service := api.NewCardService(mockRepo, logging.Discard())
+			report, err := service.ImportCards(context.Background(), tt.cards, tt.dryRun)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, report)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
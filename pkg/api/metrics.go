@@ -0,0 +1,31 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	reviewsSubmitted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "crabi_reviews_total",
+		Help: "Reviews applied, by whether the card was recalled.",
+	}, []string{"success"})
+	lessonsStarted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "crabi_lessons_started_total",
+		Help: "Cards learnt in a lesson, entering the review queue.",
+	})
+	levelUps = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "crabi_level_ups_total",
+		Help: "Users promoted to the next level.",
+	})
+)
+
+// recordReview counts a review once the transaction storing it is committed
+func recordReview(success bool, levelUp *LevelUpEvent) {
+	reviewsSubmitted.WithLabelValues(strconv.FormatBool(success)).Inc()
+	if levelUp != nil {
+		levelUps.Inc()
+	}
+}
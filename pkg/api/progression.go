@@ -0,0 +1,42 @@
+package api
+
+import "fmt"
+
+// LevelProgression decides when a learner has mastered enough of their
+// current level to be promoted to the next one.
+type LevelProgression struct {
+	Fraction float64 // share of the level's cards that must reach Stage, in (0, 1]
+	Stage    int     // SRS stage a card must reach to count towards the fraction
+}
+
+var DefaultLevelProgression = LevelProgression{
+	Fraction: 0.9,
+	Stage:    5,
+}
+
+func (p LevelProgression) Validate() error {
+	if p.Fraction <= 0 || p.Fraction > 1 {
+		return fmt.Errorf("level progression fraction must be in (0, 1], got %v", p.Fraction)
+	}
+	if p.Stage < 1 || p.Stage > 9 {
+		return fmt.Errorf("level progression stage must be between 1 and 9, got %d", p.Stage)
+	}
+	return nil
+}
+
+// ShouldLevelUp reports whether the cards of the current level are advanced enough
+// for a promotion. A level without cards never promotes.
+func (p LevelProgression) ShouldLevelUp(progress []CardProgress) bool {
+	if len(progress) == 0 {
+		return false
+	}
+
+	reached := 0
+	for _, card := range progress {
+		if card.StageId >= p.Stage {
+			reached++
+		}
+	}
+
+	return float64(reached) >= p.Fraction*float64(len(progress))
+}
@@ -0,0 +1,64 @@
+package api_test
+
+import (
+	"crabigateur-api/pkg/api"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelProgression_ShouldLevelUp(t *testing.T) {
+	progression := api.LevelProgression{Fraction: 0.9, Stage: 5}
+
+	stages := func(ids ...int) []api.CardProgress {
+		progress := make([]api.CardProgress, len(ids))
+		for i, stage := range ids {
+			progress[i] = api.CardProgress{CardId: i + 1, StageId: stage}
+		}
+		return progress
+	}
+
+	tests := []struct {
+		name     string
+		progress []api.CardProgress
+		expected bool
+	}{
+		{name: "No cards on level", progress: nil, expected: false},
+		{name: "All cards at threshold", progress: stages(5, 5, 5), expected: true},
+		{name: "All cards above threshold", progress: stages(6, 8, 9), expected: true},
+		{name: "Exactly 90 percent", progress: stages(5, 5, 5, 5, 5, 5, 5, 5, 5, 0), expected: true},
+		{name: "Below 90 percent", progress: stages(5, 5, 5, 5, 5, 5, 5, 5, 4, 0), expected: false},
+		{name: "Lessons not started", progress: stages(0, 0, 0), expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, progression.ShouldLevelUp(tt.progress))
+		})
+	}
+}
+
+func TestLevelProgression_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		progression api.LevelProgression
+		expectErr   bool
+	}{
+		{name: "Default", progression: api.DefaultLevelProgression, expectErr: false},
+		{name: "Whole level", progression: api.LevelProgression{Fraction: 1, Stage: 9}, expectErr: false},
+		{name: "Zero fraction", progression: api.LevelProgression{Fraction: 0, Stage: 5}, expectErr: true},
+		{name: "Fraction above one", progression: api.LevelProgression{Fraction: 1.5, Stage: 5}, expectErr: true},
+		{name: "Stage out of range", progression: api.LevelProgression{Fraction: 0.9, Stage: 10}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.progression.Validate()
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+// Role is what a user may do besides studying their own deck. Every account
+// starts as a learner; editors maintain the cards and admins manage roles.
+type Role string
+
+const (
+	Learner Role = "learner"
+	Editor  Role = "editor"
+	Admin   Role = "admin"
+)
+
+type Permission string
+
+const (
+	CardsWrite  Permission = "cards:write"
+	RolesManage Permission = "roles:manage"
+	KeysManage  Permission = "keys:manage"
+	// StatsRead lets a backend service read any learner's stats. No role
+	// grants it, learners always see their own stats.
+	StatsRead Permission = "stats:read"
+)
+
+var rolePermissions = map[Role][]Permission{
+	Learner: {},
+	Editor:  {CardsWrite},
+	Admin:   {CardsWrite, RolesManage, KeysManage},
+}
+
+func (r Role) IsValid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can reports whether the role grants permission
+func (r Role) Can(permission Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+type RoleUpdate struct {
+	Role Role `json:"role" binding:"required,oneof=learner editor admin"`
+}
+
+type RoleQueryParams struct {
+	Role Role `form:"role" binding:"required,oneof=learner editor admin"`
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"fmt"
+	"time"
+)
+
+// Scheduler computes where a card goes after a review: its new SRS stage
+// and the date it should be reviewed again.
+type Scheduler interface {
+	Schedule(input ScheduleInput) (ScheduleResult, error)
+}
+
+type SchedulerType string
+
+const (
+	PenaltyStages SchedulerType = "stages"
+	FSRS          SchedulerType = "fsrs"
+)
+
+// DefaultSchedulers returns every scheduler a user can pick, with default settings.
+func DefaultSchedulers() map[SchedulerType]Scheduler {
+	return map[SchedulerType]Scheduler{
+		PenaltyStages: NewPenaltyScheduler(),
+		FSRS:          NewFSRSScheduler(DefaultFSRSParameters),
+	}
+}
+
+type ScheduleInput struct {
+	Stage          int       // stage of the card before the review, 0 for a finished lesson
+	Success        bool      // whether the card was answered correctly
+	IncorrectCount int       // wrong answers given before the review was settled
+	ReviewDate     time.Time // moment the review happened
+	Stages         StageTable
+	Memory         MemoryState
+}
+
+type ScheduleResult struct {
+	Stage          int
+	NextReviewDate time.Time // zero when the card is never reviewed again
+	Memory         MemoryState
+}
+
+// MemoryState is the per-card state kept for FSRS. A zero Stability means
+// the card was never scheduled by FSRS.
+type MemoryState struct {
+	Difficulty     float64
+	Stability      float64
+	Retrievability float64
+	LastReview     time.Time
+}
+
+// CardStatus is what a scheduler needs to know about a user's card before a review.
+type CardStatus struct {
+	Stage     int
+	Scheduler SchedulerType
+	Memory    MemoryState
+}
+
+type SRSStage struct {
+	StageId  int
+	Name     string
+	Interval time.Duration
+	Penalty  int
+}
+
+// StageTable holds the rows of SRSStages ordered by stage id.
+type StageTable []SRSStage
+
+// DefaultStages is the stage table installed by the seed command. The last
+// stage has no interval: burned cards are never reviewed again.
+var DefaultStages = StageTable{
+	{StageId: 1, Name: "Apprentice 1", Interval: 4 * time.Hour, Penalty: 1},
+	{StageId: 2, Name: "Apprentice 2", Interval: 8 * time.Hour, Penalty: 1},
+	{StageId: 3, Name: "Apprentice 3", Interval: 24 * time.Hour, Penalty: 1},
+	{StageId: 4, Name: "Apprentice 4", Interval: 48 * time.Hour, Penalty: 1},
+	{StageId: 5, Name: "Guru 1", Interval: 7 * 24 * time.Hour, Penalty: 2},
+	{StageId: 6, Name: "Guru 2", Interval: 14 * 24 * time.Hour, Penalty: 2},
+	{StageId: 7, Name: "Master", Interval: 30 * 24 * time.Hour, Penalty: 2},
+	{StageId: 8, Name: "Enlightened", Interval: 120 * 24 * time.Hour, Penalty: 2},
+	{StageId: 9, Name: "Burned", Interval: 0, Penalty: 0},
+}
+
+func (t StageTable) Get(stageId int) (SRSStage, bool) {
+	for _, stage := range t {
+		if stage.StageId == stageId {
+			return stage, true
+		}
+	}
+	return SRSStage{}, false
+}
+
+func (t StageTable) Max() int {
+	max := 0
+	for _, stage := range t {
+		if stage.StageId > max {
+			max = stage.StageId
+		}
+	}
+	return max
+}
+
+type penaltyScheduler struct{}
+
+// NewPenaltyScheduler returns the default scheduler: a successful review moves the
+// card one stage up, a failed one moves it down by the current stage's penalty for
+// every two incorrect answers (rounded up), never below stage 1.
+func NewPenaltyScheduler() Scheduler {
+	return &penaltyScheduler{}
+}
+
+func (p *penaltyScheduler) Schedule(input ScheduleInput) (ScheduleResult, error) {
+	var newStage int
+
+	switch {
+	case input.Stage == 0: // lessons always move to the first stage
+		newStage = 1
+	case input.Success:
+		newStage = min(input.Stage+1, input.Stages.Max())
+	default:
+		current, ok := input.Stages.Get(input.Stage)
+		if !ok {
+			return ScheduleResult{}, fmt.Errorf("scheduler - unknown SRS stage %d", input.Stage)
+		}
+		steps := (input.IncorrectCount + 1) / 2
+		newStage = max(1, input.Stage-steps*current.Penalty)
+	}
+
+	stage, ok := input.Stages.Get(newStage)
+	if !ok {
+		return ScheduleResult{}, fmt.Errorf("scheduler - unknown SRS stage %d", newStage)
+	}
+
+	// the FSRS memory is left untouched so it can resume if the user switches back
+	memory := input.Memory
+	memory.LastReview = input.ReviewDate
+
+	result := ScheduleResult{Stage: newStage, Memory: memory}
+	if stage.Interval > 0 { // stages without an interval, e.g. Burned, are never reviewed again
+		result.NextReviewDate = input.ReviewDate.Add(stage.Interval)
+	}
+	return result, nil
+}
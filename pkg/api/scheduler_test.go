@@ -0,0 +1,73 @@
+package api_test
+
+import (
+	"crabigateur-api/pkg/api"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stage table mirroring the default SRSStages rows
+var testStages = api.StageTable{
+	{StageId: 1, Name: "Apprentice 1", Interval: 4 * time.Hour, Penalty: 1},
+	{StageId: 2, Name: "Apprentice 2", Interval: 8 * time.Hour, Penalty: 1},
+	{StageId: 3, Name: "Apprentice 3", Interval: 24 * time.Hour, Penalty: 1},
+	{StageId: 4, Name: "Apprentice 4", Interval: 48 * time.Hour, Penalty: 1},
+	{StageId: 5, Name: "Guru 1", Interval: 7 * 24 * time.Hour, Penalty: 2},
+	{StageId: 6, Name: "Guru 2", Interval: 14 * 24 * time.Hour, Penalty: 2},
+	{StageId: 7, Name: "Master", Interval: 30 * 24 * time.Hour, Penalty: 2},
+	{StageId: 8, Name: "Enlightened", Interval: 120 * 24 * time.Hour, Penalty: 2},
+	{StageId: 9, Name: "Burned", Interval: 0, Penalty: 0},
+}
+
+func TestPenaltyScheduler_Schedule(t *testing.T) {
+	reviewDate := time.Date(2024, 12, 1, 10, 0, 0, 0, time.UTC)
+	scheduler := api.NewPenaltyScheduler()
+
+	tests := []struct {
+		name           string
+		stage          int
+		success        bool
+		incorrectCount int
+		stages         api.StageTable
+		expectedStage  int
+		expectErr      bool
+	}{
+		{name: "Lesson always moves to first stage", stage: 0, success: false, incorrectCount: 3, stages: testStages, expectedStage: 1},
+		{name: "Success moves one stage up", stage: 2, success: true, stages: testStages, expectedStage: 3},
+		{name: "Success on last stage stays there", stage: 9, success: true, stages: testStages, expectedStage: 9},
+		{name: "One mistake costs one penalty", stage: 4, success: false, incorrectCount: 1, stages: testStages, expectedStage: 3},
+		{name: "Two mistakes cost one penalty", stage: 4, success: false, incorrectCount: 2, stages: testStages, expectedStage: 3},
+		{name: "Three mistakes cost two penalties", stage: 4, success: false, incorrectCount: 3, stages: testStages, expectedStage: 2},
+		{name: "Guru penalty is doubled", stage: 6, success: false, incorrectCount: 1, stages: testStages, expectedStage: 4},
+		{name: "Never drops below first stage", stage: 2, success: false, incorrectCount: 8, stages: testStages, expectedStage: 1},
+		{name: "Empty stage table", stage: 0, success: true, stages: api.StageTable{}, expectErr: true},
+		{name: "Unknown current stage", stage: 12, success: false, incorrectCount: 1, stages: testStages, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := scheduler.Schedule(api.ScheduleInput{
+				Stage:          tt.stage,
+				Success:        tt.success,
+				IncorrectCount: tt.incorrectCount,
+				ReviewDate:     reviewDate,
+				Stages:         tt.stages,
+			})
+
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStage, result.Stage)
+			if stage, _ := tt.stages.Get(tt.expectedStage); stage.Interval > 0 {
+				assert.Equal(t, reviewDate.Add(stage.Interval), result.NextReviewDate)
+			} else {
+				assert.True(t, result.NextReviewDate.IsZero(), "burned cards have no next review")
+			}
+		})
+	}
+}
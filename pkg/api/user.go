@@ -1,44 +1,63 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"sort"
 	"strconv"
+	"time"
 )
 
 type UserService interface {
-	LessonCards(userId string, numLessons int) ([]Card, []int, error)
-	ReviewCard(userId string, firstReview bool, sort []SortOrder) (Card, error)
-	AddReviews(userId string, cardId []int) ([]ReviewResult, error)
-	UpdateReview(userId string, review Review) (ReviewResult, error)
-	GetQuizSummary(userId string, numCards int) ([]QuizSummary, error)
-	GetStats(userId string) (map[string]interface{}, error)
+	LessonCards(ctx context.Context, userId string, numLessons int) ([]Card, []int, error)
+	ReviewCard(ctx context.Context, userId string, firstReview bool, sort []SortOrder) (Card, error)
+	AddReviews(ctx context.Context, userId string, cardId []int) ([]ReviewResult, error)
+	UpdateReview(ctx context.Context, userId string, review Review) (ReviewResult, error)
+	UpdateReviews(ctx context.Context, userId string, reviews []Review) ([]BatchReviewResult, error)
+	AnswerReview(ctx context.Context, userId string, answer Answer) (AnswerResult, error)
+	GetQuizSummary(ctx context.Context, userId string, numCards int) ([]QuizSummary, error)
+	GetStats(ctx context.Context, userId string) (map[string]interface{}, error)
 }
 
 type UserRepository interface {
-	GetLessons(userId string, numLessons int) ([]Card, error)
-	GetReview(userId string, firstReview bool, sort []SortOrder) ([]Card, error)
-	InsertReview(userId string, cardId int) (ReviewResult, error)
-	UpdateReview(userId string, reviews Review) (ReviewResult, error)
-	GetMostRecentReviews(userId string, numCards int) ([]ReviewResult, error)
-	CountPendingReviews(userId string) (int, error)
-	GetRecentMistakes(userId string) ([]CardTag, error)
-	GetLevelProgress(userId string) ([]CardProgress, error)
-	GetWordStats(userId string) (map[string]map[string]int, error)
+	WithUserTx(ctx context.Context, fn func(UserRepository) error) error
+	GetLessons(ctx context.Context, userId string, numLessons int) ([]Card, error)
+	GetReview(ctx context.Context, userId string, firstReview bool, sort []SortOrder) ([]Card, error)
+	InsertReview(ctx context.Context, userId string, cardId int) (ReviewResult, error)
+	GetCardStatus(ctx context.Context, userId string, cardId int) (CardStatus, error)
+	GetReviewResult(ctx context.Context, userId string, reviewId string) (ReviewResult, bool, error)
+	GetSRSStages(ctx context.Context) (StageTable, error)
+	UpdateReview(ctx context.Context, userId string, review Review, schedule ScheduleResult) (ReviewResult, error)
+	GetMostRecentReviews(ctx context.Context, userId string, numCards int) ([]ReviewResult, error)
+	CountPendingReviews(ctx context.Context, userId string) (int, error)
+	GetRecentMistakes(ctx context.Context, userId string) ([]CardTag, error)
+	GetLevelProgress(ctx context.Context, userId string) ([]CardProgress, error)
+	GetWordStats(ctx context.Context, userId string) (map[string]map[string]int, error)
+	GetUserLevel(ctx context.Context, userId string) (int, error)
+	PromoteUser(ctx context.Context, userId string, level int) (bool, error)
+	GetCard(ctx context.Context, id int) (Card, error)
 }
 
 type userService struct {
-	storage UserRepository
+	storage     UserRepository
+	progression LevelProgression
+	schedulers  map[SchedulerType]Scheduler
+	logger      *slog.Logger
 }
 
-func NewUserService(userRepo UserRepository) UserService {
+func NewUserService(userRepo UserRepository, progression LevelProgression, schedulers map[SchedulerType]Scheduler, logger *slog.Logger) UserService {
 	return &userService{
-		storage: userRepo,
+		storage:     userRepo,
+		progression: progression,
+		schedulers:  schedulers,
+		logger:      logger,
 	}
 }
 
-func (u *userService) LessonCards(userId string, numLessons int) ([]Card, []int, error) {
-	cards, err := u.storage.GetLessons(userId, numLessons)
+func (u *userService) LessonCards(ctx context.Context, userId string, numLessons int) ([]Card, []int, error) {
+	cards, err := u.storage.GetLessons(ctx, userId, numLessons)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -49,8 +68,8 @@ func (u *userService) LessonCards(userId string, numLessons int) ([]Card, []int,
 	return cards, ids, nil
 }
 
-func (u *userService) ReviewCard(userId string, firstReview bool, sort []SortOrder) (Card, error) {
-	reviews, err := u.storage.GetReview(userId, firstReview, sort)
+func (u *userService) ReviewCard(ctx context.Context, userId string, firstReview bool, sort []SortOrder) (Card, error) {
+	reviews, err := u.storage.GetReview(ctx, userId, firstReview, sort)
 	if err != nil {
 		return Card{}, err
 	}
@@ -60,29 +79,244 @@ func (u *userService) ReviewCard(userId string, firstReview bool, sort []SortOrd
 	return reviews[0], nil
 }
 
-func (u *userService) AddReviews(userId string, cardIds []int) ([]ReviewResult, error) {
+func (u *userService) AddReviews(ctx context.Context, userId string, cardIds []int) ([]ReviewResult, error) {
 	results := []ReviewResult{}
-	for _, cardId := range cardIds {
-		result, err := u.storage.InsertReview(userId, cardId)
-		if err != nil {
-			return nil, err
+	err := u.storage.WithUserTx(ctx, func(tx UserRepository) error {
+		for _, cardId := range cardIds {
+			result, err := tx.InsertReview(ctx, userId, cardId)
+			if err != nil {
+				return err
+			}
+			results = append(results, result)
 		}
-		results = append(results, result)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	lessonsStarted.Add(float64(len(results)))
 	return results, nil
 }
 
-func (u *userService) UpdateReview(userId string, review Review) (ReviewResult, error) {
-	result, err := u.storage.UpdateReview(userId, review)
+func (u *userService) UpdateReview(ctx context.Context, userId string, review Review) (ReviewResult, error) {
+	var result ReviewResult
+	var applied bool
+	err := u.storage.WithUserTx(ctx, func(tx UserRepository) error {
+		var err error
+		result, applied, err = u.updateReview(ctx, tx, userId, review)
+		return err
+	})
 	if err != nil {
 		return ReviewResult{}, err
 	}
-
+	if applied {
+		recordReview(*review.Success, result.LevelUp)
+	}
 	return result, nil
 }
 
-func (u *userService) GetQuizSummary(userId string, numCards int) ([]QuizSummary, error) {
-	reviews, err := u.storage.GetMostRecentReviews(userId, numCards)
+// UpdateReviews applies a whole review session in one transaction, oldest review
+// first. A review that fails is reported in its own result without undoing the others.
+func (u *userService) UpdateReviews(ctx context.Context, userId string, reviews []Review) ([]BatchReviewResult, error) {
+	order := make([]int, len(reviews))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return reviews[order[a]].ReviewDate.Before(reviews[order[b]].ReviewDate)
+	})
+
+	results := make([]BatchReviewResult, len(reviews))
+	applied := make([]bool, len(reviews))
+	err := u.storage.WithUserTx(ctx, func(tx UserRepository) error {
+		for _, i := range order {
+			results[i] = BatchReviewResult{Index: i, CardId: reviews[i].CardId}
+
+			err := tx.WithUserTx(ctx, func(item UserRepository) error {
+				result, itemApplied, err := u.updateReview(ctx, item, userId, reviews[i])
+				if err != nil {
+					return err
+				}
+				results[i].Result = &result
+				applied[i] = itemApplied
+				return nil
+			})
+			if err != nil {
+				u.logger.WarnContext(ctx, "service - batch review failed", "user_id", userId, "index", i, "card_id", reviews[i].CardId, "error", err)
+				results[i].Result = nil
+				results[i].Error = reviewErrorMessage(err)
+				applied[i] = false
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, result := range results {
+		if result.Result != nil && applied[i] {
+			recordReview(*reviews[i].Success, result.Result.LevelUp)
+		}
+	}
+	return results, nil
+}
+
+// reviewErrorMessage tells the client why a review failed, without leaking
+// the details of unexpected errors
+func reviewErrorMessage(err error) string {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Message
+	}
+	return "Review could not be applied"
+}
+
+// updateReview applies review in the transaction of storage, it reports whether
+// the review was stored rather than replayed so that it is only counted once
+func (u *userService) updateReview(ctx context.Context, storage UserRepository, userId string, review Review) (ReviewResult, bool, error) {
+	// locks the card of the user until the transaction ends, so a concurrent retry
+	// of the same review waits here and then finds it below
+	status, err := storage.GetCardStatus(ctx, userId, review.CardId)
+	if err != nil {
+		return ReviewResult{}, false, err
+	}
+
+	if previous, found, err := u.previousReview(ctx, storage, userId, review); err != nil || found {
+		return previous, false, err
+	}
+
+	lastReview := status.Memory.LastReview
+	if !lastReview.IsZero() && review.ReviewDate.Before(lastReview) {
+		return ReviewResult{}, false, fmt.Errorf("%w: card %d was last reviewed at %s", ErrStaleReview, review.CardId, lastReview.Format(time.RFC3339))
+	}
+
+	stages, err := storage.GetSRSStages(ctx)
+	if err != nil {
+		return ReviewResult{}, false, err
+	}
+
+	scheduler, ok := u.schedulers[status.Scheduler]
+	if !ok {
+		scheduler, ok = u.schedulers[PenaltyStages]
+	}
+	if !ok {
+		return ReviewResult{}, false, fmt.Errorf("service - no scheduler available for %q", status.Scheduler)
+	}
+
+	schedule, err := scheduler.Schedule(ScheduleInput{
+		Stage:          status.Stage,
+		Success:        *review.Success,
+		IncorrectCount: *review.IncorrectCount,
+		ReviewDate:     review.ReviewDate,
+		Stages:         stages,
+		Memory:         status.Memory,
+	})
+	if err != nil {
+		return ReviewResult{}, false, err
+	}
+
+	result, err := storage.UpdateReview(ctx, userId, review, schedule)
+	if errors.Is(err, ErrDuplicate) && review.ReviewId != "" {
+		// the same review id was stored for another card in the meantime, whose
+		// lock this one did not wait for
+		if previous, found, lookupErr := u.previousReview(ctx, storage, userId, review); lookupErr != nil || found {
+			return previous, false, lookupErr
+		}
+	}
+	if err != nil {
+		return ReviewResult{}, false, err
+	}
+
+	// the review is already stored at this point, so a failed level check must not
+	// turn it into an error the client would retry. It runs in its own (nested)
+	// transaction so a failing query cannot abort a surrounding one.
+	var levelUp *LevelUpEvent
+	err = storage.WithUserTx(ctx, func(tx UserRepository) error {
+		var checkErr error
+		levelUp, checkErr = u.checkLevelUp(ctx, tx, userId)
+		return checkErr
+	})
+	if err != nil {
+		u.logger.ErrorContext(ctx, "service - level progression", "user_id", userId, "error", err)
+	}
+	result.LevelUp = levelUp
+
+	return result, true, nil
+}
+
+// previousReview finds the result a retried review got when it was first applied.
+// The level up it may have caused is not stored, so a replay never reports it.
+func (u *userService) previousReview(ctx context.Context, storage UserRepository, userId string, review Review) (ReviewResult, bool, error) {
+	if review.ReviewId == "" {
+		return ReviewResult{}, false, nil
+	}
+
+	previous, found, err := storage.GetReviewResult(ctx, userId, review.ReviewId)
+	if err != nil {
+		return ReviewResult{}, false, err
+	} else if found && previous.CardId != review.CardId {
+		return ReviewResult{}, false, fmt.Errorf("%w: %s", ErrReviewIdConflict, review.ReviewId)
+	}
+	return previous, found, nil
+}
+
+func (u *userService) AnswerReview(ctx context.Context, userId string, answer Answer) (AnswerResult, error) {
+	card, err := u.storage.GetCard(ctx, answer.CardId)
+	if err != nil {
+		return AnswerResult{}, err
+	} else if card.IsEmpty() {
+		return AnswerResult{}, fmt.Errorf("%w: %d", ErrCardNotFound, answer.CardId)
+	}
+
+	grade, err := GradeAnswer(card, answer)
+	if err != nil {
+		return AnswerResult{}, err
+	}
+
+	incorrectCount := answer.IncorrectCount
+	if !grade.Correct {
+		incorrectCount++
+	}
+
+	result, err := u.UpdateReview(ctx, userId, Review{
+		ReviewId:       answer.ReviewId,
+		CardId:         answer.CardId,
+		ReviewDate:     answer.ReviewDate,
+		Success:        &grade.Correct,
+		IncorrectCount: &incorrectCount,
+	})
+	if err != nil {
+		return AnswerResult{}, err
+	}
+
+	return AnswerResult{Grade: grade, Review: result}, nil
+}
+
+func (u *userService) checkLevelUp(ctx context.Context, storage UserRepository, userId string) (*LevelUpEvent, error) {
+	level, err := storage.GetUserLevel(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	progress, err := storage.GetLevelProgress(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if !u.progression.ShouldLevelUp(progress) {
+		return nil, nil
+	}
+
+	promoted, err := storage.PromoteUser(ctx, userId, level)
+	if err != nil || !promoted {
+		return nil, err
+	}
+
+	return &LevelUpEvent{PreviousLevel: level, NewLevel: level + 1}, nil
+}
+
+func (u *userService) GetQuizSummary(ctx context.Context, userId string, numCards int) ([]QuizSummary, error) {
+	reviews, err := u.storage.GetMostRecentReviews(ctx, userId, numCards)
 	if err != nil {
 		return nil, err
 	}
@@ -114,23 +348,23 @@ func (u *userService) GetQuizSummary(userId string, numCards int) ([]QuizSummary
 	return summary, nil
 }
 
-func (s *userService) GetStats(userId string) (map[string]interface{}, error) {
-	pending, err := s.storage.CountPendingReviews(userId)
+func (s *userService) GetStats(ctx context.Context, userId string) (map[string]interface{}, error) {
+	pending, err := s.storage.CountPendingReviews(ctx, userId)
 	if err != nil {
 		return nil, err
 	}
 
-	recentMistakes, err := s.storage.GetRecentMistakes(userId)
+	recentMistakes, err := s.storage.GetRecentMistakes(ctx, userId)
 	if err != nil {
 		return nil, err
 	}
 
-	progress, err := s.storage.GetLevelProgress(userId)
+	progress, err := s.storage.GetLevelProgress(ctx, userId)
 	if err != nil {
 		return nil, err
 	}
 
-	wordStats, err := s.storage.GetWordStats(userId)
+	wordStats, err := s.storage.GetWordStats(ctx, userId)
 	if err != nil {
 		return nil, err
 	}
@@ -1,10 +1,15 @@
 package api_test
 
 import (
+	"context"
 	"crabigateur-api/pkg/api"
+	"crabigateur-api/pkg/logging"
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -14,49 +19,84 @@ type MockUserRepository struct {
 	mock.Mock
 }
 
-func (m *MockUserRepository) GetLessons(userId string, numLessons int) ([]api.Card, error) {
+// WithUserTx runs fn directly against the mock, transactions are covered by the repository tests
+func (m *MockUserRepository) WithUserTx(ctx context.Context, fn func(api.UserRepository) error) error {
+	return fn(m)
+}
+
+func (m *MockUserRepository) GetLessons(ctx context.Context, userId string, numLessons int) ([]api.Card, error) {
 	args := m.Called(userId, numLessons)
 	return args.Get(0).([]api.Card), args.Error(1)
 }
 
-func (m *MockUserRepository) GetReview(userId string, firstReview bool, sort []api.SortOrder) ([]api.Card, error) {
+func (m *MockUserRepository) GetReview(ctx context.Context, userId string, firstReview bool, sort []api.SortOrder) ([]api.Card, error) {
 	args := m.Called(userId, firstReview, sort)
 	return args.Get(0).([]api.Card), args.Error(1)
 }
 
-func (m *MockUserRepository) InsertReview(userId string, cardId int) (api.ReviewResult, error) {
+func (m *MockUserRepository) InsertReview(ctx context.Context, userId string, cardId int) (api.ReviewResult, error) {
 	args := m.Called(userId, cardId)
 	return args.Get(0).(api.ReviewResult), args.Error(1)
 }
 
-func (m *MockUserRepository) UpdateReview(userId string, review api.Review) (api.ReviewResult, error) {
-	args := m.Called(userId, review)
+func (m *MockUserRepository) GetCardStatus(ctx context.Context, userId string, cardId int) (api.CardStatus, error) {
+	args := m.Called(userId, cardId)
+	return args.Get(0).(api.CardStatus), args.Error(1)
+}
+
+func (m *MockUserRepository) GetReviewResult(ctx context.Context, userId string, reviewId string) (api.ReviewResult, bool, error) {
+	args := m.Called(userId, reviewId)
+	return args.Get(0).(api.ReviewResult), args.Bool(1), args.Error(2)
+}
+
+func (m *MockUserRepository) GetSRSStages(ctx context.Context) (api.StageTable, error) {
+	args := m.Called()
+	return args.Get(0).(api.StageTable), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateReview(ctx context.Context, userId string, review api.Review, schedule api.ScheduleResult) (api.ReviewResult, error) {
+	args := m.Called(userId, review, schedule)
 	return args.Get(0).(api.ReviewResult), args.Error(1)
 }
 
-func (m *MockUserRepository) GetMostRecentReviews(userId string, cardId int) ([]api.ReviewResult, error) {
+func (m *MockUserRepository) GetMostRecentReviews(ctx context.Context, userId string, cardId int) ([]api.ReviewResult, error) {
 	args := m.Called(userId, cardId)
 	return args.Get(0).([]api.ReviewResult), args.Error(1)
 }
 
-func (m *MockUserRepository) CountPendingReviews(userId string) (int, error) {
+func (m *MockUserRepository) CountPendingReviews(ctx context.Context, userId string) (int, error) {
 	args := m.Called(userId)
 	return args.Get(0).(int), args.Error(1)
 }
 
-func (m *MockUserRepository) GetRecentMistakes(userId string) ([]api.CardTag, error) {
+func (m *MockUserRepository) GetRecentMistakes(ctx context.Context, userId string) ([]api.CardTag, error) {
 	args := m.Called(userId)
 	return args.Get(0).([]api.CardTag), args.Error(1)
 }
-func (m *MockUserRepository) GetLevelProgress(userId string) ([]api.CardProgress, error) {
+func (m *MockUserRepository) GetLevelProgress(ctx context.Context, userId string) ([]api.CardProgress, error) {
 	args := m.Called(userId)
 	return args.Get(0).([]api.CardProgress), args.Error(1)
 }
-func (m *MockUserRepository) GetWordStats(userId string) (map[string]map[string]int, error) {
+func (m *MockUserRepository) GetWordStats(ctx context.Context, userId string) (map[string]map[string]int, error) {
 	args := m.Called(userId)
 	return args.Get(0).(map[string]map[string]int), args.Error(1)
 }
 
+func (m *MockUserRepository) GetUserLevel(ctx context.Context, userId string) (int, error) {
+	args := m.Called(userId)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockUserRepository) GetCard(ctx context.Context, id int) (api.Card, error) {
+	args := m.Called(id)
+	return args.Get(0).(api.Card), args.Error(1)
+}
+
+func (m *MockUserRepository) PromoteUser(ctx context.Context, userId string, level int) (bool, error) {
+	args := m.Called(userId, level)
+	return args.Bool(0), args.Error(1)
+}
+
 func TestUserService_LessonCards(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -93,11 +133,11 @@ func TestUserService_LessonCards(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo := new(MockUserRepository)
-			service := api.NewUserService(mockRepo)
+			service := api.NewUserService(mockRepo, api.DefaultLevelProgression, api.DefaultSchedulers(), logging.Discard())
 
 			mockRepo.On("GetLessons", tt.userId, tt.numLessons).Return(tt.mockResult, tt.mockError)
 
-			result, resultId, err := service.LessonCards(tt.userId, tt.numLessons)
+			result, resultId, err := service.LessonCards(context.Background(), tt.userId, tt.numLessons)
 
 			if tt.expectErr {
 				assert.Error(t, err)
@@ -148,11 +188,11 @@ func TestUserService_ReviewCards(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo := new(MockUserRepository)
-			service := api.NewUserService(mockRepo)
+			service := api.NewUserService(mockRepo, api.DefaultLevelProgression, api.DefaultSchedulers(), logging.Discard())
 
 			mockRepo.On("GetReview", tt.userId, tt.firstReview, tt.sort).Return(tt.mockResult, tt.mockError)
 
-			result, err := service.ReviewCard(tt.userId, tt.firstReview, tt.sort)
+			result, err := service.ReviewCard(context.Background(), tt.userId, tt.firstReview, tt.sort)
 
 			if tt.expectErr {
 				assert.Error(t, err)
@@ -207,7 +247,7 @@ func TestUserService_AddReviews(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo := new(MockUserRepository)
-			service := api.NewUserService(mockRepo)
+			service := api.NewUserService(mockRepo, api.DefaultLevelProgression, api.DefaultSchedulers(), logging.Discard())
 
 			// Mock behavior for each cardId in the slice
 			for i, cardId := range tt.cardIds {
@@ -218,7 +258,7 @@ func TestUserService_AddReviews(t *testing.T) {
 				}
 			}
 
-			result, err := service.AddReviews(tt.userId, tt.cardIds)
+			result, err := service.AddReviews(context.Background(), tt.userId, tt.cardIds)
 
 			if tt.expectErr {
 				assert.Error(t, err)
@@ -233,30 +273,88 @@ func TestUserService_AddReviews(t *testing.T) {
 }
 
 func TestUserService_UpdateReviews(t *testing.T) {
+	masteredLevel := []api.CardProgress{
+		{CardId: 1, StageId: 5},
+		{CardId: 2, StageId: 6},
+	}
+	unfinishedLevel := []api.CardProgress{
+		{CardId: 1, StageId: 5},
+		{CardId: 2, StageId: 2},
+	}
+
+	success, incorrect := true, 0
+	reviewDate := time.Date(2024, 12, 1, 10, 0, 0, 0, time.UTC)
+	review := api.Review{CardId: 1, ReviewDate: reviewDate, Success: &success, IncorrectCount: &incorrect}
+	schedule := api.ScheduleResult{
+		Stage:          3,
+		NextReviewDate: reviewDate.Add(testStages[2].Interval),
+		Memory:         api.MemoryState{LastReview: reviewDate},
+	}
+
 	tests := []struct {
 		name       string
 		userId     string
-		review     api.Review
 		mockResult api.ReviewResult
 		mockError  error
+		mockSetup  func(m *MockUserRepository)
 		expected   api.ReviewResult
 		expectErr  bool
 	}{
 		{
 			name:       "Success",
 			userId:     "123",
-			review:     api.Review{CardId: 1, Success: new(bool)},
-			mockResult: api.ReviewResult{CardId: 1, Success: true},
+			mockResult: api.ReviewResult{CardId: 1, Success: true, StageId: "3"},
 			mockError:  nil,
-			expected:   api.ReviewResult{CardId: 1, Success: true},
-			expectErr:  false,
+			mockSetup: func(m *MockUserRepository) {
+				m.On("GetUserLevel", "123").Return(1, nil)
+				m.On("GetLevelProgress", "123").Return(unfinishedLevel, nil)
+			},
+			expected:  api.ReviewResult{CardId: 1, Success: true, StageId: "3"},
+			expectErr: false,
+		},
+		{
+			name:       "Success with level up",
+			userId:     "123",
+			mockResult: api.ReviewResult{CardId: 1, Success: true, StageId: "3"},
+			mockError:  nil,
+			mockSetup: func(m *MockUserRepository) {
+				m.On("GetUserLevel", "123").Return(1, nil)
+				m.On("GetLevelProgress", "123").Return(masteredLevel, nil)
+				m.On("PromoteUser", "123", 1).Return(true, nil)
+			},
+			expected:  api.ReviewResult{CardId: 1, Success: true, StageId: "3", LevelUp: &api.LevelUpEvent{PreviousLevel: 1, NewLevel: 2}},
+			expectErr: false,
+		},
+		{
+			name:       "Success on last level",
+			userId:     "123",
+			mockResult: api.ReviewResult{CardId: 1, Success: true, StageId: "3"},
+			mockError:  nil,
+			mockSetup: func(m *MockUserRepository) {
+				m.On("GetUserLevel", "123").Return(1, nil)
+				m.On("GetLevelProgress", "123").Return(masteredLevel, nil)
+				m.On("PromoteUser", "123", 1).Return(false, nil)
+			},
+			expected:  api.ReviewResult{CardId: 1, Success: true, StageId: "3"},
+			expectErr: false,
+		},
+		{
+			name:       "Level check error keeps review result",
+			userId:     "123",
+			mockResult: api.ReviewResult{CardId: 1, Success: true, StageId: "3"},
+			mockError:  nil,
+			mockSetup: func(m *MockUserRepository) {
+				m.On("GetUserLevel", "123").Return(0, errors.New("repository error"))
+			},
+			expected:  api.ReviewResult{CardId: 1, Success: true, StageId: "3"},
+			expectErr: false,
 		},
 		{
 			name:       "Repository Error",
 			userId:     "123",
-			review:     api.Review{CardId: 1, Success: new(bool)},
 			mockResult: api.ReviewResult{},
 			mockError:  errors.New("repository error"),
+			mockSetup:  func(m *MockUserRepository) {},
 			expected:   api.ReviewResult{},
 			expectErr:  true,
 		},
@@ -265,11 +363,14 @@ func TestUserService_UpdateReviews(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockRepo := new(MockUserRepository)
-			service := api.NewUserService(mockRepo)
+			service := api.NewUserService(mockRepo, api.DefaultLevelProgression, api.DefaultSchedulers(), logging.Discard())
 
-			mockRepo.On("UpdateReview", tt.userId, tt.review).Return(tt.mockResult, tt.mockError)
+			mockRepo.On("GetCardStatus", tt.userId, review.CardId).Return(api.CardStatus{Stage: 2, Scheduler: api.PenaltyStages}, nil)
+			mockRepo.On("GetSRSStages").Return(testStages, nil)
+			mockRepo.On("UpdateReview", tt.userId, review, schedule).Return(tt.mockResult, tt.mockError)
+			tt.mockSetup(mockRepo)
 
-			result, err := service.UpdateReview(tt.userId, tt.review)
+			result, err := service.UpdateReview(context.Background(), tt.userId, review)
 
 			if tt.expectErr {
 				assert.Error(t, err)
@@ -282,3 +383,314 @@ func TestUserService_UpdateReviews(t *testing.T) {
 		})
 	}
 }
+
+func TestUserService_UpdateReviews_UnknownCard(t *testing.T) {
+	success, incorrect := true, 0
+	review := api.Review{CardId: 1, Success: &success, IncorrectCount: &incorrect}
+
+	mockRepo := new(MockUserRepository)
+	service := api.NewUserService(mockRepo, api.DefaultLevelProgression, api.DefaultSchedulers(), logging.Discard())
+
+	mockRepo.On("GetCardStatus", "123", 1).Return(api.CardStatus{}, errors.New("card 1 has no lesson for user 123"))
+
+	_, err := service.UpdateReview(context.Background(), "123", review)
+
+	assert.Error(t, err)
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "UpdateReview", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUserService_UpdateReviews_FSRS(t *testing.T) {
+	success, incorrect := true, 0
+	reviewDate := time.Date(2024, 12, 1, 10, 0, 0, 0, time.UTC)
+	review := api.Review{CardId: 1, ReviewDate: reviewDate, Success: &success, IncorrectCount: &incorrect}
+
+	mockRepo := new(MockUserRepository)
+	service := api.NewUserService(mockRepo, api.DefaultLevelProgression, api.DefaultSchedulers(), logging.Discard())
+
+	// first FSRS review of a card answered "Good": stability 3.7145 days, scheduled in 4 days
+	expectedSchedule := mock.MatchedBy(func(schedule api.ScheduleResult) bool {
+		return schedule.Stage == 4 &&
+			schedule.NextReviewDate.Equal(reviewDate.AddDate(0, 0, 4)) &&
+			schedule.Memory.Stability == api.DefaultFSRSParameters.Weights[2] &&
+			schedule.Memory.LastReview.Equal(reviewDate)
+	})
+
+	mockRepo.On("GetCardStatus", "123", 1).Return(api.CardStatus{Stage: 0, Scheduler: api.FSRS}, nil)
+	mockRepo.On("GetSRSStages").Return(testStages, nil)
+	mockRepo.On("UpdateReview", "123", review, expectedSchedule).Return(api.ReviewResult{CardId: 1, Success: true, StageId: "4"}, nil)
+	mockRepo.On("GetUserLevel", "123").Return(1, nil)
+	mockRepo.On("GetLevelProgress", "123").Return([]api.CardProgress{}, nil)
+
+	result, err := service.UpdateReview(context.Background(), "123", review)
+
+	assert.NoError(t, err)
+	assert.Equal(t, api.ReviewResult{CardId: 1, Success: true, StageId: "4"}, result)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_AnswerReview(t *testing.T) {
+	card := api.Card{CardId: 1, WordType: "regular", Word: "chat", Gender: "m", Translation: []string{"cat"}}
+	reviewDate := time.Date(2024, 12, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name              string
+		answer            string
+		expectedSuccess   bool
+		expectedIncorrect int
+		expectedVerdict   api.Verdict
+	}{
+		{name: "Correct answer", answer: "cat", expectedSuccess: true, expectedIncorrect: 1, expectedVerdict: api.Correct},
+		{name: "Wrong answer counts as a mistake", answer: "dog", expectedSuccess: false, expectedIncorrect: 2, expectedVerdict: api.Incorrect},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			service := api.NewUserService(mockRepo, api.DefaultLevelProgression, api.DefaultSchedulers(), logging.Discard())
+
+			mockRepo.On("GetCard", 1).Return(card, nil)
+			mockRepo.On("GetCardStatus", "123", 1).Return(api.CardStatus{Stage: 2, Scheduler: api.PenaltyStages}, nil)
+			mockRepo.On("GetSRSStages").Return(testStages, nil)
+			mockRepo.On("UpdateReview", "123", mock.MatchedBy(func(review api.Review) bool {
+				return *review.Success == tt.expectedSuccess && *review.IncorrectCount == tt.expectedIncorrect
+			}), mock.Anything).Return(api.ReviewResult{CardId: 1, CardWord: "chat", Success: tt.expectedSuccess}, nil)
+			mockRepo.On("GetUserLevel", "123").Return(1, nil)
+			mockRepo.On("GetLevelProgress", "123").Return([]api.CardProgress{}, nil)
+
+			result, err := service.AnswerReview(context.Background(), "123", api.Answer{
+				CardId:         1,
+				ReviewDate:     reviewDate,
+				QuestionType:   api.TranslationQuestion,
+				Answer:         tt.answer,
+				IncorrectCount: 1,
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedVerdict, result.Grade.Verdict)
+			assert.Equal(t, tt.expectedSuccess, result.Review.Success)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserService_AnswerReview_CardNotFound(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := api.NewUserService(mockRepo, api.DefaultLevelProgression, api.DefaultSchedulers(), logging.Discard())
+
+	mockRepo.On("GetCard", 1).Return(api.Card{}, nil)
+
+	_, err := service.AnswerReview(context.Background(), "123", api.Answer{CardId: 1, QuestionType: api.TranslationQuestion, Answer: "cat"})
+
+	assert.ErrorIs(t, err, api.ErrCardNotFound)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_UpdateReviews_Batch(t *testing.T) {
+	success, incorrect := true, 0
+	first := time.Date(2024, 12, 1, 10, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+
+	// submitted out of order: card 2 was reviewed before card 1
+	reviews := []api.Review{
+		{CardId: 1, ReviewDate: second, Success: &success, IncorrectCount: &incorrect},
+		{CardId: 2, ReviewDate: first, Success: &success, IncorrectCount: &incorrect},
+		{CardId: 3, ReviewDate: second, Success: &success, IncorrectCount: &incorrect},
+	}
+
+	mockRepo := new(MockUserRepository)
+	service := api.NewUserService(mockRepo, api.DefaultLevelProgression, api.DefaultSchedulers(), logging.Discard())
+
+	var applied []int
+	mockRepo.On("GetSRSStages").Return(testStages, nil)
+	mockRepo.On("GetCardStatus", "123", 1).Return(api.CardStatus{Stage: 2, Scheduler: api.PenaltyStages}, nil)
+	mockRepo.On("GetCardStatus", "123", 2).Return(api.CardStatus{Stage: 2, Scheduler: api.PenaltyStages}, nil)
+	mockRepo.On("GetCardStatus", "123", 3).Return(api.CardStatus{}, errors.New("card 3 has no lesson for user 123"))
+	for _, cardId := range []int{1, 2} {
+		mockRepo.On("UpdateReview", "123", mock.MatchedBy(func(review api.Review) bool { return review.CardId == cardId }), mock.Anything).
+			Run(func(args mock.Arguments) { applied = append(applied, cardId) }).
+			Return(api.ReviewResult{CardId: cardId, Success: true, StageId: "3"}, nil)
+	}
+	mockRepo.On("GetUserLevel", "123").Return(1, nil)
+	mockRepo.On("GetLevelProgress", "123").Return([]api.CardProgress{}, nil)
+
+	results, err := service.UpdateReviews(context.Background(), "123", reviews)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 1}, applied)
+	assert.Equal(t, []api.BatchReviewResult{
+		{Index: 0, CardId: 1, Result: &api.ReviewResult{CardId: 1, Success: true, StageId: "3"}},
+		{Index: 1, CardId: 2, Result: &api.ReviewResult{CardId: 2, Success: true, StageId: "3"}},
+		{Index: 2, CardId: 3, Error: "Review could not be applied"},
+	}, results)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_UpdateReviews_Idempotency(t *testing.T) {
+	success, incorrect := true, 0
+	lastReview := time.Date(2024, 12, 1, 10, 0, 0, 0, time.UTC)
+	reviewId := "4f9c7f0e-1b7e-4c8e-9a55-0c2c0d3c6a11"
+
+	tests := []struct {
+		name        string
+		review      api.Review
+		mockSetup   func(m *MockUserRepository)
+		expected    api.ReviewResult
+		expectedErr error
+	}{
+		{
+			name:   "Replay returns the stored result",
+			review: api.Review{ReviewId: reviewId, CardId: 1, ReviewDate: lastReview, Success: &success, IncorrectCount: &incorrect},
+			mockSetup: func(m *MockUserRepository) {
+				m.On("GetCardStatus", "123", 1).Return(api.CardStatus{Stage: 3, Scheduler: api.PenaltyStages}, nil)
+				m.On("GetReviewResult", "123", reviewId).Return(api.ReviewResult{CardId: 1, CardWord: "chat", Success: true, StageId: "3"}, true, nil)
+			},
+			expected: api.ReviewResult{CardId: 1, CardWord: "chat", Success: true, StageId: "3"},
+		},
+		{
+			name:   "Retry stored by a concurrent request is replayed",
+			review: api.Review{ReviewId: reviewId, CardId: 1, ReviewDate: lastReview, Success: &success, IncorrectCount: &incorrect},
+			mockSetup: func(m *MockUserRepository) {
+				m.On("GetCardStatus", "123", 1).Return(api.CardStatus{Stage: 2, Scheduler: api.PenaltyStages}, nil)
+				m.On("GetReviewResult", "123", reviewId).Return(api.ReviewResult{}, false, nil).Once()
+				m.On("GetSRSStages").Return(testStages, nil)
+				m.On("UpdateReview", "123", mock.Anything, mock.Anything).
+					Return(api.ReviewResult{}, fmt.Errorf("storage - Insert into Reviews Query: %w", api.ErrDuplicate))
+				m.On("GetReviewResult", "123", reviewId).Return(api.ReviewResult{CardId: 1, CardWord: "chat", Success: true, StageId: "3"}, true, nil).Once()
+			},
+			expected: api.ReviewResult{CardId: 1, CardWord: "chat", Success: true, StageId: "3"},
+		},
+		{
+			name:   "Review id reused for another card",
+			review: api.Review{ReviewId: reviewId, CardId: 2, ReviewDate: lastReview, Success: &success, IncorrectCount: &incorrect},
+			mockSetup: func(m *MockUserRepository) {
+				m.On("GetCardStatus", "123", 2).Return(api.CardStatus{Stage: 1, Scheduler: api.PenaltyStages}, nil)
+				m.On("GetReviewResult", "123", reviewId).Return(api.ReviewResult{CardId: 1, CardWord: "chat", Success: true, StageId: "3"}, true, nil)
+			},
+			expectedErr: api.ErrReviewIdConflict,
+		},
+		{
+			name:   "Review older than the last applied one",
+			review: api.Review{ReviewId: reviewId, CardId: 1, ReviewDate: lastReview.Add(-time.Minute), Success: &success, IncorrectCount: &incorrect},
+			mockSetup: func(m *MockUserRepository) {
+				m.On("GetReviewResult", "123", reviewId).Return(api.ReviewResult{}, false, nil)
+				m.On("GetCardStatus", "123", 1).Return(api.CardStatus{
+					Stage:     2,
+					Scheduler: api.PenaltyStages,
+					Memory:    api.MemoryState{LastReview: lastReview},
+				}, nil)
+			},
+			expectedErr: api.ErrStaleReview,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			service := api.NewUserService(mockRepo, api.DefaultLevelProgression, api.DefaultSchedulers(), logging.Discard())
+			tt.mockSetup(mockRepo)
+
+			result, err := service.UpdateReview(context.Background(), "123", tt.review)
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, result)
+			}
+
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+// uncommittedRepository runs a transaction and then fails to commit it
+type uncommittedRepository struct {
+	*MockUserRepository
+}
+
+func (m uncommittedRepository) WithUserTx(ctx context.Context, fn func(api.UserRepository) error) error {
+	if err := fn(m.MockUserRepository); err != nil {
+		return err
+	}
+	return errors.New("commit failed")
+}
+
+// reviewsCounted reads crabi_reviews_total{success="true"}
+func reviewsCounted(t *testing.T) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "crabi_reviews_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "success" && label.GetValue() == "true" {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestUserService_UpdateReview_Metrics(t *testing.T) {
+	success, incorrect := true, 0
+	reviewId := "4f9c7f0e-1b7e-4c8e-9a55-0c2c0d3c6a11"
+	review := api.Review{CardId: 1, ReviewDate: time.Date(2024, 12, 1, 10, 0, 0, 0, time.UTC), Success: &success, IncorrectCount: &incorrect}
+	applies := func(m *MockUserRepository) {
+		m.On("GetCardStatus", "123", 1).Return(api.CardStatus{Stage: 2, Scheduler: api.PenaltyStages}, nil)
+		m.On("GetSRSStages").Return(testStages, nil)
+		m.On("UpdateReview", "123", mock.Anything, mock.Anything).Return(api.ReviewResult{CardId: 1, Success: true, StageId: "3"}, nil)
+		m.On("GetUserLevel", "123").Return(1, nil)
+		m.On("GetLevelProgress", "123").Return([]api.CardProgress{}, nil)
+	}
+
+	tests := []struct {
+		name     string
+		commits  bool
+		batch    bool
+		review   api.Review
+		setup    func(m *MockUserRepository)
+		expected float64
+	}{
+		{name: "Committed review", commits: true, review: review, setup: applies, expected: 1},
+		{name: "Review whose commit failed", commits: false, review: review, setup: applies, expected: 0},
+		{name: "Committed batch", commits: true, batch: true, review: review, setup: applies, expected: 1},
+		{name: "Batch whose commit failed", commits: false, batch: true, review: review, setup: applies, expected: 0},
+		{
+			name:    "Replayed review",
+			commits: true,
+			review:  api.Review{ReviewId: reviewId, CardId: 1, ReviewDate: review.ReviewDate, Success: &success, IncorrectCount: &incorrect},
+			setup: func(m *MockUserRepository) {
+				m.On("GetCardStatus", "123", 1).Return(api.CardStatus{Stage: 3, Scheduler: api.PenaltyStages}, nil)
+				m.On("GetReviewResult", "123", reviewId).Return(api.ReviewResult{CardId: 1, Success: true, StageId: "3"}, true, nil)
+			},
+			expected: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			tt.setup(mockRepo)
+			var repo api.UserRepository = mockRepo
+			if !tt.commits {
+				repo = uncommittedRepository{mockRepo}
+			}
+			service := api.NewUserService(repo, api.DefaultLevelProgression, api.DefaultSchedulers(), logging.Discard())
+
+			before := reviewsCounted(t)
+			var err error
+			if tt.batch {
+				_, err = service.UpdateReviews(context.Background(), "123", []api.Review{tt.review})
+			} else {
+				_, err = service.UpdateReview(context.Background(), "123", tt.review)
+			}
+
+			assert.Equal(t, !tt.commits, err != nil)
+			assert.Equal(t, tt.expected, reviewsCounted(t)-before)
+		})
+	}
+}
@@ -3,12 +3,13 @@ package api
 import (
 	"fmt"
 	"reflect"
+	"regexp"
 
 	"github.com/go-playground/validator/v10"
 )
 
 func (s SortOrder) IsValid() bool {
-	switch SortOrder(s) { 
+	switch SortOrder(s) {
 	case DateAsc, DateDesc, LevelAsc, LevelDesc:
 		return true
 	default:
@@ -21,11 +22,11 @@ var ValidSortOrders validator.Func = func(fl validator.FieldLevel) bool {
 	if !ok {
 		return false
 	}
-	
+
 	conflicts := map[SortOrder]SortOrder{
-		DateAsc:  DateDesc,
-		DateDesc: DateAsc,
-		LevelAsc: LevelDesc,
+		DateAsc:   DateDesc,
+		DateDesc:  DateAsc,
+		LevelAsc:  LevelDesc,
 		LevelDesc: LevelAsc,
 	}
 
@@ -47,7 +48,43 @@ var ValidSortOrders validator.Func = func(fl validator.FieldLevel) bool {
 }
 
 func (c Card) IsEmpty() bool {
- return reflect.ValueOf(c).IsZero()
+	return reflect.ValueOf(c).IsZero()
+}
+
+func (u User) IsEmpty() bool {
+	return reflect.ValueOf(u).IsZero()
+}
+
+// UsernamePattern matches usernames: 3 to 50 characters (Users.username is a
+// VARCHAR(50)) of letters, digits, '.', '_' or '-'
+const UsernamePattern = `^[A-Za-z0-9._-]{3,50}$`
+
+var usernamePattern = regexp.MustCompile(UsernamePattern)
+
+var ValidUsername validator.Func = func(fl validator.FieldLevel) bool {
+	username, ok := fl.Field().Interface().(string)
+	if !ok {
+		return false
+	}
+	return usernamePattern.MatchString(username)
+}
+
+var cardValidator = newCardValidator()
+
+func newCardValidator() *validator.Validate {
+	v := validator.New()
+	v.SetTagName("binding")
+	v.RegisterStructValidation(CardStructValidation, Card{})
+	return v
+}
+
+// ValidateCard applies the rules used when binding a Card from a request to
+// cards coming from elsewhere, e.g. seed data. Failures wrap ErrValidation.
+func ValidateCard(card Card) error {
+	if err := cardValidator.Struct(card); err != nil {
+		return fmt.Errorf("%w: %w", ErrValidation, err)
+	}
+	return nil
 }
 
 func CardStructValidation(sl validator.StructLevel) {
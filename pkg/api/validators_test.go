@@ -35,9 +35,9 @@ func TestValidSortOrders(t *testing.T) {
 	_ = validate.RegisterValidation("sortable", api.ValidSortOrders)
 
 	tests := []struct {
-		name       string
-		orders     []api.SortOrder
-		expected   bool
+		name     string
+		orders   []api.SortOrder
+		expected bool
 	}{
 		{name: "Valid single sort", orders: []api.SortOrder{api.DateAsc}, expected: true},
 		{name: "Valid multiple sorts", orders: []api.SortOrder{api.DateAsc, api.LevelDesc}, expected: true},
@@ -0,0 +1,321 @@
+package app
+
+import (
+	"crabigateur-api/pkg/api"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// subjectKey is the gin context key holding the authenticated user id
+const subjectKey = "auth_subject"
+
+// apiKeyKey is the gin context key holding the api.ApiKey of a service caller
+const apiKeyKey = "auth_api_key"
+
+const apiKeyHeader = "X-API-Key"
+
+// clockSkew is how far exp and nbf may be off before a token is rejected
+const clockSkew = time.Minute
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token expired")
+)
+
+// AuthConfig holds the keys tokens may be signed with. At least one of
+// HS256Secret and RS256PublicKey must be set; Issuer and Audience are only
+// checked when set.
+type AuthConfig struct {
+	HS256Secret    []byte
+	RS256PublicKey []byte // PEM encoded, PKIX or PKCS #1
+	Issuer         string
+	Audience       string
+}
+
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	IssuedAt  int64    `json:"iat"`
+}
+
+// audience accepts both forms of the aud claim, a string or an array of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+func (a audience) contains(value string) bool {
+	for _, aud := range a {
+		if aud == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator verifies HS256 and RS256 signed JWTs
+type Authenticator struct {
+	hmacSecret []byte
+	publicKey  *rsa.PublicKey
+	issuer     string
+	audience   string
+	now        func() time.Time
+}
+
+func NewAuthenticator(config AuthConfig) (*Authenticator, error) {
+	auth := &Authenticator{
+		hmacSecret: config.HS256Secret,
+		issuer:     config.Issuer,
+		audience:   config.Audience,
+		now:        time.Now,
+	}
+
+	if len(config.RS256PublicKey) > 0 {
+		key, err := parseRSAPublicKey(config.RS256PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		auth.publicKey = key
+	}
+
+	if len(auth.hmacSecret) == 0 && auth.publicKey == nil {
+		return nil, fmt.Errorf("auth: no HS256 secret or RS256 public key configured")
+	}
+
+	return auth, nil
+}
+
+func parseRSAPublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("auth: RS256 public key is not PEM encoded")
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("auth: RS256 public key: %s", err)
+		}
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("auth: RS256 public key is not an RSA key")
+		}
+		return rsaKey, nil
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("auth: RS256 public key: %s", err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("auth: unexpected PEM block %q for RS256 public key", block.Type)
+	}
+}
+
+// Verify checks the signature and time claims of token and returns its claims.
+// The algorithm has to match a configured key, so "none" and HS256 tokens
+// signed with the RSA public key are rejected.
+func (a *Authenticator) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrInvalidToken
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	signingInput := parts[0] + "." + parts[1]
+	switch {
+	case header.Algorithm == "HS256" && len(a.hmacSecret) > 0:
+		mac := hmac.New(sha256.New, a.hmacSecret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return Claims{}, ErrInvalidToken
+		}
+	case header.Algorithm == "RS256" && a.publicKey != nil:
+		digest := sha256.Sum256([]byte(signingInput))
+		if err := rsa.VerifyPKCS1v15(a.publicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return Claims{}, ErrInvalidToken
+		}
+	default:
+		return Claims{}, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	now := a.now()
+	switch {
+	case claims.Subject == "":
+		return Claims{}, ErrInvalidToken
+	case claims.ExpiresAt == 0:
+		return Claims{}, ErrInvalidToken
+	case now.After(time.Unix(claims.ExpiresAt, 0).Add(clockSkew)):
+		return Claims{}, ErrExpiredToken
+	case claims.NotBefore != 0 && now.Add(clockSkew).Before(time.Unix(claims.NotBefore, 0)):
+		return Claims{}, ErrInvalidToken
+	case a.issuer != "" && claims.Issuer != a.issuer:
+		return Claims{}, ErrInvalidToken
+	case a.audience != "" && !claims.Audience.contains(a.audience):
+		return Claims{}, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Authenticate rejects requests without a valid bearer token or API key. It
+// stores the token's subject, the user id, or the API key in the gin context.
+func (s *Server) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if plain := c.GetHeader(apiKeyHeader); plain != "" {
+			s.authenticateApiKey(c, plain)
+			return
+		}
+
+		token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !found || token == "" {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing bearer token"})
+			return
+		}
+
+		claims, err := s.authenticator.Verify(token)
+		if err != nil {
+			handlerError(c, err)
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			if errors.Is(err, ErrExpiredToken) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
+			} else {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			}
+			return
+		}
+
+		c.Set(subjectKey, claims.Subject)
+		c.Next()
+	}
+}
+
+func (s *Server) authenticateApiKey(c *gin.Context, plain string) {
+	key, err := s.apiKeyService.AuthenticateApiKey(c.Request.Context(), plain)
+	if err != nil {
+		renderError(c, err)
+		return
+	}
+	if key.KeyId == 0 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		return
+	}
+
+	c.Set(apiKeyKey, key)
+	c.Next()
+}
+
+// AuthorizeUser only lets a request through when its :user_id is the
+// authenticated user's id, or when the caller has one of alternatives, e.g. a
+// service reading any learner's stats. It must run after Authenticate.
+func (s *Server) AuthorizeUser(alternatives ...api.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subject := c.GetString(subjectKey)
+		if subject != "" && c.Param("user_id") == subject {
+			c.Next()
+			return
+		}
+
+		for _, permission := range alternatives {
+			allowed, err := s.can(c, permission)
+			if err != nil {
+				renderError(c, err)
+				return
+			}
+			if allowed {
+				c.Next()
+				return
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+	}
+}
+
+// RequirePermission only lets a request through when the caller has
+// permission. It must run after Authenticate.
+func (s *Server) RequirePermission(permission api.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, err := s.can(c, permission)
+		if err != nil {
+			renderError(c, err)
+			return
+		}
+
+		if !allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// can reports whether the caller has permission: through its scopes for an
+// API key, through the role of their account for a user
+func (s *Server) can(c *gin.Context, permission api.Permission) (bool, error) {
+	if key, ok := c.Get(apiKeyKey); ok {
+		return key.(api.ApiKey).Can(permission), nil
+	}
+
+	user, err := s.userAccountService.GetUser(c.Request.Context(), c.GetString(subjectKey))
+	if err != nil {
+		return false, err
+	}
+
+	// a token for someone without an account has no role at all
+	return !user.IsEmpty() && user.Role.Can(permission), nil
+}
@@ -0,0 +1,162 @@
+package app_test
+
+import (
+	"crabigateur-api/pkg/app"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticator_Verify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	assert.NoError(t, err)
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})
+
+	signRS256 := func(claims map[string]interface{}) string {
+		return signJWT(map[string]interface{}{"alg": "RS256", "typ": "JWT"}, claims, func(signingInput []byte) []byte {
+			digest := sha256.Sum256(signingInput)
+			signature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+			assert.NoError(t, err)
+			return signature
+		})
+	}
+
+	withClaims := func(extra map[string]interface{}) map[string]interface{} {
+		claims := testClaims("123")
+		for key, value := range extra {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	both := app.AuthConfig{HS256Secret: testSecret, RS256PublicKey: publicKeyPEM, Issuer: "crabigateur", Audience: "api"}
+	valid := map[string]interface{}{"iss": "crabigateur", "aud": "api"}
+
+	tests := []struct {
+		name        string
+		config      app.AuthConfig
+		token       string
+		expectedSub string
+		expectedErr error
+	}{
+		{
+			name:        "HS256",
+			config:      both,
+			token:       signHS256(withClaims(valid)),
+			expectedSub: "123",
+		},
+		{
+			name:        "RS256",
+			config:      both,
+			token:       signRS256(withClaims(valid)),
+			expectedSub: "123",
+		},
+		{
+			name:        "Audience as an array",
+			config:      both,
+			token:       signHS256(withClaims(map[string]interface{}{"iss": "crabigateur", "aud": []string{"web", "api"}})),
+			expectedSub: "123",
+		},
+		{
+			name:        "HS256 without a configured secret",
+			config:      app.AuthConfig{RS256PublicKey: publicKeyPEM},
+			token:       signHS256(testClaims("123")),
+			expectedErr: app.ErrInvalidToken,
+		},
+		{
+			name:   "Unsigned token",
+			config: both,
+			token: signJWT(map[string]interface{}{"alg": "none"}, withClaims(valid), func([]byte) []byte {
+				return nil
+			}),
+			expectedErr: app.ErrInvalidToken,
+		},
+		{
+			name:        "Tampered signature",
+			config:      both,
+			token:       signHS256(withClaims(valid)) + "x",
+			expectedErr: app.ErrInvalidToken,
+		},
+		{
+			name:        "Malformed token",
+			config:      both,
+			token:       "not-a-token",
+			expectedErr: app.ErrInvalidToken,
+		},
+		{
+			name:        "Expired",
+			config:      both,
+			token:       signHS256(withClaims(map[string]interface{}{"iss": "crabigateur", "aud": "api", "exp": time.Now().Add(-time.Hour).Unix()})),
+			expectedErr: app.ErrExpiredToken,
+		},
+		{
+			name:        "Expired within clock skew",
+			config:      both,
+			token:       signHS256(withClaims(map[string]interface{}{"iss": "crabigateur", "aud": "api", "exp": time.Now().Add(-10 * time.Second).Unix()})),
+			expectedSub: "123",
+		},
+		{
+			name:        "Not valid yet",
+			config:      both,
+			token:       signHS256(withClaims(map[string]interface{}{"iss": "crabigateur", "aud": "api", "nbf": time.Now().Add(time.Hour).Unix()})),
+			expectedErr: app.ErrInvalidToken,
+		},
+		{
+			name:        "Missing expiry",
+			config:      app.AuthConfig{HS256Secret: testSecret},
+			token:       signHS256(map[string]interface{}{"sub": "123"}),
+			expectedErr: app.ErrInvalidToken,
+		},
+		{
+			name:        "Missing subject",
+			config:      app.AuthConfig{HS256Secret: testSecret},
+			token:       signHS256(map[string]interface{}{"exp": time.Now().Add(time.Hour).Unix()}),
+			expectedErr: app.ErrInvalidToken,
+		},
+		{
+			name:        "Wrong issuer",
+			config:      both,
+			token:       signHS256(withClaims(map[string]interface{}{"iss": "someone-else", "aud": "api"})),
+			expectedErr: app.ErrInvalidToken,
+		},
+		{
+			name:        "Wrong audience",
+			config:      both,
+			token:       signHS256(withClaims(map[string]interface{}{"iss": "crabigateur", "aud": "web"})),
+			expectedErr: app.ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator, err := app.NewAuthenticator(tt.config)
+			assert.NoError(t, err)
+
+			claims, err := authenticator.Verify(tt.token)
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedSub, claims.Subject)
+			}
+		})
+	}
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	_, err := app.NewAuthenticator(app.AuthConfig{})
+	assert.Error(t, err)
+
+	_, err = app.NewAuthenticator(app.AuthConfig{RS256PublicKey: []byte("not a pem key")})
+	assert.Error(t, err)
+}
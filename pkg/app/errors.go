@@ -0,0 +1,58 @@
+package app
+
+import (
+	"context"
+	"crabigateur-api/pkg/api"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// renderError stops the request with err, RenderErrors writes the response
+// matching its kind and AccessLog logs it
+func renderError(c *gin.Context, err error) {
+	_ = c.Error(err).SetType(gin.ErrorTypePrivate)
+	c.Abort()
+}
+
+// RenderErrors writes the response of requests stopped with renderError. The
+// body is {"error": message}, where the message is the api.Error's when there
+// is one, so internal details never reach the client.
+func (s *Server) RenderErrors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		err := c.Errors.ByType(gin.ErrorTypePrivate).Last()
+		if err == nil || c.Writer.Written() {
+			return
+		}
+
+		status, message := errorResponse(err.Err)
+		c.JSON(status, gin.H{"error": message})
+	}
+}
+
+func errorResponse(err error) (int, string) {
+	status, message := http.StatusInternalServerError, "Internal server error"
+	switch {
+	case errors.Is(err, api.ErrNotFound):
+		status, message = http.StatusNotFound, "Not found"
+	case errors.Is(err, api.ErrDuplicate):
+		status, message = http.StatusConflict, "Already exists"
+	case errors.Is(err, api.ErrConflict):
+		status, message = http.StatusConflict, "Conflicts with the current state of the resource"
+	case errors.Is(err, api.ErrValidation):
+		status, message = http.StatusUnprocessableEntity, "Validation failed"
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, "Request timed out"
+	default:
+		return status, message
+	}
+
+	var apiErr *api.Error
+	if errors.As(err, &apiErr) {
+		message = apiErr.Message
+	}
+	return status, message
+}
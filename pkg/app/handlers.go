@@ -2,9 +2,10 @@ package app
 
 import (
 	"crabigateur-api/pkg/api"
-	"log"
+	"crabigateur-api/pkg/deck"
+	"errors"
+	"fmt"
 	"net/http"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
@@ -22,28 +23,50 @@ func (s *Server) ApiStatus() gin.HandlerFunc {
 	}
 }
 
+// Healthz answers as long as the process serves requests, without checking its
+// dependencies: a liveness probe failing on a database outage would only get
+// the server restarted
+func (s *Server) Healthz() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	}
+}
+
+// Readyz reports whether the server can handle traffic, with the result of
+// each check, and answers 503 when one of them failed
+func (s *Server) Readyz() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		readiness := s.healthService.Readiness(c.Request.Context())
+
+		status := http.StatusOK
+		if !readiness.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, readiness)
+	}
+}
+
 func (s *Server) GetUserLessons() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Content-Type", "application/json")
 
 		var pathParams api.UserPath
 		if err := c.ShouldBindUri(&pathParams); err != nil {
-			log.Printf("handler error: invalid uri params: %v", err)
+			handlerError(c, fmt.Errorf("invalid uri params: %w", err))
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
 			return
 		}
 
 		var queryParams api.QueryParams
 		if err := c.ShouldBindWith(&queryParams, binding.Query); err != nil {
-			log.Printf("handler error: invalid query params: %v", err)
+			handlerError(c, fmt.Errorf("invalid query params: %w", err))
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
 			return
 		}
 
-		cards, ids, err := s.userService.LessonCards(pathParams.UserId, queryParams.NumCards)
+		cards, ids, err := s.userService.LessonCards(c.Request.Context(), pathParams.UserId, queryParams.NumCards)
 		if err != nil {
-			log.Printf("service error: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			renderError(c, err)
 			return
 		}
 
@@ -65,22 +88,21 @@ func (s *Server) GetUserReviews() gin.HandlerFunc {
 
 		var pathParams api.UserPath
 		if err := c.ShouldBindUri(&pathParams); err != nil {
-			log.Printf("handler error: invalid uri params: %v", err)
+			handlerError(c, fmt.Errorf("invalid uri params: %w", err))
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
 			return
 		}
 
 		var queryParams api.QueryParams
 		if err := c.ShouldBindWith(&queryParams, binding.Query); err != nil {
-			log.Printf("handler error: invalid query params: %v", err)
+			handlerError(c, fmt.Errorf("invalid query params: %w", err))
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
 			return
 		}
 
-		review, err := s.userService.ReviewCard(pathParams.UserId, queryParams.FirstReview, queryParams.Sort)
+		review, err := s.userService.ReviewCard(c.Request.Context(), pathParams.UserId, queryParams.FirstReview, queryParams.Sort)
 		if err != nil {
-			log.Printf("service error: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			renderError(c, err)
 			return
 		} else if review.IsEmpty() {
 			c.JSON(http.StatusNoContent, gin.H{"data": "No cards to review"})
@@ -101,7 +123,7 @@ func (s *Server) PostUserReviews() gin.HandlerFunc {
 
 		var pathParams api.UserPath
 		if err := c.ShouldBindUri(&pathParams); err != nil {
-			log.Printf("handler error: invalid uri params: %v", err)
+			handlerError(c, fmt.Errorf("invalid uri params: %w", err))
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
 			return
 		}
@@ -109,15 +131,14 @@ func (s *Server) PostUserReviews() gin.HandlerFunc {
 		var list api.QuizList
 		err := c.ShouldBindJSON(&list)
 		if err != nil {
-			log.Printf("handler error: %v", err)
+			handlerError(c, err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review format"})
 			return
 		}
 
-		result, err := s.userService.AddReviews(pathParams.UserId, list.CardIds)
+		result, err := s.userService.AddReviews(c.Request.Context(), pathParams.UserId, list.CardIds)
 		if err != nil {
-			log.Printf("service error: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			renderError(c, err)
 			return
 		}
 
@@ -135,7 +156,7 @@ func (s *Server) PutUserReviews() gin.HandlerFunc {
 
 		var pathParams api.UserPath
 		if err := c.ShouldBindUri(&pathParams); err != nil {
-			log.Printf("handler error: invalid uri params: %v", err)
+			handlerError(c, fmt.Errorf("invalid uri params: %w", err))
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
 			return
 		}
@@ -143,15 +164,80 @@ func (s *Server) PutUserReviews() gin.HandlerFunc {
 		var review api.Review
 		err := c.ShouldBindJSON(&review)
 		if err != nil {
-			log.Printf("handler error: %v", err)
+			handlerError(c, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review format"})
+			return
+		}
+
+		result, err := s.userService.UpdateReview(c.Request.Context(), pathParams.UserId, review)
+		if err != nil {
+			renderError(c, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"data": result,
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+func (s *Server) PutUserReviewsBatch() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "application/json")
+
+		var pathParams api.UserPath
+		if err := c.ShouldBindUri(&pathParams); err != nil {
+			handlerError(c, fmt.Errorf("invalid uri params: %w", err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+
+		var reviews api.Reviews
+		err := c.ShouldBindJSON(&reviews)
+		if err != nil {
+			handlerError(c, err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review format"})
 			return
 		}
 
-		result, err := s.userService.UpdateReview(pathParams.UserId, review)
+		results, err := s.userService.UpdateReviews(c.Request.Context(), pathParams.UserId, reviews.Reviews)
 		if err != nil {
-			log.Printf("service error: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			renderError(c, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"data": results,
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+func (s *Server) PostUserAnswer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "application/json")
+
+		var pathParams api.UserPath
+		if err := c.ShouldBindUri(&pathParams); err != nil {
+			handlerError(c, fmt.Errorf("invalid uri params: %w", err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+
+		var answer api.Answer
+		err := c.ShouldBindJSON(&answer)
+		if err != nil {
+			handlerError(c, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid answer format"})
+			return
+		}
+
+		result, err := s.userService.AnswerReview(c.Request.Context(), pathParams.UserId, answer)
+		if err != nil {
+			renderError(c, err)
 			return
 		}
 
@@ -169,22 +255,21 @@ func (s *Server) GetUserQuizSummary() gin.HandlerFunc {
 
 		var pathParams api.UserPath
 		if err := c.ShouldBindUri(&pathParams); err != nil {
-			log.Printf("handler error: invalid uri params: %v", err)
+			handlerError(c, fmt.Errorf("invalid uri params: %w", err))
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
 			return
 		}
 
 		var queryParams api.QueryParams
 		if err := c.ShouldBindWith(&queryParams, binding.Query); err != nil {
-			log.Printf("handler error: invalid query params: %v", err)
+			handlerError(c, fmt.Errorf("invalid query params: %w", err))
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
 			return
 		}
 
-		summary, err := s.userService.GetQuizSummary(pathParams.UserId, queryParams.NumCards)
+		summary, err := s.userService.GetQuizSummary(c.Request.Context(), pathParams.UserId, queryParams.NumCards)
 		if err != nil {
-			log.Printf("service error: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			renderError(c, err)
 			return
 		}
 
@@ -202,13 +287,14 @@ func (s *Server) GetUserStats() gin.HandlerFunc {
 
 		var pathParams api.UserPath
 		if err := c.ShouldBindUri(&pathParams); err != nil {
+			handlerError(c, fmt.Errorf("invalid uri params: %w", err))
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
 			return
 		}
 
-		stats, err := s.userService.GetStats(pathParams.UserId)
+		stats, err := s.userService.GetStats(c.Request.Context(), pathParams.UserId)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve stats"})
+			renderError(c, err)
 			return
 		}
 
@@ -222,17 +308,17 @@ func (s *Server) GetCardById() gin.HandlerFunc {
 
 		var pathParams api.CardPath
 		if err := c.ShouldBindUri(&pathParams); err != nil {
-			log.Printf("handler error: invalid uri params: %v", err)
+			handlerError(c, fmt.Errorf("invalid uri params: %w", err))
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid card_id"})
 			return
 		}
 
-		card, err := s.cardService.GetCardById(pathParams.CardId)
+		card, err := s.cardService.GetCardById(c.Request.Context(), pathParams.CardId)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			renderError(c, err)
 			return
 		} else if card.IsEmpty() {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Card not found"})
+			renderError(c, api.ErrCardNotFound)
 			return
 		}
 
@@ -249,19 +335,14 @@ func (s *Server) CreateCard() gin.HandlerFunc {
 		var card api.Card
 		err := c.ShouldBindJSON(&card)
 		if err != nil {
-			log.Printf("handler error: %v", err)
+			handlerError(c, err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review format"})
 			return
 		}
 
-		result, err := s.cardService.CreateCard(card)
+		result, err := s.cardService.CreateCard(c.Request.Context(), card)
 		if err != nil {
-			log.Printf("service error: %v", err)
-			if strings.Contains(err.Error(), "duplicate card") {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "A card with this word already exists"})
-			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-			}
+			renderError(c, err)
 			return
 		}
 
@@ -277,7 +358,7 @@ func (s *Server) UpdateCard() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var pathParams api.CardPath
 		if err := c.ShouldBindUri(&pathParams); err != nil {
-			log.Printf("handler error: invalid uri params: %v", err)
+			handlerError(c, fmt.Errorf("invalid uri params: %w", err))
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid card_id"})
 			return
 		}
@@ -285,15 +366,14 @@ func (s *Server) UpdateCard() gin.HandlerFunc {
 		var card api.Card
 		err := c.ShouldBindJSON(&card)
 		if err != nil {
-			log.Printf("handler error: %v", err)
+			handlerError(c, err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid card format"})
 			return
 		}
 
-		result, err := s.cardService.UpdateCard(pathParams.CardId, card)
+		result, err := s.cardService.UpdateCard(c.Request.Context(), pathParams.CardId, card)
 		if err != nil {
-			log.Printf("service error: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			renderError(c, err)
 			return
 		}
 
@@ -311,16 +391,16 @@ func (s *Server) DeleteCard() gin.HandlerFunc {
 
 		var pathParams api.CardPath
 		if err := c.ShouldBindUri(&pathParams); err != nil {
-			log.Printf("handler error: invalid uri params: %v", err)
+			handlerError(c, fmt.Errorf("invalid uri params: %w", err))
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid card_id"})
 			return
 		}
 
-		err := s.cardService.DeleteCard(pathParams.CardId)
+		err := s.cardService.DeleteCard(c.Request.Context(), pathParams.CardId)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			renderError(c, err)
 			return
-		} // TODO: especify errors ??
+		}
 
 		response := map[string]interface{}{
 			"data": "Card deleted successfully",
@@ -336,18 +416,394 @@ func (s *Server) SearchCards() gin.HandlerFunc {
 
 		var queryParams api.CardQueryParams
 		if err := c.ShouldBindQuery(&queryParams); err != nil {
-			log.Printf("handler error: invalid query params: %v", err)
+			handlerError(c, fmt.Errorf("invalid query params: %w", err))
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
 			return
 		}
 
-		cards, err := s.cardService.SearchCards(queryParams)
+		cards, err := s.cardService.SearchCards(c.Request.Context(), queryParams)
 		if err != nil {
-			log.Printf("service error: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			renderError(c, err)
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{"data": cards})
 	}
 }
+
+// ExportApkg answers the cards matching the search as an Anki package, to
+// study them offline
+func (s *Server) ExportApkg() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var queryParams api.CardQueryParams
+		if err := c.ShouldBindQuery(&queryParams); err != nil {
+			handlerError(c, fmt.Errorf("invalid query params: %w", err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+			return
+		}
+
+		cards, err := s.cardService.SearchCards(c.Request.Context(), queryParams)
+		if err != nil {
+			renderError(c, err)
+			return
+		}
+
+		// the package is streamed once its collection is built, so that a
+		// failure to build it still gets an error response
+		c.Header("Content-Type", deck.ApkgContentType)
+		c.Header("Content-Disposition", `attachment; filename="crabigateur.apkg"`)
+		if err := deck.WriteApkg(c.Writer, cards); err != nil {
+			if !c.Writer.Written() {
+				c.Writer.Header().Del("Content-Type")
+				c.Writer.Header().Del("Content-Disposition")
+			}
+			renderError(c, err)
+		}
+	}
+}
+
+// ImportCards creates or updates the cards of a CSV file, a JSON array or
+// NDJSON, told apart by the Content-Type, and reports the outcome of every
+// card. It also restores the backups of ExportCards.
+func (s *Server) ImportCards() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var queryParams api.ImportParams
+		if err := c.ShouldBindQuery(&queryParams); err != nil {
+			handlerError(c, fmt.Errorf("invalid query params: %w", err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+			return
+		}
+
+		format, err := deck.FormatOfContentType(c.ContentType())
+		if err != nil {
+			handlerError(c, err)
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be text/csv, application/json or application/x-ndjson"})
+			return
+		}
+
+		cards, err := deck.Read(c.Request.Body, format)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			handlerError(c, err)
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Card file is larger than %d bytes", tooLarge.Limit)})
+			return
+		} else if err != nil {
+			handlerError(c, err)
+			message := "Invalid card file"
+			var rowErr *deck.RowError
+			if errors.As(err, &rowErr) {
+				message += ", " + rowErr.Error()
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": message})
+			return
+		}
+
+		report, err := s.cardService.ImportCards(c.Request.Context(), cards, queryParams.DryRun)
+		if err != nil {
+			renderError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": report})
+	}
+}
+
+// ExportCards streams every card with its forms and conjugations as NDJSON or
+// CSV, a backup of the content tables apart from user data. Once cards are
+// sent a failure can only cut the response short, it is logged, and the file
+// lacks the end of export line.
+func (s *Server) ExportCards() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var queryParams api.ExportParams
+		if err := c.ShouldBindQuery(&queryParams); err != nil {
+			handlerError(c, fmt.Errorf("invalid query params: %w", err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+			return
+		}
+
+		ctx := c.Request.Context()
+		var writer deck.CardWriter
+		switch deck.Format(queryParams.Format) {
+		case deck.CSV:
+			tenses, err := s.cardService.GetTenses(ctx)
+			if err != nil {
+				renderError(c, err)
+				return
+			}
+			c.Header("Content-Type", "text/csv; charset=utf-8")
+			c.Header("Content-Disposition", `attachment; filename="crabigateur-cards.csv"`)
+			writer = deck.NewCSVWriter(c.Writer, tenses)
+		default:
+			c.Header("Content-Type", deck.NDJSONContentType)
+			c.Header("Content-Disposition", `attachment; filename="crabigateur-cards.ndjson"`)
+			writer = deck.NewNDJSONWriter(c.Writer)
+		}
+
+		err := s.cardService.ExportCards(ctx, writer.Write)
+		if err == nil {
+			err = writer.Close()
+		}
+		if err != nil {
+			// nothing sent yet, the error gets its usual JSON response
+			if !c.Writer.Written() {
+				c.Writer.Header().Del("Content-Type")
+				c.Writer.Header().Del("Content-Disposition")
+			}
+			renderError(c, err)
+		}
+	}
+}
+
+func (s *Server) GetUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "application/json")
+
+		var pathParams api.UserPath
+		if err := c.ShouldBindUri(&pathParams); err != nil {
+			handlerError(c, fmt.Errorf("invalid uri params: %w", err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+
+		user, err := s.userAccountService.GetUser(c.Request.Context(), pathParams.UserId)
+		if err != nil {
+			renderError(c, err)
+			return
+		} else if user.IsEmpty() {
+			renderError(c, api.ErrUserNotFound)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": user})
+	}
+}
+
+func (s *Server) CreateUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "application/json")
+
+		var user api.User
+		err := c.ShouldBindJSON(&user)
+		if err != nil {
+			handlerError(c, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user format"})
+			return
+		}
+
+		// an account can only be created for the identity in the token
+		if user.UserId != c.GetString(subjectKey) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			return
+		}
+
+		result, err := s.userAccountService.CreateUser(c.Request.Context(), user)
+		if err != nil {
+			renderError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"data": result})
+	}
+}
+
+func (s *Server) UpdateUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "application/json")
+
+		var pathParams api.UserPath
+		if err := c.ShouldBindUri(&pathParams); err != nil {
+			handlerError(c, fmt.Errorf("invalid uri params: %w", err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+
+		var update api.UserUpdate
+		err := c.ShouldBindJSON(&update)
+		if err != nil {
+			handlerError(c, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user format"})
+			return
+		}
+
+		user, err := s.userAccountService.UpdateUser(c.Request.Context(), pathParams.UserId, update)
+		if err != nil {
+			renderError(c, err)
+			return
+		} else if user.IsEmpty() {
+			renderError(c, api.ErrUserNotFound)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": user})
+	}
+}
+
+func (s *Server) DeleteUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "application/json")
+
+		var pathParams api.UserPath
+		if err := c.ShouldBindUri(&pathParams); err != nil {
+			handlerError(c, fmt.Errorf("invalid uri params: %w", err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+
+		deleted, err := s.userAccountService.DeleteUser(c.Request.Context(), pathParams.UserId)
+		if err != nil {
+			renderError(c, err)
+			return
+		} else if !deleted {
+			renderError(c, api.ErrUserNotFound)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": "User deleted successfully"})
+	}
+}
+
+func (s *Server) SetUserRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "application/json")
+
+		var pathParams api.UserPath
+		if err := c.ShouldBindUri(&pathParams); err != nil {
+			handlerError(c, fmt.Errorf("invalid uri params: %w", err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+
+		var update api.RoleUpdate
+		if err := c.ShouldBindJSON(&update); err != nil {
+			handlerError(c, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+			return
+		}
+
+		result, err := s.userAccountService.SetUserRole(c.Request.Context(), pathParams.UserId, update.Role)
+		if err != nil {
+			renderError(c, err)
+			return
+		}
+
+		if result.IsEmpty() {
+			renderError(c, api.ErrUserNotFound)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": result})
+	}
+}
+
+func (s *Server) SetUserLevel() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "application/json")
+
+		var pathParams api.UserPath
+		if err := c.ShouldBindUri(&pathParams); err != nil {
+			handlerError(c, fmt.Errorf("invalid uri params: %w", err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id"})
+			return
+		}
+
+		var update api.LevelUpdate
+		if err := c.ShouldBindJSON(&update); err != nil {
+			handlerError(c, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid level"})
+			return
+		}
+
+		result, err := s.userAccountService.SetUserLevel(c.Request.Context(), pathParams.UserId, update.Level)
+		if err != nil {
+			renderError(c, err)
+			return
+		}
+
+		if result.IsEmpty() {
+			renderError(c, api.ErrUserNotFound)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": result})
+	}
+}
+
+func (s *Server) GetUsersByRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "application/json")
+
+		var queryParams api.RoleQueryParams
+		if err := c.ShouldBindQuery(&queryParams); err != nil {
+			handlerError(c, fmt.Errorf("invalid query params: %w", err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+			return
+		}
+
+		result, err := s.userAccountService.GetUsersByRole(c.Request.Context(), queryParams.Role)
+		if err != nil {
+			renderError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": result})
+	}
+}
+
+func (s *Server) CreateApiKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "application/json")
+
+		var key api.NewApiKey
+		if err := c.ShouldBindJSON(&key); err != nil {
+			handlerError(c, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key format"})
+			return
+		}
+
+		result, err := s.apiKeyService.CreateApiKey(c.Request.Context(), c.GetString(subjectKey), key)
+		if err != nil {
+			renderError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"data": result})
+	}
+}
+
+func (s *Server) ListApiKeys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "application/json")
+
+		result, err := s.apiKeyService.ListApiKeys(c.Request.Context())
+		if err != nil {
+			renderError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": result})
+	}
+}
+
+func (s *Server) RevokeApiKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "application/json")
+
+		var pathParams api.ApiKeyPath
+		if err := c.ShouldBindUri(&pathParams); err != nil {
+			handlerError(c, fmt.Errorf("invalid uri params: %w", err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key_id"})
+			return
+		}
+
+		revoked, err := s.apiKeyService.RevokeApiKey(c.Request.Context(), pathParams.KeyId)
+		if err != nil {
+			renderError(c, err)
+			return
+		} else if !revoked {
+			renderError(c, api.ErrApiKeyNotFound)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"data": "API key revoked successfully"})
+	}
+}
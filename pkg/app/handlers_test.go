@@ -2,12 +2,20 @@ package app_test
 
 import (
 	"bytes"
+	"context"
 	"crabigateur-api/pkg/api"
 	"crabigateur-api/pkg/app"
+	"crabigateur-api/pkg/logging"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/mock"
@@ -18,69 +26,208 @@ type MockService struct {
 }
 
 type fields struct {
-	userService *MockService
-	cardService *MockService
+	userService        *MockService
+	cardService        *MockService
+	userAccountService *MockService
+	apiKeyService      *MockService
+	healthService      *MockService
 }
 
-func (m *MockService) LessonCards(userId string, numLessons int) ([]api.Card, []int, error) {
+func (m *MockService) LessonCards(ctx context.Context, userId string, numLessons int) ([]api.Card, []int, error) {
 	args := m.Called(userId, numLessons)
 	return args.Get(0).([]api.Card), args.Get(1).([]int), args.Error(2)
 }
 
-func (m *MockService) ReviewCard(userId string, firstReview bool, sort []api.SortOrder) (api.Card, error) {
+func (m *MockService) ReviewCard(ctx context.Context, userId string, firstReview bool, sort []api.SortOrder) (api.Card, error) {
 	args := m.Called(userId, firstReview, sort)
 	return args.Get(0).(api.Card), args.Error(1)
 }
 
-func (m *MockService) AddReviews(userId string, cardIds []int) ([]api.ReviewResult, error) {
+func (m *MockService) AddReviews(ctx context.Context, userId string, cardIds []int) ([]api.ReviewResult, error) {
 	args := m.Called(userId, cardIds)
 	return args.Get(0).([]api.ReviewResult), args.Error(1)
 }
 
-func (m *MockService) UpdateReview(userId string, review api.Review) (api.ReviewResult, error) {
+func (m *MockService) UpdateReview(ctx context.Context, userId string, review api.Review) (api.ReviewResult, error) {
 	args := m.Called(userId, review)
 	return args.Get(0).(api.ReviewResult), args.Error(1)
 }
 
-func (m *MockService) GetQuizSummary(userId string, numCards int) ([]api.QuizSummary, error) {
+func (m *MockService) UpdateReviews(ctx context.Context, userId string, reviews []api.Review) ([]api.BatchReviewResult, error) {
+	args := m.Called(userId, reviews)
+	return args.Get(0).([]api.BatchReviewResult), args.Error(1)
+}
+
+func (m *MockService) AnswerReview(ctx context.Context, userId string, answer api.Answer) (api.AnswerResult, error) {
+	args := m.Called(userId, answer)
+	return args.Get(0).(api.AnswerResult), args.Error(1)
+}
+
+func (m *MockService) GetQuizSummary(ctx context.Context, userId string, numCards int) ([]api.QuizSummary, error) {
 	args := m.Called(userId, numCards)
 	return args.Get(0).([]api.QuizSummary), args.Error(1)
 }
 
-func (m *MockService) GetCardById(id int) (api.Card, error) {
+func (m *MockService) GetCardById(ctx context.Context, id int) (api.Card, error) {
 	args := m.Called(id)
 	return args.Get(0).(api.Card), args.Error(1)
 }
 
-func (m *MockService) CreateCard(card api.Card) (api.Card, error) {
+func (m *MockService) CreateCard(ctx context.Context, card api.Card) (api.Card, error) {
 	args := m.Called(card)
 	return args.Get(0).(api.Card), args.Error(1)
 }
 
-func (m *MockService) UpdateCard(cardId int, card api.Card) (api.Card, error) {
+func (m *MockService) UpdateCard(ctx context.Context, cardId int, card api.Card) (api.Card, error) {
 	args := m.Called(card)
 	return args.Get(0).(api.Card), args.Error(1)
 }
 
-func (m *MockService) DeleteCard(cardId int) error {
+func (m *MockService) DeleteCard(ctx context.Context, cardId int) error {
 	args := m.Called(cardId)
 	return args.Error(0)
 }
 
-func (m *MockService) SearchCards(query api.CardQueryParams) ([]api.Card, error) {
+func (m *MockService) SearchCards(ctx context.Context, query api.CardQueryParams) ([]api.Card, error) {
 	args := m.Called(query)
 	return args.Get(0).([]api.Card), args.Error(1)
 }
 
-func (m *MockService) GetStats(userId string) (map[string]interface{}, error) {
+func (m *MockService) ImportCards(ctx context.Context, cards []api.Card, dryRun bool) (api.ImportReport, error) {
+	args := m.Called(cards, dryRun)
+	return args.Get(0).(api.ImportReport), args.Error(1)
+}
+
+// ExportCards calls fn with the cards given to Return, then returns its error
+func (m *MockService) ExportCards(ctx context.Context, fn func(api.Card) error) error {
+	args := m.Called()
+	for _, card := range args.Get(0).([]api.Card) {
+		if err := fn(card); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockService) GetTenses(ctx context.Context) ([]string, error) {
+	args := m.Called()
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockService) GetStats(ctx context.Context, userId string) (map[string]interface{}, error) {
 	args := m.Called(userId)
 	return args.Get(0).(map[string]interface{}), args.Error(1)
 }
 
+func (m *MockService) GetUser(ctx context.Context, userId string) (api.User, error) {
+	args := m.Called(userId)
+	return args.Get(0).(api.User), args.Error(1)
+}
+
+func (m *MockService) CreateUser(ctx context.Context, user api.User) (api.User, error) {
+	args := m.Called(user)
+	return args.Get(0).(api.User), args.Error(1)
+}
+
+func (m *MockService) UpdateUser(ctx context.Context, userId string, update api.UserUpdate) (api.User, error) {
+	args := m.Called(userId, update)
+	return args.Get(0).(api.User), args.Error(1)
+}
+
+func (m *MockService) DeleteUser(ctx context.Context, userId string) (bool, error) {
+	args := m.Called(userId)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockService) SetUserRole(ctx context.Context, userId string, role api.Role) (api.User, error) {
+	args := m.Called(userId, role)
+	return args.Get(0).(api.User), args.Error(1)
+}
+
+func (m *MockService) SetUserLevel(ctx context.Context, userId string, level int) (api.User, error) {
+	args := m.Called(userId, level)
+	return args.Get(0).(api.User), args.Error(1)
+}
+
+func (m *MockService) GetUsersByRole(ctx context.Context, role api.Role) ([]api.User, error) {
+	args := m.Called(role)
+	return args.Get(0).([]api.User), args.Error(1)
+}
+
+func (m *MockService) CreateApiKey(ctx context.Context, createdBy string, key api.NewApiKey) (api.CreatedApiKey, error) {
+	args := m.Called(createdBy, key)
+	return args.Get(0).(api.CreatedApiKey), args.Error(1)
+}
+
+func (m *MockService) ListApiKeys(ctx context.Context) ([]api.ApiKey, error) {
+	args := m.Called()
+	return args.Get(0).([]api.ApiKey), args.Error(1)
+}
+
+func (m *MockService) RevokeApiKey(ctx context.Context, keyId int) (bool, error) {
+	args := m.Called(keyId)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockService) Readiness(ctx context.Context) api.Readiness {
+	args := m.Called()
+	return args.Get(0).(api.Readiness)
+}
+
+func (m *MockService) AuthenticateApiKey(ctx context.Context, key string) (api.ApiKey, error) {
+	args := m.Called(key)
+	return args.Get(0).(api.ApiKey), args.Error(1)
+}
+
+// withApiKey mocks the lookup of the "crabi_test_key" API key, granted scopes
+func withApiKey(scopes ...api.Permission) *MockService {
+	mockService := new(MockService)
+	mockService.On("AuthenticateApiKey", "crabi_test_key").Return(api.ApiKey{KeyId: 1, Name: "pipeline", Prefix: "test", Scopes: scopes}, nil)
+	return mockService
+}
+
+func apiKeyRequest(method string, url string, body string) *http.Request {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "crabi_test_key")
+	return req
+}
+
+// withRole mocks the account lookup done by RequirePermission for user 123
+func withRole(mockService *MockService, role api.Role) *MockService {
+	mockService.On("GetUser", "123").Return(api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Role: role}, nil)
+	return mockService
+}
+
 type args struct {
 	request func() *http.Request
 }
 
+var testSecret = []byte("test-secret")
+
+func testClaims(subject string) map[string]interface{} {
+	return map[string]interface{}{
+		"sub": subject,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+// signJWT builds a token from header and claims, signing it with sign
+func signJWT(header map[string]interface{}, claims map[string]interface{}, sign func(signingInput []byte) []byte) string {
+	headerJSON, _ := json.Marshal(header)
+	claimsJSON, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signingInput)))
+}
+
+func signHS256(claims map[string]interface{}) string {
+	return signJWT(map[string]interface{}{"alg": "HS256", "typ": "JWT"}, claims, func(signingInput []byte) []byte {
+		mac := hmac.New(sha256.New, testSecret)
+		mac.Write(signingInput)
+		return mac.Sum(nil)
+	})
+}
+
 func TestHandlers(t *testing.T) {
 	tests := []struct {
 		name               string
@@ -101,6 +248,62 @@ func TestHandlers(t *testing.T) {
 			expectedStatusCode: http.StatusOK,
 			expectedBody:       `{"data":"crabigateur API running smoothly"}`,
 		},
+		{
+			name:   "Healthz - Success",
+			fields: fields{},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodGet, "/healthz", nil)
+					req.Header.Set("Authorization", "")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"status":"ok"}`,
+		},
+		{
+			name: "Readyz - Ready",
+			fields: fields{
+				healthService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("Readiness").Return(api.Readiness{Ready: true, Checks: map[string]api.CheckResult{
+						"database": {Status: api.CheckOk, LatencyMs: 1},
+					}})
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodGet, "/readyz", nil)
+					req.Header.Set("Authorization", "")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"ready":true,"checks":{"database":{"status":"ok","latency_ms":1}}}`,
+		},
+		{
+			name: "Readyz - Failed check",
+			fields: fields{
+				healthService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("Readiness").Return(api.Readiness{Ready: false, Checks: map[string]api.CheckResult{
+						"database":   {Status: api.CheckOk, LatencyMs: 1},
+						"migrations": {Status: api.CheckFail, LatencyMs: 2, Error: "Schema at version 3, expected 4"},
+					}})
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodGet, "/readyz", nil)
+					req.Header.Set("Authorization", "")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusServiceUnavailable,
+			expectedBody:       `{"ready":false,"checks":{"database":{"status":"ok","latency_ms":1},"migrations":{"status":"fail","latency_ms":2,"error":"Schema at version 3, expected 4"}}}`,
+		},
 		{
 			name: "GetUserLessons - Success",
 			fields: fields{
@@ -131,6 +334,7 @@ func TestHandlers(t *testing.T) {
 			args: args{
 				request: func() *http.Request {
 					req, _ := http.NewRequest(http.MethodGet, "/v1/api/lessons/a?num_cards=10", nil)
+					req.Header.Set("Authorization", "Bearer "+signHS256(testClaims("a")))
 					return req
 				},
 			},
@@ -217,22 +421,1178 @@ func TestHandlers(t *testing.T) {
 			expectedStatusCode: http.StatusBadRequest,
 			expectedBody:       `{"error":"Invalid review format"}`,
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			mockUserService := tt.fields.userService
-			mockCardService := tt.fields.cardService
-
-			router := gin.Default()
-			server := app.NewServer(router, mockUserService, mockCardService)
-
-			router = server.Routes()
-			server.RegisterValidators()
+		{
+			name: "PutUserReviews - Stale review",
+			fields: fields{
+				userService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("UpdateReview", "123", mock.Anything).Return(api.ReviewResult{}, api.ErrStaleReview)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					body := `{"review_id":"4f9c7f0e-1b7e-4c8e-9a55-0c2c0d3c6a11","card_id":1,"review_date":"2024-12-01T10:00:00Z","success":true,"incorrect_count":0}`
+					req, _ := http.NewRequest(http.MethodPut, "/v1/api/reviews/123", strings.NewReader(body))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusConflict,
+			expectedBody:       `{"error":"Review is older than the last applied review of this card"}`,
+		},
+		{
+			name: "PutUserReviews - Invalid review id",
+			fields: fields{
+				userService: new(MockService),
+			},
+			args: args{
+				request: func() *http.Request {
+					body := `{"review_id":"not-a-uuid","card_id":1,"review_date":"2024-12-01T10:00:00Z","success":true,"incorrect_count":0}`
+					req, _ := http.NewRequest(http.MethodPut, "/v1/api/reviews/123", strings.NewReader(body))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"error":"Invalid review format"}`,
+		},
+		{
+			name: "PutUserReviewsBatch - Success",
+			fields: fields{
+				userService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("UpdateReviews", "123", mock.MatchedBy(func(reviews []api.Review) bool {
+						return len(reviews) == 2 && reviews[0].CardId == 1 && reviews[1].CardId == 2
+					})).Return([]api.BatchReviewResult{
+						{Index: 0, CardId: 1, Result: &api.ReviewResult{CardId: 1, CardWord: "chat", Success: true, StageId: "3"}},
+						{Index: 1, CardId: 2, Error: "Review could not be applied"},
+					}, nil)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					body := `{"reviews":[
+						{"card_id":1,"review_date":"2024-12-01T10:00:00Z","success":true,"incorrect_count":0},
+						{"card_id":2,"review_date":"2024-12-01T10:01:00Z","success":false,"incorrect_count":2}
+					]}`
+					req, _ := http.NewRequest(http.MethodPut, "/v1/api/reviews/123/batch", strings.NewReader(body))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"data":[{"index":0,"card_id":1,"result":{"card_id":1,"card_word":"chat","success":true,"stage_id":"3"}},{"index":1,"card_id":2,"error":"Review could not be applied"}]}`,
+		},
+		{
+			name: "PutUserReviewsBatch - Invalid item",
+			fields: fields{
+				userService: new(MockService),
+			},
+			args: args{
+				request: func() *http.Request {
+					body := `{"reviews":[{"card_id":1,"review_date":"2024-12-01T10:00:00Z","success":true,"incorrect_count":-1}]}`
+					req, _ := http.NewRequest(http.MethodPut, "/v1/api/reviews/123/batch", strings.NewReader(body))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"error":"Invalid review format"}`,
+		},
+		{
+			name: "PutUserReviewsBatch - Empty batch",
+			fields: fields{
+				userService: new(MockService),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodPut, "/v1/api/reviews/123/batch", strings.NewReader(`{"reviews":[]}`))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"error":"Invalid review format"}`,
+		},
+		{
+			name: "PostUserAnswer - Success",
+			fields: fields{
+				userService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("AnswerReview", "123", api.Answer{
+						CardId:       1,
+						ReviewDate:   time.Date(2024, 12, 1, 10, 0, 0, 0, time.UTC),
+						QuestionType: api.TranslationQuestion,
+						Answer:       "cat",
+					}).Return(api.AnswerResult{
+						Grade:  api.Grade{Verdict: api.Correct, Correct: true, Expected: []string{"cat"}, Matched: "cat"},
+						Review: api.ReviewResult{CardId: 1, CardWord: "chat", Success: true, StageId: "3"},
+					}, nil)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					body := `{"card_id":1,"review_date":"2024-12-01T10:00:00Z","question_type":"translation","answer":"cat"}`
+					req, _ := http.NewRequest(http.MethodPost, "/v1/api/reviews/123/answer", strings.NewReader(body))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"data":{"grade":{"verdict":"correct","correct":true,"expected":["cat"],"matched":"cat"},"review":{"card_id":1,"card_word":"chat","success":true,"stage_id":"3"}}}`,
+		},
+		{
+			name: "PostUserAnswer - Form question without form",
+			fields: fields{
+				userService: new(MockService),
+			},
+			args: args{
+				request: func() *http.Request {
+					body := `{"card_id":1,"review_date":"2024-12-01T10:00:00Z","question_type":"form","answer":"belle"}`
+					req, _ := http.NewRequest(http.MethodPost, "/v1/api/reviews/123/answer", strings.NewReader(body))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"error":"Invalid answer format"}`,
+		},
+		{
+			name: "PostUserAnswer - Invalid question",
+			fields: fields{
+				userService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("AnswerReview", "123", mock.Anything).Return(api.AnswerResult{}, api.ErrInvalidQuestion)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					body := `{"card_id":1,"review_date":"2024-12-01T10:00:00Z","question_type":"gender","answer":"m"}`
+					req, _ := http.NewRequest(http.MethodPost, "/v1/api/reviews/123/answer", strings.NewReader(body))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedBody:       `{"error":"Invalid question for this card"}`,
+		},
+		{
+			name: "CreateUser - Success",
+			fields: fields{
+				userAccountService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("CreateUser", api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com"}).Return(api.User{
+						UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Scheduler: api.PenaltyStages, Role: api.Learner,
+						DateJoined: time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC),
+					}, nil)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					body := `{"user_id":"123","username":"crabi","email":"crabi@example.com"}`
+					req, _ := http.NewRequest(http.MethodPost, "/v1/api/users", strings.NewReader(body))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusCreated,
+			expectedBody:       `{"data":{"user_id":"123","username":"crabi","email":"crabi@example.com","level":1,"scheduler":"stages","role":"learner","date_joined":"2024-12-01T00:00:00Z"}}`,
+		},
+		{
+			name: "CreateUser - Invalid email",
+			fields: fields{
+				userAccountService: new(MockService),
+			},
+			args: args{
+				request: func() *http.Request {
+					body := `{"user_id":"123","username":"crabi","email":"not-an-email"}`
+					req, _ := http.NewRequest(http.MethodPost, "/v1/api/users", strings.NewReader(body))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"error":"Invalid user format"}`,
+		},
+		{
+			name: "CreateUser - Invalid username",
+			fields: fields{
+				userAccountService: new(MockService),
+			},
+			args: args{
+				request: func() *http.Request {
+					body := `{"user_id":"123","username":"crabi gateur!","email":"crabi@example.com"}`
+					req, _ := http.NewRequest(http.MethodPost, "/v1/api/users", strings.NewReader(body))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"error":"Invalid user format"}`,
+		},
+		{
+			name: "CreateUser - Duplicate user",
+			fields: fields{
+				userAccountService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("CreateUser", api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com"}).
+						Return(api.User{}, fmt.Errorf("storage - InsertUser: %w: pq: duplicate key value", api.ErrDuplicateUser))
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					body := `{"user_id":"123","username":"crabi","email":"crabi@example.com"}`
+					req, _ := http.NewRequest(http.MethodPost, "/v1/api/users", strings.NewReader(body))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusConflict,
+			expectedBody:       `{"error":"A user with this id already exists"}`,
+		},
+		{
+			name: "GetUser - Not found",
+			fields: fields{
+				userAccountService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("GetUser", "123").Return(api.User{}, nil)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodGet, "/v1/api/users/123", nil)
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusNotFound,
+			expectedBody:       `{"error":"User not found"}`,
+		},
+		{
+			name: "UpdateUser - Success",
+			fields: fields{
+				userAccountService: func() *MockService {
+					mockService := new(MockService)
+					scheduler := api.FSRS
+					mockService.On("UpdateUser", "123", api.UserUpdate{Scheduler: &scheduler}).Return(api.User{
+						UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Scheduler: api.FSRS, Role: api.Learner,
+						DateJoined: time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC),
+					}, nil)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodPatch, "/v1/api/users/123", strings.NewReader(`{"scheduler":"fsrs"}`))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"data":{"user_id":"123","username":"crabi","email":"crabi@example.com","level":1,"scheduler":"fsrs","role":"learner","date_joined":"2024-12-01T00:00:00Z"}}`,
+		},
+		{
+			name: "UpdateUser - Level is not changed",
+			fields: fields{
+				userAccountService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("UpdateUser", "123", api.UserUpdate{}).Return(api.User{
+						UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Scheduler: api.PenaltyStages, Role: api.Learner,
+						DateJoined: time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC),
+					}, nil)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodPatch, "/v1/api/users/123", strings.NewReader(`{"level":30}`))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"data":{"user_id":"123","username":"crabi","email":"crabi@example.com","level":1,"scheduler":"stages","role":"learner","date_joined":"2024-12-01T00:00:00Z"}}`,
+		},
+		{
+			name: "DeleteUser - Not found",
+			fields: fields{
+				userAccountService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("DeleteUser", "123").Return(false, nil)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodDelete, "/v1/api/users/123", nil)
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusNotFound,
+			expectedBody:       `{"error":"User not found"}`,
+		},
+		{
+			name: "DeleteUser - Last admin",
+			fields: fields{
+				userAccountService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("DeleteUser", "123").Return(false, api.ErrLastAdminDeleted)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodDelete, "/v1/api/users/123", nil)
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusConflict,
+			expectedBody:       `{"error":"The last admin cannot be deleted"}`,
+		},
+		{
+			name:   "Auth - Missing token",
+			fields: fields{},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodGet, "/v1/api/reviews/123", nil)
+					req.Header.Set("Authorization", "")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusUnauthorized,
+			expectedBody:       `{"error":"Missing bearer token"}`,
+		},
+		{
+			name:   "Auth - Expired token",
+			fields: fields{},
+			args: args{
+				request: func() *http.Request {
+					claims := testClaims("123")
+					claims["exp"] = time.Now().Add(-time.Hour).Unix()
+					req, _ := http.NewRequest(http.MethodGet, "/v1/api/reviews/123", nil)
+					req.Header.Set("Authorization", "Bearer "+signHS256(claims))
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusUnauthorized,
+			expectedBody:       `{"error":"Token expired"}`,
+		},
+		{
+			name:   "Auth - Another user's reviews",
+			fields: fields{},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodGet, "/v1/api/reviews/456", nil)
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       `{"error":"Forbidden"}`,
+		},
+		{
+			name:   "Auth - Another user's account",
+			fields: fields{},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodDelete, "/v1/api/users/456", nil)
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       `{"error":"Forbidden"}`,
+		},
+		{
+			name:   "Auth - Create an account for another user",
+			fields: fields{},
+			args: args{
+				request: func() *http.Request {
+					body := `{"user_id":"456","username":"crabi","email":"crabi@example.com"}`
+					req, _ := http.NewRequest(http.MethodPost, "/v1/api/users", strings.NewReader(body))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       `{"error":"Forbidden"}`,
+		},
+		{
+			name:   "Auth - Status is public",
+			fields: fields{},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodGet, "/v1/api/status", nil)
+					req.Header.Set("Authorization", "")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"data":"crabigateur API running smoothly"}`,
+		},
+		{
+			name: "CreateCard - Learner is forbidden",
+			fields: fields{
+				cardService:        new(MockService),
+				userAccountService: withRole(new(MockService), api.Learner),
+			},
+			args: args{
+				request: func() *http.Request {
+					body := `{"level":1,"word":"chat","word_type":"regular","gender":"m","translations":["cat"]}`
+					req, _ := http.NewRequest(http.MethodPost, "/v1/api/card", strings.NewReader(body))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       `{"error":"Forbidden"}`,
+		},
+		{
+			name: "CreateCard - Token without an account is forbidden",
+			fields: fields{
+				cardService: new(MockService),
+				userAccountService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("GetUser", "123").Return(api.User{}, nil)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodDelete, "/v1/api/card/1", nil)
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       `{"error":"Forbidden"}`,
+		},
+		{
+			name: "CreateCard - Editor",
+			fields: fields{
+				cardService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("CreateCard", api.Card{Level: 1, Word: "chat", WordType: "regular", Gender: "m", Translation: []string{"cat"}}).
+						Return(api.Card{CardId: 1, Level: 1, Word: "chat", WordType: "regular", Gender: "m", Translation: []string{"cat"}}, nil)
+					return mockService
+				}(),
+				userAccountService: withRole(new(MockService), api.Editor),
+			},
+			args: args{
+				request: func() *http.Request {
+					body := `{"level":1,"word":"chat","word_type":"regular","gender":"m","translations":["cat"]}`
+					req, _ := http.NewRequest(http.MethodPost, "/v1/api/card", strings.NewReader(body))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name: "CreateCard - Duplicate card",
+			fields: fields{
+				cardService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("CreateCard", mock.Anything).
+						Return(api.Card{}, fmt.Errorf("storage - InsertCard: %w: pq: duplicate key value", api.ErrDuplicateCard))
+					return mockService
+				}(),
+				userAccountService: withRole(new(MockService), api.Editor),
+			},
+			args: args{
+				request: func() *http.Request {
+					body := `{"level":1,"word":"chat","word_type":"regular","gender":"m","translations":["cat"]}`
+					req, _ := http.NewRequest(http.MethodPost, "/v1/api/card", strings.NewReader(body))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusConflict,
+			expectedBody:       `{"error":"A card with this word already exists"}`,
+		},
+		{
+			name: "DeleteCard - Not found",
+			fields: fields{
+				cardService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("DeleteCard", 7).Return(fmt.Errorf("storage - DeleteCard: %w: 7", api.ErrCardNotFound))
+					return mockService
+				}(),
+				userAccountService: withRole(new(MockService), api.Editor),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodDelete, "/v1/api/card/7", nil)
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusNotFound,
+			expectedBody:       `{"error":"Card not found"}`,
+		},
+		{
+			name: "ExportApkg - Cards of a level",
+			fields: fields{
+				cardService: func() *MockService {
+					level := 2
+					mockService := new(MockService)
+					mockService.On("SearchCards", api.CardQueryParams{Level: &level}).
+						Return([]api.Card{{CardId: 1, Level: 2, Word: "chat", WordType: "regular", Gender: "m", Translation: []string{"cat"}}}, nil)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodGet, "/v1/api/card/apkg?level=2", nil)
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name: "ExportApkg - Invalid level",
+			fields: fields{
+				cardService: new(MockService),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodGet, "/v1/api/card/apkg?level=two", nil)
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"error":"Invalid query parameters"}`,
+		},
+		{
+			name: "ImportCards - CSV dry run",
+			fields: fields{
+				cardService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("ImportCards", []api.Card{
+						{Level: 1, Word: "beau", WordType: "irregular", Gender: "m", Translation: []string{"beautiful", "handsome"},
+							Forms: map[string][]string{"m.s.": {"beau"}, "m.p.": {"beaux"}, "f.s.": {"belle"}, "f.p.": {"belles"}}},
+						{Level: 1, Word: "parler", WordType: "verb", Translation: []string{"to speak"},
+							Forms: map[string][]string{"présent": {"parle", "parles", "parle", "parlons", "parlez", "parlent"}}},
+					}, true).Return(api.ImportReport{DryRun: true, Created: 1, Updated: 1, Results: []api.ImportResult{
+						{Index: 0, Word: "beau", Gender: "m", Status: api.ImportCreated, CardId: 9},
+						{Index: 1, Word: "parler", Status: api.ImportUpdated, CardId: 3},
+					}}, nil)
+					return mockService
+				}(),
+				userAccountService: withRole(new(MockService), api.Editor),
+			},
+			args: args{
+				request: func() *http.Request {
+					body := "word,translations,word_type,gender,level,m.s.,m.p.,f.s.,f.p.,présent\n" +
+						"beau,beautiful|handsome,irregular,m,1,beau,beaux,belle,belles,\n" +
+						"parler,to speak,verb,,1,,,,,parle|parles|parle|parlons|parlez|parlent\n"
+					req, _ := http.NewRequest(http.MethodPost, "/v1/api/card/import?dry_run=true", strings.NewReader(body))
+					req.Header.Set("Content-Type", "text/csv; charset=utf-8")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody: `{"data":{"dry_run":true,"created":1,"updated":1,"rejected":0,"results":[` +
+				`{"index":0,"word":"beau","gender":"m","status":"created","card_id":9},` +
+				`{"index":1,"word":"parler","status":"updated","card_id":3}]}}`,
+		},
+		{
+			name: "ImportCards - JSON with a rejected card",
+			fields: fields{
+				cardService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("ImportCards", []api.Card{{Level: 1, Word: "chat", WordType: "animal", Gender: "m"}}, false).
+						Return(api.ImportReport{Rejected: 1, Results: []api.ImportResult{
+							{Index: 0, Word: "chat", Gender: "m", Status: api.ImportRejected, Error: "invalid word_type"},
+						}}, nil)
+					return mockService
+				}(),
+				userAccountService: withRole(new(MockService), api.Editor),
+			},
+			args: args{
+				request: func() *http.Request {
+					body := `[{"level":1,"word":"chat","word_type":"animal","gender":"m"}]`
+					req, _ := http.NewRequest(http.MethodPost, "/v1/api/card/import", strings.NewReader(body))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody: `{"data":{"dry_run":false,"created":0,"updated":0,"rejected":1,"results":[` +
+				`{"index":0,"word":"chat","gender":"m","status":"rejected","error":"invalid word_type"}]}}`,
+		},
+		{
+			name: "ImportCards - Malformed CSV row",
+			fields: fields{
+				cardService:        new(MockService),
+				userAccountService: withRole(new(MockService), api.Editor),
+			},
+			args: args{
+				request: func() *http.Request {
+					body := "word,level\nchat,1\nchien,one\n"
+					req, _ := http.NewRequest(http.MethodPost, "/v1/api/card/import", strings.NewReader(body))
+					req.Header.Set("Content-Type", "text/csv")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"error":"Invalid card file, line 3: invalid level \"one\""}`,
+		},
+		{
+			name: "ImportCards - Unsupported content type",
+			fields: fields{
+				cardService:        new(MockService),
+				userAccountService: withRole(new(MockService), api.Editor),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodPost, "/v1/api/card/import", strings.NewReader("word\tlevel"))
+					req.Header.Set("Content-Type", "text/tab-separated-values")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusUnsupportedMediaType,
+			expectedBody:       `{"error":"Content-Type must be text/csv, application/json or application/x-ndjson"}`,
+		},
+		{
+			name: "ImportCards - Learner is forbidden",
+			fields: fields{
+				cardService:        new(MockService),
+				userAccountService: withRole(new(MockService), api.Learner),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodPost, "/v1/api/card/import", strings.NewReader("[]"))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       `{"error":"Forbidden"}`,
+		},
+		{
+			name: "ExportCards - NDJSON by default",
+			fields: fields{
+				cardService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("ExportCards").Return([]api.Card{
+						{CardId: 1, Level: 1, Word: "chat", WordType: "regular", Gender: "m", Translation: []string{"cat"}},
+						{CardId: 2, Level: 1, Word: "maison", WordType: "irregular", Gender: "f", Translation: []string{"house"},
+							Forms: map[string][]string{"f.s.": {"maison"}}},
+					}, nil)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodGet, "/v1/api/cards/export", nil)
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody: `{"card_id":1,"level":1,"word_type":"regular","translations":["cat"],"word":"chat","gender":"m","forms":null,"is_irregular_verb":false}` + "\n" +
+				`{"card_id":2,"level":1,"word_type":"irregular","translations":["house"],"word":"maison","gender":"f","forms":{"f.s.":["maison"]},"is_irregular_verb":false}` + "\n" +
+				`{"end_of_export":true,"cards":2}` + "\n",
+		},
+		{
+			name: "ExportCards - CSV with a column per tense",
+			fields: fields{
+				cardService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("GetTenses").Return([]string{"présent"}, nil)
+					mockService.On("ExportCards").Return([]api.Card{
+						{CardId: 3, Level: 1, Word: "parler", WordType: "verb", Translation: []string{"to speak", "to talk"},
+							Forms: map[string][]string{"présent": {"parle", "parles", "parle", "parlons", "parlez", "parlent"}}},
+					}, nil)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodGet, "/v1/api/cards/export?format=csv", nil)
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody: "word,translations,word_type,gender,level,is_irregular_verb,m.s.,m.p.,f.s.,f.p.,présent\n" +
+				"parler,to speak|to talk,verb,,1,,,,,,parle|parles|parle|parlons|parlez|parlent\n" +
+				"# end of export: 1 cards\n",
+		},
+		{
+			name: "ExportCards - Unsupported format",
+			fields: fields{
+				cardService: new(MockService),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodGet, "/v1/api/cards/export?format=xml", nil)
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"error":"Invalid query parameters"}`,
+		},
+		{
+			name: "ExportCards - Storage error before any card",
+			fields: fields{
+				cardService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("ExportCards").Return([]api.Card{}, fmt.Errorf("storage - ExportCards: connection refused"))
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodGet, "/v1/api/cards/export", nil)
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedBody:       `{"error":"Internal server error"}`,
+		},
+		{
+			name: "RestoreCards - NDJSON export",
+			fields: fields{
+				cardService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("ImportCards", []api.Card{
+						{CardId: 1, Level: 1, Word: "chat", WordType: "regular", Gender: "m", Translation: []string{"cat"}},
+					}, false).Return(api.ImportReport{Updated: 1, Results: []api.ImportResult{
+						{Index: 0, Word: "chat", Gender: "m", Status: api.ImportUpdated, CardId: 7},
+					}}, nil)
+					return mockService
+				}(),
+				userAccountService: withRole(new(MockService), api.Editor),
+			},
+			args: args{
+				request: func() *http.Request {
+					body := `{"card_id":1,"level":1,"word_type":"regular","translations":["cat"],"word":"chat","gender":"m","forms":null,"is_irregular_verb":false}` + "\n" +
+						`{"end_of_export":true,"cards":1}` + "\n"
+					req, _ := http.NewRequest(http.MethodPost, "/v1/api/cards/restore", strings.NewReader(body))
+					req.Header.Set("Content-Type", "application/x-ndjson")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody: `{"data":{"dry_run":false,"created":0,"updated":1,"rejected":0,"results":[` +
+				`{"index":0,"word":"chat","gender":"m","status":"updated","card_id":7}]}}`,
+		},
+		{
+			name: "RestoreCards - Learner is forbidden",
+			fields: fields{
+				cardService:        new(MockService),
+				userAccountService: withRole(new(MockService), api.Learner),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodPost, "/v1/api/cards/restore", strings.NewReader(""))
+					req.Header.Set("Content-Type", "application/x-ndjson")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       `{"error":"Forbidden"}`,
+		},
+		{
+			name: "UpdateUser - Storage validation error",
+			fields: fields{
+				userAccountService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("UpdateUser", "123", mock.Anything).
+						Return(api.User{}, fmt.Errorf("storage - UpdateUser: %w: pq: value too long", api.ErrValidation))
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodPatch, "/v1/api/users/123", strings.NewReader(`{"username":"crabi"}`))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedBody:       `{"error":"Validation failed"}`,
+		},
+		{
+			name: "GetUserStats - Query timeout",
+			fields: fields{
+				userService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("GetStats", "123").Return(map[string]interface{}(nil), fmt.Errorf("storage - CountPendingReviews: %w", context.DeadlineExceeded))
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodGet, "/v1/api/stats/123", nil)
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusGatewayTimeout,
+			expectedBody:       `{"error":"Request timed out"}`,
+		},
+		{
+			name: "SetUserRole - Editor is forbidden",
+			fields: fields{
+				userAccountService: withRole(new(MockService), api.Editor),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodPut, "/v1/api/admin/users/456/role", strings.NewReader(`{"role":"admin"}`))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       `{"error":"Forbidden"}`,
+		},
+		{
+			name: "SetUserRole - Success",
+			fields: fields{
+				userAccountService: func() *MockService {
+					mockService := withRole(new(MockService), api.Admin)
+					mockService.On("SetUserRole", "456", api.Editor).Return(api.User{
+						UserId: "456", Username: "gateur", Email: "gateur@example.com", Level: 1, Scheduler: api.PenaltyStages, Role: api.Editor,
+						DateJoined: time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC),
+					}, nil)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodPut, "/v1/api/admin/users/456/role", strings.NewReader(`{"role":"editor"}`))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"data":{"user_id":"456","username":"gateur","email":"gateur@example.com","level":1,"scheduler":"stages","role":"editor","date_joined":"2024-12-01T00:00:00Z"}}`,
+		},
+		{
+			name: "SetUserRole - Invalid role",
+			fields: fields{
+				userAccountService: withRole(new(MockService), api.Admin),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodPut, "/v1/api/admin/users/456/role", strings.NewReader(`{"role":"root"}`))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"error":"Invalid role"}`,
+		},
+		{
+			name: "SetUserRole - Last admin",
+			fields: fields{
+				userAccountService: func() *MockService {
+					mockService := withRole(new(MockService), api.Admin)
+					mockService.On("SetUserRole", "123", api.Learner).Return(api.User{}, api.ErrLastAdmin)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodPut, "/v1/api/admin/users/123/role", strings.NewReader(`{"role":"learner"}`))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusConflict,
+			expectedBody:       `{"error":"The last admin cannot be demoted"}`,
+		},
+		{
+			name: "SetUserLevel - Editor is forbidden",
+			fields: fields{
+				userAccountService: withRole(new(MockService), api.Editor),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodPut, "/v1/api/admin/users/456/level", strings.NewReader(`{"level":3}`))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       `{"error":"Forbidden"}`,
+		},
+		{
+			name: "SetUserLevel - Success",
+			fields: fields{
+				userAccountService: func() *MockService {
+					mockService := withRole(new(MockService), api.Admin)
+					mockService.On("SetUserLevel", "456", 3).Return(api.User{
+						UserId: "456", Username: "gateur", Email: "gateur@example.com", Level: 3, Scheduler: api.PenaltyStages, Role: api.Learner,
+						DateJoined: time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC),
+					}, nil)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodPut, "/v1/api/admin/users/456/level", strings.NewReader(`{"level":3}`))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"data":{"user_id":"456","username":"gateur","email":"gateur@example.com","level":3,"scheduler":"stages","role":"learner","date_joined":"2024-12-01T00:00:00Z"}}`,
+		},
+		{
+			name: "SetUserLevel - Invalid level",
+			fields: fields{
+				userAccountService: withRole(new(MockService), api.Admin),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodPut, "/v1/api/admin/users/456/level", strings.NewReader(`{"level":0}`))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"error":"Invalid level"}`,
+		},
+		{
+			name: "SetUserLevel - Above the highest card level",
+			fields: fields{
+				userAccountService: func() *MockService {
+					mockService := withRole(new(MockService), api.Admin)
+					mockService.On("SetUserLevel", "456", 99).Return(api.User{}, api.ErrLevelOutOfRange)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodPut, "/v1/api/admin/users/456/level", strings.NewReader(`{"level":99}`))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedBody:       `{"error":"Level is above the highest card level"}`,
+		},
+		{
+			name: "SetUserLevel - Not found",
+			fields: fields{
+				userAccountService: func() *MockService {
+					mockService := withRole(new(MockService), api.Admin)
+					mockService.On("SetUserLevel", "404", 3).Return(api.User{}, nil)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodPut, "/v1/api/admin/users/404/level", strings.NewReader(`{"level":3}`))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusNotFound,
+			expectedBody:       `{"error":"User not found"}`,
+		},
+		{
+			name: "GetUsersByRole - Success",
+			fields: fields{
+				userAccountService: func() *MockService {
+					mockService := withRole(new(MockService), api.Admin)
+					mockService.On("GetUsersByRole", api.Editor).Return([]api.User{}, nil)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodGet, "/v1/api/admin/users?role=editor", nil)
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"data":[]}`,
+		},
+		{
+			name: "ApiKey - Reads any learner's stats with stats:read",
+			fields: fields{
+				userService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("GetStats", "456").Return(map[string]interface{}{"pending_reviews": 3}, nil)
+					return mockService
+				}(),
+				apiKeyService: withApiKey(api.StatsRead),
+			},
+			args: args{
+				request: func() *http.Request {
+					return apiKeyRequest(http.MethodGet, "/v1/api/stats/456", "")
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"data":{"pending_reviews":3}}`,
+		},
+		{
+			name: "ApiKey - Stats without scope",
+			fields: fields{
+				apiKeyService: withApiKey(api.CardsWrite),
+			},
+			args: args{
+				request: func() *http.Request {
+					return apiKeyRequest(http.MethodGet, "/v1/api/stats/456", "")
+				},
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       `{"error":"Forbidden"}`,
+		},
+		{
+			name: "ApiKey - Reviews are user only",
+			fields: fields{
+				apiKeyService: withApiKey(api.CardsWrite, api.StatsRead),
+			},
+			args: args{
+				request: func() *http.Request {
+					return apiKeyRequest(http.MethodGet, "/v1/api/reviews/456", "")
+				},
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       `{"error":"Forbidden"}`,
+		},
+		{
+			name: "ApiKey - Invalid key",
+			fields: fields{
+				apiKeyService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("AuthenticateApiKey", "crabi_test_key").Return(api.ApiKey{}, nil)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					return apiKeyRequest(http.MethodGet, "/v1/api/stats/456", "")
+				},
+			},
+			expectedStatusCode: http.StatusUnauthorized,
+			expectedBody:       `{"error":"Invalid API key"}`,
+		},
+		{
+			name: "ApiKey - Deletes a card with cards:write",
+			fields: fields{
+				cardService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("DeleteCard", 1).Return(nil)
+					return mockService
+				}(),
+				apiKeyService: withApiKey(api.CardsWrite),
+			},
+			args: args{
+				request: func() *http.Request {
+					return apiKeyRequest(http.MethodDelete, "/v1/api/card/1", "")
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name: "ApiKey - Cannot manage keys",
+			fields: fields{
+				apiKeyService: withApiKey(api.CardsWrite, api.StatsRead),
+			},
+			args: args{
+				request: func() *http.Request {
+					return apiKeyRequest(http.MethodGet, "/v1/api/admin/api-keys", "")
+				},
+			},
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       `{"error":"Forbidden"}`,
+		},
+		{
+			name: "CreateApiKey - Success",
+			fields: fields{
+				userAccountService: withRole(new(MockService), api.Admin),
+				apiKeyService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("CreateApiKey", "123", api.NewApiKey{Name: "pipeline", Scopes: []api.Permission{api.CardsWrite}}).
+						Return(api.CreatedApiKey{
+							ApiKey: api.ApiKey{KeyId: 1, Name: "pipeline", Prefix: "0a1b2c3d", Scopes: []api.Permission{api.CardsWrite}, CreatedBy: "123",
+								CreatedAt: time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)},
+							Key: "crabi_0a1b2c3d_secret",
+						}, nil)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodPost, "/v1/api/admin/api-keys", strings.NewReader(`{"name":"pipeline","scopes":["cards:write"]}`))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusCreated,
+			expectedBody:       `{"data":{"key_id":1,"name":"pipeline","prefix":"0a1b2c3d","scopes":["cards:write"],"created_by":"123","created_at":"2024-12-01T00:00:00Z","last_used_at":null,"revoked_at":null,"key":"crabi_0a1b2c3d_secret"}}`,
+		},
+		{
+			name: "CreateApiKey - Scope reserved to users",
+			fields: fields{
+				userAccountService: withRole(new(MockService), api.Admin),
+				apiKeyService:      new(MockService),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodPost, "/v1/api/admin/api-keys", strings.NewReader(`{"name":"pipeline","scopes":["roles:manage"]}`))
+					req.Header.Set("Content-Type", "application/json")
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"error":"Invalid API key format"}`,
+		},
+		{
+			name: "RevokeApiKey - Not found",
+			fields: fields{
+				userAccountService: withRole(new(MockService), api.Admin),
+				apiKeyService: func() *MockService {
+					mockService := new(MockService)
+					mockService.On("RevokeApiKey", 9).Return(false, nil)
+					return mockService
+				}(),
+			},
+			args: args{
+				request: func() *http.Request {
+					req, _ := http.NewRequest(http.MethodDelete, "/v1/api/admin/api-keys/9", nil)
+					return req
+				},
+			},
+			expectedStatusCode: http.StatusNotFound,
+			expectedBody:       `{"error":"API key not found"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUserService := tt.fields.userService
+			mockCardService := tt.fields.cardService
+			mockUserAccountService := tt.fields.userAccountService
+			mockApiKeyService := tt.fields.apiKeyService
+			mockHealthService := tt.fields.healthService
+
+			authenticator, err := app.NewAuthenticator(app.AuthConfig{HS256Secret: testSecret})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			router := gin.Default()
+			server := app.NewServer(router, logging.Discard(), mockUserService, mockCardService, mockUserAccountService, mockApiKeyService, mockHealthService, authenticator, app.ServerConfig{})
+
+			router = server.Routes()
+			server.RegisterValidators()
+
+			// requests act as user 123 unless the test case sets its own credentials
+			req := tt.args.request()
+			if _, ok := req.Header["Authorization"]; !ok {
+				req.Header.Set("Authorization", "Bearer "+signHS256(testClaims("123")))
+			}
 
 			// Perform the request
 			w := httptest.NewRecorder()
-			router.ServeHTTP(w, tt.args.request())
+			router.ServeHTTP(w, req)
 
 			// Validate the response
 			if w.Code != tt.expectedStatusCode {
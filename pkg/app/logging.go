@@ -0,0 +1,109 @@
+package app
+
+import (
+	"crabigateur-api/pkg/api"
+	"crabigateur-api/pkg/logging"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds ids supplied by callers, they end up in every log line
+const maxRequestIDLength = 128
+
+// RequestID reuses the caller's X-Request-ID, e.g. one set by a proxy, or
+// generates one. The id is returned in the response header and stored in the
+// request context so everything logged while serving the request carries it.
+func (s *Server) RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := c.GetHeader(requestIDHeader)
+		if !validRequestID(requestId) {
+			requestId = newRequestID()
+		}
+
+		c.Header(requestIDHeader, requestId)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), requestId))
+		c.Next()
+	}
+}
+
+func validRequestID(requestId string) bool {
+	if requestId == "" || len(requestId) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range requestId {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	// crypto/rand never fails on supported platforms
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// AccessLog logs one line per request once it has been served, with the errors
+// handlers attached to it through handlerError and renderError. Server errors
+// are logged at error level, client errors at warn level.
+func (s *Server) AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+		}
+		if subject := c.GetString(subjectKey); subject != "" {
+			attrs = append(attrs, slog.String("user_id", subject))
+		}
+		if key, ok := c.Get(apiKeyKey); ok {
+			attrs = append(attrs, slog.Int("api_key_id", key.(api.ApiKey).KeyId))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", strings.Join(c.Errors.Errors(), "; ")))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		s.logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// handlerError records why a request was rejected, for the access log
+func handlerError(c *gin.Context, err error) {
+	_ = c.Error(err).SetType(gin.ErrorTypeBind)
+}
+
+// Recovery turns a panic into a 500 and logs it with its stack. It runs inside
+// AccessLog so the failed request is still logged.
+func (s *Server) Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		s.logger.ErrorContext(c.Request.Context(), "panic serving request", "panic", recovered, "stack", string(debug.Stack()))
+		renderError(c, fmt.Errorf("panic: %v", recovered))
+	})
+}
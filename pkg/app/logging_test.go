@@ -0,0 +1,90 @@
+package app_test
+
+import (
+	"bytes"
+	"crabigateur-api/pkg/app"
+	"crabigateur-api/pkg/logging"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name          string
+		requestId     string
+		setup         func(userService *MockService)
+		expectedLevel string
+		expectedError string
+	}{
+		{
+			name:      "Request id supplied by the caller",
+			requestId: "req-42",
+			setup: func(userService *MockService) {
+				userService.On("GetStats", "123").Return(map[string]interface{}{}, nil)
+			},
+			expectedLevel: "INFO",
+		},
+		{
+			name: "Generated request id and service error",
+			setup: func(userService *MockService) {
+				userService.On("GetStats", "123").Return(map[string]interface{}{}, errors.New("storage - GetWordStats: connection reset"))
+			},
+			expectedLevel: "ERROR",
+			expectedError: "storage - GetWordStats: connection reset",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			logger, err := logging.New(&output, logging.Options{Level: "info", Format: "json"})
+			assert.NoError(t, err)
+
+			authenticator, err := app.NewAuthenticator(app.AuthConfig{HS256Secret: testSecret})
+			assert.NoError(t, err)
+
+			userService := new(MockService)
+			tt.setup(userService)
+
+			server := app.NewServer(gin.New(), logger, userService, new(MockService), new(MockService), new(MockService), new(MockService), authenticator, app.ServerConfig{})
+			router := server.Routes()
+
+			req, _ := http.NewRequest(http.MethodGet, "/v1/api/stats/123", nil)
+			req.Header.Set("Authorization", "Bearer "+signHS256(testClaims("123")))
+			if tt.requestId != "" {
+				req.Header.Set("X-Request-ID", tt.requestId)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			requestId := w.Header().Get("X-Request-ID")
+			if tt.requestId != "" {
+				assert.Equal(t, tt.requestId, requestId)
+			} else {
+				assert.Len(t, requestId, 32)
+			}
+
+			var line map[string]interface{}
+			assert.NoError(t, json.Unmarshal(output.Bytes(), &line))
+			assert.Equal(t, tt.expectedLevel, line["level"])
+			assert.Equal(t, "request", line["msg"])
+			assert.Equal(t, requestId, line["request_id"])
+			assert.Equal(t, "/v1/api/stats/:user_id", line["route"])
+			assert.Equal(t, "123", line["user_id"])
+			assert.Equal(t, float64(w.Code), line["status"])
+			assert.Contains(t, line, "latency_ms")
+			if tt.expectedError != "" {
+				assert.Equal(t, tt.expectedError, line["error"])
+			} else {
+				assert.NotContains(t, line, "error")
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package app_test
+
+import (
+	"crabigateur-api/pkg/app"
+	"crabigateur-api/pkg/logging"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	authenticator, err := app.NewAuthenticator(app.AuthConfig{HS256Secret: testSecret})
+	assert.NoError(t, err)
+
+	userService := new(MockService)
+	userService.On("GetStats", "123").Return(map[string]interface{}{}, nil)
+
+	server := app.NewServer(gin.New(), logging.Discard(), userService, new(MockService), new(MockService), new(MockService), new(MockService), authenticator, app.ServerConfig{MetricsToken: "scraper"})
+	router := server.Routes()
+
+	for _, path := range []string{"/v1/api/stats/123", "/v1/api/stats/456", "/wp-login.php"} {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+signHS256(testClaims("123")))
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer scraper")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `crabi_http_requests_total{method="GET",route="/v1/api/stats/:user_id",status="200"}`)
+	assert.Contains(t, body, `crabi_http_requests_total{method="GET",route="/v1/api/stats/:user_id",status="403"}`)
+	assert.Contains(t, body, `crabi_http_requests_total{method="GET",route="unmatched",status="404"}`)
+	assert.Contains(t, body, `crabi_http_request_duration_seconds_count{method="GET",route="/v1/api/stats/:user_id"}`)
+	assert.NotContains(t, body, "wp-login")
+	assert.Contains(t, body, "go_goroutines", "runtime metrics are collected")
+}
+
+func TestMetricsHandler(t *testing.T) {
+	authenticator, err := app.NewAuthenticator(app.AuthConfig{HS256Secret: testSecret})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		expected      int
+	}{
+		{name: "Valid token", token: "scraper", authorization: "Bearer scraper", expected: http.StatusOK},
+		{name: "Missing token", token: "scraper", authorization: "", expected: http.StatusUnauthorized},
+		{name: "Wrong token", token: "scraper", authorization: "Bearer other", expected: http.StatusUnauthorized},
+		{name: "Not served without a token", token: "", authorization: "Bearer ", expected: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := app.NewServer(gin.New(), logging.Discard(), new(MockService), new(MockService), new(MockService), new(MockService), new(MockService), authenticator, app.ServerConfig{MetricsToken: tt.token})
+			router := server.Routes()
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.Header.Set("Authorization", tt.authorization)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expected, w.Code)
+		})
+	}
+}
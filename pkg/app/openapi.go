@@ -0,0 +1,446 @@
+package app
+
+import (
+	"crabigateur-api/pkg/api"
+	"crabigateur-api/pkg/deck"
+	"crabigateur-api/pkg/openapi"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// public overrides the document's security for routes served without credentials
+var public = &[]openapi.SecurityRequirement{}
+
+var errorDescriptions = map[int]string{
+	http.StatusBadRequest:            "Malformed path, query or body",
+	http.StatusUnauthorized:          "Missing or invalid bearer token or API key",
+	http.StatusForbidden:             "The caller may not act on this resource",
+	http.StatusNotFound:              "Not found",
+	http.StatusConflict:              "Duplicate, or conflicts with the current state of the resource",
+	http.StatusRequestEntityTooLarge: "The body exceeds server.max_body_size",
+	http.StatusUnsupportedMediaType:  "Unsupported Content-Type",
+	http.StatusUnprocessableEntity:   "Values rejected by the database",
+	http.StatusInternalServerError:   "Internal server error",
+	http.StatusGatewayTimeout:        "The request ran out of time, see server.query_timeout, or server.bulk_timeout for decks",
+}
+
+// serverErrors may be answered by every route reading the database
+var serverErrors = []int{http.StatusInternalServerError, http.StatusGatewayTimeout}
+
+// OpenAPI documents every route of Routes. TestOpenAPI fails when a route is
+// added without its operation here.
+func OpenAPI() *openapi.Document {
+	doc := openapi.New(openapi.Info{
+		Title:       "crabigateur API",
+		Description: "Spaced repetition of French vocabulary. Successful responses wrap their payload in {\"data\": ...}, failed ones answer {\"error\": \"message\"}.",
+		Version:     "1",
+	})
+
+	doc.RegisterValidation("sortable", func(schema *openapi.Schema) {
+		schema.Items.Enum = []any{api.DateAsc, api.DateDesc, api.LevelAsc, api.LevelDesc}
+		schema.Description = "Sort orders applied in turn, an order cannot be combined with its opposite."
+	})
+	doc.RegisterValidation("username", func(schema *openapi.Schema) {
+		schema.Pattern = api.UsernamePattern
+	})
+
+	doc.Components.SecuritySchemes["bearerAuth"] = openapi.SecurityScheme{
+		Type:         "http",
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+		Description:  "HS256 or RS256 token whose sub claim is the user id",
+	}
+	doc.Components.SecuritySchemes["apiKey"] = openapi.SecurityScheme{
+		Type:        "apiKey",
+		In:          "header",
+		Name:        apiKeyHeader,
+		Description: "Scoped key of a backend service",
+	}
+	doc.Components.SecuritySchemes["metricsToken"] = openapi.SecurityScheme{
+		Type:        "http",
+		Scheme:      "bearer",
+		Description: "The server.metrics_token of the configuration",
+	}
+	doc.Security = []openapi.SecurityRequirement{{"bearerAuth": {}}, {"apiKey": {}}}
+	doc.Components.Schemas["Error"] = doc.Schema(struct {
+		Error string `json:"error" binding:"required"`
+	}{})
+
+	message := doc.Schema("")
+	userPath := doc.Parameters("path", api.UserPath{})
+	cardPath := doc.Parameters("path", api.CardPath{})
+	reviewQuery := doc.Parameters("query", api.QueryParams{})
+
+	// probes, outside of the versioned API
+	doc.Add(http.MethodGet, "/healthz", openapi.Operation{
+		OperationId: "healthz",
+		Summary:     "Liveness probe, answers as long as the process serves requests",
+		Tags:        []string{"operations"},
+		Security:    public,
+		Responses: responses(http.StatusOK, jsonResponse("Alive", doc.Schema(struct {
+			Status string `json:"status"`
+		}{}))),
+	})
+	doc.Add(http.MethodGet, "/readyz", openapi.Operation{
+		OperationId: "readyz",
+		Summary:     "Readiness probe, checks the database, its schema version and its SRS stages",
+		Tags:        []string{"operations"},
+		Security:    public,
+		Responses: map[string]openapi.Response{
+			"200": jsonResponse("Ready to serve traffic", doc.Schema(api.Readiness{})),
+			"503": jsonResponse("A check failed", doc.Schema(api.Readiness{})),
+		},
+	})
+	doc.Add(http.MethodGet, "/metrics", openapi.Operation{
+		OperationId: "metrics",
+		Summary:     "Metrics in the Prometheus text format",
+		Description: "Only served when server.metrics_token is set.",
+		Tags:        []string{"operations"},
+		Security:    &[]openapi.SecurityRequirement{{"metricsToken": {}}},
+		Responses: responses(http.StatusOK, openapi.Response{
+			Description: "Metrics",
+			Content:     map[string]openapi.MediaType{"text/plain": {Schema: doc.Schema("")}},
+		}, 401),
+	})
+	doc.Add(http.MethodGet, "/v1/api/status", openapi.Operation{
+		OperationId: "status",
+		Summary:     "Tells the API is up, without checking its dependencies, see /readyz",
+		Tags:        []string{"operations"},
+		Security:    public,
+		Responses:   responses(http.StatusOK, dataResponse("Running", message)),
+	})
+	doc.Add(http.MethodGet, "/v1/api/openapi.json", openapi.Operation{
+		OperationId: "openapi",
+		Summary:     "This document",
+		Tags:        []string{"operations"},
+		Security:    public,
+		Responses:   responses(http.StatusOK, jsonResponse("OpenAPI 3 document", doc.Schema(map[string]any{}))),
+	})
+
+	// lessons and reviews
+	doc.Add(http.MethodGet, "/v1/api/lessons/:user_id", openapi.Operation{
+		OperationId: "getUserLessons",
+		Summary:     "Cards of the user's level not learnt yet",
+		Tags:        []string{"reviews"},
+		Parameters:  concat(userPath, reviewQuery),
+		Responses: responses(http.StatusOK, dataResponse("Lesson cards", doc.Schema(struct {
+			Cards   []api.Card `json:"cards"`
+			CardIds []int      `json:"card_ids"`
+			Total   int        `json:"total"`
+		}{})), withServerErrors(400, 401, 403)...),
+	})
+	doc.Add(http.MethodGet, "/v1/api/reviews/:user_id", openapi.Operation{
+		OperationId: "getUserReviews",
+		Summary:     "Next card due for review",
+		Tags:        []string{"reviews"},
+		Parameters:  concat(userPath, reviewQuery),
+		Responses: withResponse(
+			responses(http.StatusOK, dataResponse("Card to review", doc.Schema(api.Card{})), withServerErrors(400, 401, 403)...),
+			http.StatusNoContent, openapi.Response{Description: "No card is due"},
+		),
+	})
+	doc.Add(http.MethodPost, "/v1/api/reviews/:user_id", openapi.Operation{
+		OperationId: "postUserReviews",
+		Summary:     "Start reviewing cards learnt in a lesson",
+		Tags:        []string{"reviews"},
+		Parameters:  userPath,
+		RequestBody: jsonBody(doc.Schema(api.QuizList{})),
+		Responses:   responses(http.StatusOK, dataResponse("First review of each card", doc.Schema([]api.ReviewResult{})), withServerErrors(400, 401, 403, 404, 409)...),
+	})
+	doc.Add(http.MethodPut, "/v1/api/reviews/:user_id", openapi.Operation{
+		OperationId: "putUserReviews",
+		Summary:     "Apply a review, retries with the same review_id return the first result",
+		Description: "A retry does not repeat the level_up of the first result.",
+		Tags:        []string{"reviews"},
+		Parameters:  userPath,
+		RequestBody: jsonBody(doc.Schema(api.Review{})),
+		Responses:   responses(http.StatusOK, dataResponse("Review applied", doc.Schema(api.ReviewResult{})), withServerErrors(400, 401, 403, 404, 409)...),
+	})
+	doc.Add(http.MethodPut, "/v1/api/reviews/:user_id/batch", openapi.Operation{
+		OperationId: "putUserReviewsBatch",
+		Summary:     "Apply a review session, oldest review first",
+		Description: "A failed review is reported in its own result without undoing the others.",
+		Tags:        []string{"reviews"},
+		Parameters:  userPath,
+		RequestBody: jsonBody(doc.Schema(api.Reviews{})),
+		Responses:   responses(http.StatusOK, dataResponse("Result of each review, in the submitted order", doc.Schema([]api.BatchReviewResult{})), withServerErrors(400, 401, 403)...),
+	})
+	doc.Add(http.MethodPost, "/v1/api/reviews/:user_id/answer", openapi.Operation{
+		OperationId: "postUserAnswer",
+		Summary:     "Grade an answer and apply the resulting review",
+		Tags:        []string{"reviews"},
+		Parameters:  userPath,
+		RequestBody: jsonBody(doc.Schema(api.Answer{})),
+		Responses:   responses(http.StatusOK, dataResponse("Grade and review", doc.Schema(api.AnswerResult{})), withServerErrors(400, 401, 403, 404, 409, 422)...),
+	})
+	doc.Add(http.MethodGet, "/v1/api/quiz_summary/:user_id", openapi.Operation{
+		OperationId: "getUserQuizSummary",
+		Summary:     "Most recent reviews grouped by SRS stage",
+		Tags:        []string{"reviews"},
+		Parameters:  concat(userPath, reviewQuery),
+		Responses:   responses(http.StatusOK, dataResponse("Reviews by stage", doc.Schema([]api.QuizSummary{})), withServerErrors(400, 401, 403)...),
+	})
+	doc.Add(http.MethodGet, "/v1/api/stats/:user_id", openapi.Operation{
+		OperationId: "getUserStats",
+		Summary:     "Review statistics of a user",
+		Description: "API keys with the stats:read scope can read the stats of any user.",
+		Tags:        []string{"reviews"},
+		Parameters:  userPath,
+		Responses: responses(http.StatusOK, dataResponse("Statistics", doc.Schema(struct {
+			PendingReviews     int                       `json:"pendingReviews"`
+			RecentMistakes     []api.CardTag             `json:"recentMistakes"`
+			LevelProgress      []api.CardProgress        `json:"levelProgress"`
+			WordLevelBreakdown map[string]map[string]int `json:"wordLevelBreakdown"`
+		}{})), withServerErrors(400, 401, 403)...),
+	})
+
+	// users
+	doc.Add(http.MethodPost, "/v1/api/users", openapi.Operation{
+		OperationId: "createUser",
+		Summary:     "Create the account of the authenticated user",
+		Description: "New accounts start on level 1 with the learner role, whatever the payload holds.",
+		Tags:        []string{"users"},
+		RequestBody: jsonBody(doc.Schema(api.User{})),
+		Responses:   responses(http.StatusCreated, dataResponse("Account created", doc.Schema(api.User{})), withServerErrors(400, 401, 403, 409, 422)...),
+	})
+	doc.Add(http.MethodGet, "/v1/api/users/:user_id", openapi.Operation{
+		OperationId: "getUser",
+		Summary:     "Account of the authenticated user",
+		Tags:        []string{"users"},
+		Parameters:  userPath,
+		Responses:   responses(http.StatusOK, dataResponse("Account", doc.Schema(api.User{})), withServerErrors(400, 401, 403, 404)...),
+	})
+	doc.Add(http.MethodPatch, "/v1/api/users/:user_id", openapi.Operation{
+		OperationId: "updateUser",
+		Summary:     "Update the fields given of the authenticated user's account",
+		Tags:        []string{"users"},
+		Parameters:  userPath,
+		RequestBody: jsonBody(doc.Schema(api.UserUpdate{})),
+		Responses:   responses(http.StatusOK, dataResponse("Account updated", doc.Schema(api.User{})), withServerErrors(400, 401, 403, 404, 409, 422)...),
+	})
+	doc.Add(http.MethodDelete, "/v1/api/users/:user_id", openapi.Operation{
+		OperationId: "deleteUser",
+		Summary:     "Delete the authenticated user's account and reviews",
+		Description: "The last admin cannot delete their account.",
+		Tags:        []string{"users"},
+		Parameters:  userPath,
+		Responses:   responses(http.StatusOK, dataResponse("Account deleted", message), withServerErrors(400, 401, 403, 404, 409)...),
+	})
+
+	// cards
+	doc.Add(http.MethodGet, "/v1/api/card/:card_id", openapi.Operation{
+		OperationId: "getCardById",
+		Summary:     "A card with its forms",
+		Tags:        []string{"cards"},
+		Parameters:  cardPath,
+		Responses:   responses(http.StatusOK, dataResponse("Card", doc.Schema(api.Card{})), withServerErrors(400, 401, 404)...),
+	})
+	doc.Add(http.MethodGet, "/v1/api/card/search", openapi.Operation{
+		OperationId: "searchCards",
+		Summary:     "Search cards",
+		Tags:        []string{"cards"},
+		Parameters:  doc.Parameters("query", api.CardQueryParams{}),
+		Responses:   responses(http.StatusOK, dataResponse("Matching cards", doc.Schema([]api.Card{})), withServerErrors(400, 401)...),
+	})
+	doc.Add(http.MethodGet, "/v1/api/card/apkg", openapi.Operation{
+		OperationId: "exportApkg",
+		Summary:     "Export the cards matching a search as an Anki package",
+		Description: "The package holds a single deck of " + deck.AnkiNoteType + " notes, one per card, to study offline in Anki.",
+		Tags:        []string{"cards"},
+		Parameters:  doc.Parameters("query", api.CardQueryParams{}),
+		Responses: responses(http.StatusOK, openapi.Response{
+			Description: "Anki package",
+			Content:     map[string]openapi.MediaType{deck.ApkgContentType: {Schema: &openapi.Schema{Type: "string", Format: "binary"}}},
+		}, withServerErrors(400, 401)...),
+	})
+	doc.Add(http.MethodPost, "/v1/api/card", openapi.Operation{
+		OperationId: "createCard",
+		Summary:     "Create a card, needs the cards:write permission",
+		Description: "A regular verb, without is_irregular_verb, gets the tenses its forms leave out among présent, imparfait, " +
+			"futur simple, conditionnel, passé composé, subjonctif présent and impératif.",
+		Tags:        []string{"cards"},
+		RequestBody: jsonBody(doc.Schema(api.Card{})),
+		Responses:   responses(http.StatusOK, dataResponse("Card created", doc.Schema(api.Card{})), withServerErrors(400, 401, 403, 409, 422)...),
+	})
+	cardFiles := &openapi.RequestBody{
+		Required: true,
+		Content: map[string]openapi.MediaType{
+			"application/json":     {Schema: doc.Schema([]api.Card{})},
+			deck.NDJSONContentType: {Schema: &openapi.Schema{Type: "string"}},
+			"text/csv":             {Schema: &openapi.Schema{Type: "string"}},
+		},
+	}
+	doc.Add(http.MethodPost, "/v1/api/card/import", openapi.Operation{
+		OperationId: "importCards",
+		Summary:     "Create or update cards in bulk, needs the cards:write permission",
+		Description: "Cards matching the word and gender of an existing card update it, the others are created. " +
+			"A CSV file has a header naming its columns: " + strings.Join(deck.CardColumns, ", ") + ", one column per form " +
+			"(m.s., m.p., f.s., f.p.) and one column per tense, e.g. présent. Lists, the translations and the persons " +
+			"of a tense, are separated by " + deck.ListSeparator + ". Rejected cards do not stop the import.",
+		Tags:        []string{"cards"},
+		Parameters:  doc.Parameters("query", api.ImportParams{}),
+		RequestBody: cardFiles,
+		Responses:   responses(http.StatusOK, dataResponse("Outcome of every card", doc.Schema(api.ImportReport{})), withServerErrors(400, 401, 403, 413, 415)...),
+	})
+	doc.Add(http.MethodGet, "/v1/api/cards/export", openapi.Operation{
+		OperationId: "exportCards",
+		Summary:     "Stream every card with its forms and conjugations",
+		Description: "A backup of the cards apart from user data, as NDJSON, one card per line, or CSV in the layout read by " +
+			"the import. A complete export ends with a line counting its cards, {\"end_of_export\":true,\"cards\":12} " +
+			"or # end of export: 12 cards, which an error after the first cards leaves out.",
+		Tags:       []string{"cards"},
+		Parameters: doc.Parameters("query", api.ExportParams{}),
+		Responses: responses(http.StatusOK, openapi.Response{
+			Description: "Every card",
+			Content: map[string]openapi.MediaType{
+				deck.NDJSONContentType: {Schema: &openapi.Schema{Type: "string"}},
+				"text/csv":             {Schema: &openapi.Schema{Type: "string"}},
+			},
+		}, withServerErrors(400, 401)...),
+	})
+	doc.Add(http.MethodPost, "/v1/api/cards/restore", openapi.Operation{
+		OperationId: "restoreCards",
+		Summary:     "Restore an export of the cards, needs the cards:write permission",
+		Description: "Upserts the cards by word and gender like the import, so a deck moves between environments " +
+			"without touching user data. A file whose end of export line does not count its cards is refused.",
+		Tags:        []string{"cards"},
+		Parameters:  doc.Parameters("query", api.ImportParams{}),
+		RequestBody: cardFiles,
+		Responses:   responses(http.StatusOK, dataResponse("Outcome of every card", doc.Schema(api.ImportReport{})), withServerErrors(400, 401, 403, 413, 415)...),
+	})
+	doc.Add(http.MethodPut, "/v1/api/card/:card_id", openapi.Operation{
+		OperationId: "updateCard",
+		Summary:     "Replace a card, needs the cards:write permission",
+		Tags:        []string{"cards"},
+		Parameters:  cardPath,
+		RequestBody: jsonBody(doc.Schema(api.Card{})),
+		Responses:   responses(http.StatusOK, dataResponse("Card updated", doc.Schema(api.Card{})), withServerErrors(400, 401, 403, 404, 409, 422)...),
+	})
+	doc.Add(http.MethodDelete, "/v1/api/card/:card_id", openapi.Operation{
+		OperationId: "deleteCard",
+		Summary:     "Delete a card, needs the cards:write permission",
+		Tags:        []string{"cards"},
+		Parameters:  cardPath,
+		Responses:   responses(http.StatusOK, dataResponse("Card deleted", message), withServerErrors(400, 401, 403, 404, 409)...),
+	})
+
+	// administration
+	doc.Add(http.MethodGet, "/v1/api/admin/users", openapi.Operation{
+		OperationId: "getUsersByRole",
+		Summary:     "Users having a role, needs the roles:manage permission",
+		Tags:        []string{"admin"},
+		Parameters:  doc.Parameters("query", api.RoleQueryParams{}),
+		Responses:   responses(http.StatusOK, dataResponse("Users", doc.Schema([]api.User{})), withServerErrors(400, 401, 403)...),
+	})
+	doc.Add(http.MethodPut, "/v1/api/admin/users/:user_id/role", openapi.Operation{
+		OperationId: "setUserRole",
+		Summary:     "Change the role of a user, needs the roles:manage permission",
+		Tags:        []string{"admin"},
+		Parameters:  userPath,
+		RequestBody: jsonBody(doc.Schema(api.RoleUpdate{})),
+		Responses:   responses(http.StatusOK, dataResponse("User updated", doc.Schema(api.User{})), withServerErrors(400, 401, 403, 404, 409)...),
+	})
+	doc.Add(http.MethodPut, "/v1/api/admin/users/:user_id/level", openapi.Operation{
+		OperationId: "setUserLevel",
+		Summary:     "Move a user to a level, needs the roles:manage permission",
+		Description: "The level cannot be above the highest card level.",
+		Tags:        []string{"admin"},
+		Parameters:  userPath,
+		RequestBody: jsonBody(doc.Schema(api.LevelUpdate{})),
+		Responses:   responses(http.StatusOK, dataResponse("User updated", doc.Schema(api.User{})), withServerErrors(400, 401, 403, 404, 422)...),
+	})
+	doc.Add(http.MethodGet, "/v1/api/admin/api-keys", openapi.Operation{
+		OperationId: "listApiKeys",
+		Summary:     "API keys, revoked ones included, needs the keys:manage permission",
+		Tags:        []string{"admin"},
+		Responses:   responses(http.StatusOK, dataResponse("API keys", doc.Schema([]api.ApiKey{})), withServerErrors(401, 403)...),
+	})
+	doc.Add(http.MethodPost, "/v1/api/admin/api-keys", openapi.Operation{
+		OperationId: "createApiKey",
+		Summary:     "Create an API key, needs the keys:manage permission",
+		Description: "The key is only returned in this response, only its hash is stored.",
+		Tags:        []string{"admin"},
+		RequestBody: jsonBody(doc.Schema(api.NewApiKey{})),
+		Responses:   responses(http.StatusCreated, dataResponse("API key created", doc.Schema(api.CreatedApiKey{})), withServerErrors(400, 401, 403)...),
+	})
+	doc.Add(http.MethodDelete, "/v1/api/admin/api-keys/:key_id", openapi.Operation{
+		OperationId: "revokeApiKey",
+		Summary:     "Revoke an API key, needs the keys:manage permission",
+		Tags:        []string{"admin"},
+		Parameters:  doc.Parameters("path", api.ApiKeyPath{}),
+		Responses:   responses(http.StatusOK, dataResponse("API key revoked", message), withServerErrors(400, 401, 403, 404)...),
+	})
+
+	return doc
+}
+
+func jsonResponse(description string, schema *openapi.Schema) openapi.Response {
+	return openapi.Response{
+		Description: description,
+		Content:     map[string]openapi.MediaType{"application/json": {Schema: schema}},
+	}
+}
+
+// dataResponse wraps schema in the {"data": ...} envelope of the API
+func dataResponse(description string, schema *openapi.Schema) openapi.Response {
+	return jsonResponse(description, &openapi.Schema{
+		Type:       "object",
+		Properties: map[string]*openapi.Schema{"data": schema},
+		Required:   []string{"data"},
+	})
+}
+
+func jsonBody(schema *openapi.Schema) *openapi.RequestBody {
+	return &openapi.RequestBody{
+		Required: true,
+		Content:  map[string]openapi.MediaType{"application/json": {Schema: schema}},
+	}
+}
+
+// responses lists success under status, and the error responses of errorStatuses
+func responses(status int, success openapi.Response, errorStatuses ...int) map[string]openapi.Response {
+	result := map[string]openapi.Response{strconv.Itoa(status): success}
+	for _, errorStatus := range errorStatuses {
+		result[strconv.Itoa(errorStatus)] = jsonResponse(errorDescriptions[errorStatus], &openapi.Schema{Ref: "#/components/schemas/Error"})
+	}
+	return result
+}
+
+func withResponse(responses map[string]openapi.Response, status int, response openapi.Response) map[string]openapi.Response {
+	responses[strconv.Itoa(status)] = response
+	return responses
+}
+
+func withServerErrors(statuses ...int) []int {
+	return append(statuses, serverErrors...)
+}
+
+func concat(parameters ...[]openapi.Parameter) []openapi.Parameter {
+	var result []openapi.Parameter
+	for _, list := range parameters {
+		result = append(result, list...)
+	}
+	return result
+}
+
+// openAPIJSON is marshalled once, the document only depends on the code
+var openAPIJSON = sync.OnceValues(func() ([]byte, error) {
+	return json.Marshal(OpenAPI())
+})
+
+// OpenAPISpec serves the OpenAPI document of the API
+func (s *Server) OpenAPISpec() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		spec, err := openAPIJSON()
+		if err != nil {
+			renderError(c, err)
+			return
+		}
+		c.Data(http.StatusOK, "application/json; charset=utf-8", spec)
+	}
+}
@@ -0,0 +1,88 @@
+package app_test
+
+import (
+	"crabigateur-api/pkg/app"
+	"crabigateur-api/pkg/logging"
+	"crabigateur-api/pkg/openapi"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestOpenAPI fails when a route is served without being documented, or documented without being served
+func TestOpenAPI(t *testing.T) {
+	authenticator, err := app.NewAuthenticator(app.AuthConfig{HS256Secret: testSecret})
+	assert.NoError(t, err)
+
+	// with a metrics token, so that every documented route is served
+	server := app.NewServer(gin.New(), logging.Discard(), new(MockService), new(MockService), new(MockService), new(MockService), new(MockService), authenticator, app.ServerConfig{MetricsToken: "scraper"})
+	router := server.Routes()
+	doc := app.OpenAPI()
+
+	served := make(map[string]bool)
+	for _, route := range router.Routes() {
+		served[route.Method+" "+openapi.Path(route.Path)] = true
+
+		operation, ok := doc.Operation(route.Method, route.Path)
+		if !assert.True(t, ok, "%s %s has no operation in app.OpenAPI", route.Method, route.Path) {
+			continue
+		}
+		assert.NotEmpty(t, operation.Summary, "%s %s", route.Method, route.Path)
+		assert.NotEmpty(t, operation.Responses, "%s %s", route.Method, route.Path)
+
+		for _, parameter := range operation.Parameters {
+			if parameter.In == "path" {
+				assert.Contains(t, route.Path, ":"+parameter.Name, "%s %s", route.Method, route.Path)
+			}
+		}
+	}
+
+	for path, item := range doc.Paths {
+		for method := range item {
+			assert.True(t, served[strings.ToUpper(method)+" "+path], "%s %s is documented but not served", method, path)
+		}
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	authenticator, err := app.NewAuthenticator(app.AuthConfig{HS256Secret: testSecret})
+	assert.NoError(t, err)
+
+	server := app.NewServer(gin.New(), logging.Discard(), new(MockService), new(MockService), new(MockService), new(MockService), new(MockService), authenticator, app.ServerConfig{})
+	router := server.Routes()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/api/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "the document is public")
+
+	var doc struct {
+		OpenAPI    string `json:"openapi"`
+		Components struct {
+			Schemas map[string]openapi.Schema `json:"schemas"`
+		} `json:"components"`
+		Paths map[string]map[string]openapi.Operation `json:"paths"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, openapi.Version, doc.OpenAPI)
+
+	// binding constraints end up in the schemas
+	review := doc.Components.Schemas["Review"]
+	assert.ElementsMatch(t, []string{"card_id", "review_date", "success", "incorrect_count"}, review.Required)
+	assert.Equal(t, 0.0, *review.Properties["incorrect_count"].Minimum)
+	assert.Equal(t, "uuid", review.Properties["review_id"].Format)
+	assert.Equal(t, 500, *doc.Components.Schemas["Reviews"].Properties["reviews"].MaxItems)
+
+	var sort openapi.Parameter
+	for _, parameter := range doc.Paths["/v1/api/reviews/{user_id}"]["get"].Parameters {
+		if parameter.Name == "sort" {
+			sort = parameter
+		}
+	}
+	assert.Equal(t, "query", sort.In)
+	assert.Equal(t, []any{"date_asc", "date_desc", "level_asc", "level_desc"}, sort.Schema.Items.Enum)
+}
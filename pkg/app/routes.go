@@ -1,34 +1,94 @@
 package app
 
-import "github.com/gin-gonic/gin"
+import (
+	"crabigateur-api/pkg/api"
+
+	"github.com/gin-gonic/gin"
+)
 
 func (s *Server) Routes() *gin.Engine {
 	router := s.router
+	router.Use(s.RequestID(), s.AccessLog(), s.Metrics(), s.RenderErrors(), s.Recovery())
+	timeout := s.QueryTimeout()
+
+	// probes of the orchestrator, outside of the versioned API
+	router.GET("/healthz", timeout, s.Healthz())
+	router.GET("/readyz", timeout, s.Readyz())
+	if s.config.MetricsToken != "" {
+		router.GET("/metrics", s.MetricsHandler())
+	}
 
 	// group all routes under /v1/api
-	v1 := router.Group("/v1/api")
+	v1 := router.Group("/v1/api", timeout)
 	{
 		v1.GET("/status", s.ApiStatus())
-		v1.GET("/lessons/:user_id", s.GetUserLessons())
+		v1.GET("/openapi.json", s.OpenAPISpec())
+
+		// every other route needs a bearer token or an API key, and routes
+		// taking a :user_id only operate on the authenticated user
+		authenticated := v1.Group("", s.Authenticate())
+		self := s.AuthorizeUser()
+
+		authenticated.GET("/lessons/:user_id", self, s.GetUserLessons())
 
-		reviews := v1.Group("/reviews")
+		reviews := authenticated.Group("/reviews", self)
 		{
 			reviews.GET("/:user_id", s.GetUserReviews())
 			reviews.POST("/:user_id", s.PostUserReviews())
 			reviews.PUT("/:user_id", s.PutUserReviews())
+			reviews.PUT("/:user_id/batch", s.PutUserReviewsBatch())
+			reviews.POST("/:user_id/answer", s.PostUserAnswer())
 		}
 
-		v1.GET("/quiz_summary/:user_id", s.GetUserQuizSummary())
-		v1.GET("/stats/:user_id", s.GetUserStats())
+		users := authenticated.Group("/users")
+		{
+			users.POST("", s.CreateUser())
+			users.GET("/:user_id", self, s.GetUser())
+			users.PATCH("/:user_id", self, s.UpdateUser())
+			users.DELETE("/:user_id", self, s.DeleteUser())
+		}
+
+		authenticated.GET("/quiz_summary/:user_id", self, s.GetUserQuizSummary())
+		authenticated.GET("/stats/:user_id", s.AuthorizeUser(api.StatsRead), s.GetUserStats())
 
-		card := v1.Group("/card")
+		// any user can read cards, writing them needs an editor or admin role
+		card := authenticated.Group("/card")
 		{
+			cardsWrite := s.RequirePermission(api.CardsWrite)
+
 			card.GET("/:card_id", s.GetCardById())
-			card.POST("", s.CreateCard())
-			card.PUT("/:card_id", s.UpdateCard())
-			card.DELETE("/:card_id", s.DeleteCard())
+			card.POST("", cardsWrite, s.CreateCard())
+			card.PUT("/:card_id", cardsWrite, s.UpdateCard())
+			card.DELETE("/:card_id", cardsWrite, s.DeleteCard())
 			card.GET("/search", s.SearchCards())
 		}
+
+		admin := authenticated.Group("/admin", s.RequirePermission(api.RolesManage))
+		{
+			admin.GET("/users", s.GetUsersByRole())
+			admin.PUT("/users/:user_id/role", s.SetUserRole())
+			admin.PUT("/users/:user_id/level", s.SetUserLevel())
+		}
+
+		apiKeys := authenticated.Group("/admin/api-keys", s.RequirePermission(api.KeysManage))
+		{
+			apiKeys.GET("", s.ListApiKeys())
+			apiKeys.POST("", s.CreateApiKey())
+			apiKeys.DELETE("/:key_id", s.RevokeApiKey())
+		}
+	}
+
+	// routes moving whole decks or packages, under BulkTimeout rather than QueryTimeout.
+	// Export and restore are backups of the content tables, to move decks
+	// between environments.
+	bulk := router.Group("/v1/api", s.Bulk(), s.Authenticate())
+	{
+		cardsWrite := s.RequirePermission(api.CardsWrite)
+
+		bulk.POST("/card/import", cardsWrite, s.ImportCards())
+		bulk.GET("/cards/export", s.ExportCards())
+		bulk.GET("/card/apkg", s.ExportApkg())
+		bulk.POST("/cards/restore", cardsWrite, s.ImportCards())
 	}
 
 	return router
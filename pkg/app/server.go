@@ -1,8 +1,14 @@
 package app
 
 import (
+	"context"
 	"crabigateur-api/pkg/api"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
@@ -10,37 +16,215 @@ import (
 )
 
 type Server struct {
-	router *gin.Engine
-	userService api.UserService
-	cardService api.CardService
+	router             *gin.Engine
+	logger             *slog.Logger
+	userService        api.UserService
+	cardService        api.CardService
+	userAccountService api.UserAccountService
+	apiKeyService      api.ApiKeyService
+	healthService      api.HealthService
+	authenticator      *Authenticator
+	config             ServerConfig
 }
 
-func NewServer(router *gin.Engine, userService api.UserService, cardService api.CardService) *Server{
+// ServerConfig holds the settings of a Server that are chosen at startup
+type ServerConfig struct {
+	// Addr is the TCP address to listen on, e.g. ":8080"
+	Addr string
+
+	// ReadTimeout, WriteTimeout and IdleTimeout are those of http.Server, 0
+	// means no timeout. WriteTimeout should leave room for QueryTimeout.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+
+	// ShutdownTimeout bounds how long in-flight requests are waited for once
+	// the server is asked to stop
+	ShutdownTimeout time.Duration
+
+	// TLSCertFile and TLSKeyFile are PEM files, the server speaks plain HTTP
+	// when they are empty
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// QueryTimeout bounds how long the queries of a single request may run,
+	// no timeout is applied when it is 0
+	QueryTimeout time.Duration
+
+	// BulkTimeout takes the place of QueryTimeout, ReadTimeout and WriteTimeout
+	// on the routes moving whole decks, the export, restore and import of
+	// cards. No timeout is applied when it is 0.
+	BulkTimeout time.Duration
+
+	// MaxBodySize bounds the card files those routes read, in bytes, there is
+	// no limit when it is 0
+	MaxBodySize int64
+
+	// MetricsToken is the bearer token /metrics is scraped with, the route
+	// is not served when it is empty
+	MetricsToken string
+}
+
+// DefaultServerConfig serves plain HTTP on :8080
+var DefaultServerConfig = ServerConfig{
+	Addr:            ":8080",
+	ReadTimeout:     15 * time.Second,
+	WriteTimeout:    30 * time.Second,
+	IdleTimeout:     60 * time.Second,
+	ShutdownTimeout: 30 * time.Second,
+	QueryTimeout:    5 * time.Second,
+	BulkTimeout:     5 * time.Minute,
+	MaxBodySize:     32 << 20,
+}
+
+func (c ServerConfig) Validate() error {
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return fmt.Errorf("server: a TLS certificate and key must be given together")
+	}
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 || c.ShutdownTimeout < 0 || c.QueryTimeout < 0 || c.BulkTimeout < 0 {
+		return fmt.Errorf("server: timeouts cannot be negative")
+	}
+	if c.WriteTimeout > 0 && c.QueryTimeout > c.WriteTimeout {
+		return fmt.Errorf("server: the query timeout (%s) exceeds the write timeout (%s)", c.QueryTimeout, c.WriteTimeout)
+	}
+	if c.MaxBodySize < 0 {
+		return fmt.Errorf("server: the maximum body size cannot be negative")
+	}
+	return nil
+}
+
+func NewServer(router *gin.Engine, logger *slog.Logger, userService api.UserService, cardService api.CardService, userAccountService api.UserAccountService, apiKeyService api.ApiKeyService, healthService api.HealthService, authenticator *Authenticator, config ServerConfig) *Server {
 	return &Server{
-		router: router,
-		userService: userService,
-		cardService: cardService,
+		router:             router,
+		logger:             logger,
+		userService:        userService,
+		cardService:        cardService,
+		userAccountService: userAccountService,
+		apiKeyService:      apiKeyService,
+		healthService:      healthService,
+		authenticator:      authenticator,
+		config:             config,
 	}
 }
 
-func (s *Server) Run() error {
+// Run listens on the configured address and serves until ctx is cancelled,
+// then stops accepting connections and waits for in-flight requests to finish,
+// for up to ShutdownTimeout.
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		return fmt.Errorf("server - listen: %w", err)
+	}
+
+	return s.Serve(ctx, listener)
+}
+
+// Serve is Run on an existing listener, which it closes
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
 	// run function that initializes the routes
 	r := s.Routes()
 	s.RegisterValidators()
 
-	// run the server through the router
-	err := r.Run()
-	if err != nil {
-		log.Printf("Server - there was an error calling Run on router: %v", err)
-		return err
+	httpServer := &http.Server{
+		Handler:      r,
+		ReadTimeout:  s.config.ReadTimeout,
+		WriteTimeout: s.config.WriteTimeout,
+		IdleTimeout:  s.config.IdleTimeout,
+		ErrorLog:     slog.NewLogLogger(s.logger.Handler(), slog.LevelWarn),
+	}
+
+	useTLS := s.config.TLSCertFile != ""
+	serveErr := make(chan error, 1)
+	go func() {
+		if useTLS {
+			serveErr <- httpServer.ServeTLS(listener, s.config.TLSCertFile, s.config.TLSKeyFile)
+		} else {
+			serveErr <- httpServer.Serve(listener)
+		}
+	}()
+	s.logger.Info("server - listening", "addr", listener.Addr().String(), "tls", useTLS)
+
+	select {
+	case err := <-serveErr:
+		// the server stopped on its own, e.g. an unreadable certificate
+		s.logger.Error("server - serve", "error", err)
+		return fmt.Errorf("server - serve: %w", err)
+	case <-ctx.Done():
+	}
+
+	s.logger.Info("server - shutting down, draining in-flight requests", "timeout", s.config.ShutdownTimeout)
+
+	shutdownCtx := context.Background()
+	if s.config.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, s.config.ShutdownTimeout)
+		defer cancel()
+	}
+
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		// requests still running past the timeout are cut off
+		httpServer.Close()
+		return fmt.Errorf("server - shutdown: %w", err)
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("server - serve: %w", err)
 	}
 
+	s.logger.Info("server - stopped")
 	return nil
 }
 
+// QueryTimeout sets a deadline on the request context. Queries run with that
+// context, so they are cancelled once it passes, or when the client goes away.
+func (s *Server) QueryTimeout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.config.QueryTimeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), s.config.QueryTimeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// Bulk bounds a route moving a whole deck by BulkTimeout, which it also gives
+// to reading the request and, past its last query, to writing the response.
+// The body it reads is limited to MaxBodySize.
+func (s *Server) Bulk() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.config.MaxBodySize > 0 {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, s.config.MaxBodySize)
+		}
+
+		// a zero deadline lifts those of the http.Server
+		var readDeadline, writeDeadline time.Time
+		if s.config.BulkTimeout > 0 {
+			readDeadline = time.Now().Add(s.config.BulkTimeout)
+			writeDeadline = readDeadline.Add(s.config.WriteTimeout)
+
+			ctx, cancel := context.WithDeadline(c.Request.Context(), readDeadline)
+			defer cancel()
+			c.Request = c.Request.WithContext(ctx)
+		}
+
+		controller := http.NewResponseController(c.Writer)
+		err := errors.Join(controller.SetReadDeadline(readDeadline), controller.SetWriteDeadline(writeDeadline))
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			s.logger.WarnContext(c.Request.Context(), "server - bulk deadlines", "error", err)
+		}
+
+		c.Next()
+	}
+}
+
 func (s *Server) RegisterValidators() {
 	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
 		v.RegisterValidation("sortable", api.ValidSortOrders)
+		v.RegisterValidation("username", api.ValidUsername)
 		v.RegisterStructValidation(api.CardStructValidation, api.Card{})
 	}
-}
\ No newline at end of file
+}
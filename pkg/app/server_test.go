@@ -0,0 +1,210 @@
+package app_test
+
+import (
+	"context"
+	"crabigateur-api/pkg/api"
+	"crabigateur-api/pkg/app"
+	"crabigateur-api/pkg/deck"
+	"crabigateur-api/pkg/logging"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// contextUserService records the context GetStats is called with
+type contextUserService struct {
+	*MockService
+	ctx context.Context
+}
+
+func (m *contextUserService) GetStats(ctx context.Context, userId string) (map[string]interface{}, error) {
+	m.ctx = ctx
+	return map[string]interface{}{}, nil
+}
+
+func TestQueryTimeout(t *testing.T) {
+	tests := []struct {
+		name         string
+		queryTimeout time.Duration
+		hasDeadline  bool
+	}{
+		{name: "Timeout configured", queryTimeout: time.Second, hasDeadline: true},
+		{name: "No timeout", queryTimeout: 0, hasDeadline: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator, err := app.NewAuthenticator(app.AuthConfig{HS256Secret: testSecret})
+			assert.NoError(t, err)
+
+			userService := &contextUserService{MockService: new(MockService)}
+			server := app.NewServer(gin.New(), logging.Discard(), userService, new(MockService), new(MockService), new(MockService), new(MockService), authenticator, app.ServerConfig{QueryTimeout: tt.queryTimeout})
+			router := server.Routes()
+
+			req, _ := http.NewRequest(http.MethodGet, "/v1/api/stats/123", nil)
+			req.Header.Set("Authorization", "Bearer "+signHS256(testClaims("123")))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			deadline, ok := userService.ctx.Deadline()
+			assert.Equal(t, tt.hasDeadline, ok)
+			if tt.hasDeadline {
+				assert.WithinDuration(t, time.Now().Add(tt.queryTimeout), deadline, tt.queryTimeout)
+			}
+			// the request id set by the middleware travels with the same context
+			assert.Equal(t, w.Header().Get("X-Request-ID"), logging.RequestID(userService.ctx))
+		})
+	}
+}
+
+// contextCardService records the context ExportCards and SearchCards are called with
+type contextCardService struct {
+	*MockService
+	ctx context.Context
+}
+
+func (m *contextCardService) ExportCards(ctx context.Context, fn func(api.Card) error) error {
+	m.ctx = ctx
+	return nil
+}
+
+func (m *contextCardService) SearchCards(ctx context.Context, params api.CardQueryParams) ([]api.Card, error) {
+	m.ctx = ctx
+	return []api.Card{}, nil
+}
+
+func TestBulk(t *testing.T) {
+	authenticator, err := app.NewAuthenticator(app.AuthConfig{HS256Secret: testSecret})
+	assert.NoError(t, err)
+
+	cardService := &contextCardService{MockService: new(MockService)}
+	config := app.ServerConfig{QueryTimeout: time.Second, BulkTimeout: time.Minute, MaxBodySize: 64}
+	server := app.NewServer(gin.New(), logging.Discard(), new(MockService), cardService, withRole(new(MockService), api.Editor), new(MockService), new(MockService), authenticator, config)
+	router := server.Routes()
+
+	t.Run("Export runs under the bulk timeout", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/v1/api/cards/export", nil)
+		req.Header.Set("Authorization", "Bearer "+signHS256(testClaims("123")))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		deadline, ok := cardService.ctx.Deadline()
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+	})
+
+	t.Run("Anki package runs under the bulk timeout", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/v1/api/card/apkg", nil)
+		req.Header.Set("Authorization", "Bearer "+signHS256(testClaims("123")))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, deck.ApkgContentType, w.Header().Get("Content-Type"))
+		deadline, ok := cardService.ctx.Deadline()
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+	})
+
+	t.Run("Card file larger than the maximum body size", func(t *testing.T) {
+		body := strings.Repeat(`{"word":"chat","level":1}`+"\n", 10)
+		req, _ := http.NewRequest(http.MethodPost, "/v1/api/cards/restore", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+signHS256(testClaims("123")))
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Equal(t, `{"error":"Card file is larger than 64 bytes"}`, w.Body.String())
+	})
+}
+
+func TestServe_GracefulShutdown(t *testing.T) {
+	authenticator, err := app.NewAuthenticator(app.AuthConfig{HS256Secret: testSecret})
+	assert.NoError(t, err)
+
+	started := make(chan struct{})
+	userService := new(MockService)
+	userService.On("GetStats", "123").Run(func(mock.Arguments) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+	}).Return(map[string]interface{}{"pendingReviews": 1}, nil)
+
+	config := app.DefaultServerConfig
+	config.ShutdownTimeout = 5 * time.Second
+	server := app.NewServer(gin.New(), logging.Discard(), userService, new(MockService), new(MockService), new(MockService), new(MockService), authenticator, config)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ctx, listener)
+	}()
+
+	type response struct {
+		status int
+		body   string
+		err    error
+	}
+	responses := make(chan response, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+listener.Addr().String()+"/v1/api/stats/123", nil)
+		req.Header.Set("Authorization", "Bearer "+signHS256(testClaims("123")))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			responses <- response{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- response{status: resp.StatusCode, body: string(body), err: err}
+	}()
+
+	// stop the server while the request is being served
+	<-started
+	cancel()
+
+	resp := <-responses
+	assert.NoError(t, resp.err)
+	assert.Equal(t, http.StatusOK, resp.status, "the in-flight request is drained")
+	assert.Equal(t, `{"data":{"pendingReviews":1}}`, resp.body)
+
+	assert.NoError(t, <-served)
+
+	// and new connections are refused
+	_, err = net.DialTimeout("tcp", listener.Addr().String(), time.Second)
+	assert.Error(t, err)
+}
+
+func TestServerConfig_Validate(t *testing.T) {
+	config := app.DefaultServerConfig
+	assert.NoError(t, config.Validate())
+
+	config.TLSCertFile = "cert.pem"
+	assert.Error(t, config.Validate(), "a certificate needs its key")
+
+	config.TLSKeyFile = "key.pem"
+	assert.NoError(t, config.Validate())
+
+	config.QueryTimeout = time.Minute
+	assert.Error(t, config.Validate(), "queries cannot outlive the response")
+
+	config.QueryTimeout = time.Second
+	config.BulkTimeout = time.Hour
+	assert.NoError(t, config.Validate(), "bulk routes extend the write deadline")
+
+	config.MaxBodySize = -1
+	assert.Error(t, config.Validate())
+}
@@ -0,0 +1,162 @@
+package config_test
+
+import (
+	"bytes"
+	"crabigateur-api/pkg/api"
+	"crabigateur-api/pkg/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	yamlFile := writeFile(t, "config.yaml", `
+database:
+  dsn: host=db user=crabi
+  max_open_conns: 50
+server:
+  addr: ":9090"
+  query_timeout: 2s
+cors:
+  allowed_origins: [https://crabi.example]
+`)
+	tomlFile := writeFile(t, "config.toml", `
+[database]
+dsn = "host=db user=crabi"
+max_open_conns = 50
+
+[server]
+addr = ":9090"
+query_timeout = "2s"
+
+[cors]
+allowed_origins = ["https://crabi.example"]
+`)
+
+	for _, path := range []string{yamlFile, tomlFile} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			cfg, err := config.Load(path, env(map[string]string{
+				"CRABI_SERVER_ADDR":              ":7070",
+				"CRABI_DATABASE_MIGRATE":         "true",
+				"CRABI_CORS_ALLOWED_ORIGINS":     "https://a.example, https://b.example",
+				"CRABI_SCHEDULER_LEVEL_UP_STAGE": "6",
+				"CRABI_SCHEDULER_DEFAULT":        "fsrs",
+				"JWT_HS256_SECRET":               testSecret,
+			}))
+			assert.NoError(t, err)
+
+			assert.Equal(t, "host=db user=crabi", cfg.Database.DSN)
+			assert.Equal(t, 50, cfg.Database.MaxOpenConns)
+			assert.Equal(t, config.Default().Database.MaxIdleConns, cfg.Database.MaxIdleConns)
+			assert.True(t, cfg.Database.Migrate)
+			assert.Equal(t, ":7070", cfg.Server.Addr, "environment overrides the file")
+			assert.Equal(t, 2*time.Second, cfg.Server.QueryTimeout)
+			assert.Equal(t, []string{"https://a.example", "https://b.example"}, cfg.CORS.AllowedOrigins)
+			assert.Equal(t, 6, cfg.Scheduler.LevelUpStage)
+			assert.Equal(t, api.FSRS, cfg.DefaultScheduler())
+			assert.Equal(t, testSecret, cfg.Auth.HS256Secret)
+			assert.NoError(t, cfg.Validate())
+		})
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	_, err := config.Load(writeFile(t, "config.yaml", "server:\n  adr: \":9090\"\n"), env(nil))
+	assert.ErrorContains(t, err, "adr", "unknown keys are rejected")
+
+	_, err = config.Load("", env(map[string]string{"CRABI_DATABASE_MAX_OPEN_CONNS": "many"}))
+	assert.ErrorContains(t, err, "CRABI_DATABASE_MAX_OPEN_CONNS")
+
+	_, err = config.Load(filepath.Join(t.TempDir(), "missing.yaml"), env(nil))
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	valid := config.Default()
+	valid.Auth.HS256Secret = testSecret
+	assert.NoError(t, valid.Validate())
+
+	tests := []struct {
+		name   string
+		modify func(*config.Config)
+	}{
+		{name: "No auth key", modify: func(c *config.Config) { c.Auth.HS256Secret = "" }},
+		{name: "More idle than open connections", modify: func(c *config.Config) { c.Database.MaxIdleConns = 100 }},
+		{name: "Unknown log level", modify: func(c *config.Config) { c.Log.Level = "verbose" }},
+		{name: "Origin with a path", modify: func(c *config.Config) { c.CORS.AllowedOrigins = []string{"https://crabi.example/app"} }},
+		{name: "No origin", modify: func(c *config.Config) { c.CORS.AllowedOrigins = nil }},
+		{name: "Certificate without key", modify: func(c *config.Config) { c.Server.TLSCertFile = "cert.pem" }},
+		{name: "Unknown default scheduler", modify: func(c *config.Config) { c.Scheduler.Default = "leitner" }},
+		{name: "Retention of 1", modify: func(c *config.Config) { c.Scheduler.FSRSDesiredRetention = 1 }},
+		{name: "Level up fraction above 1", modify: func(c *config.Config) { c.Scheduler.LevelUpFraction = 1.5 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			tt.modify(&cfg)
+			assert.Error(t, cfg.Validate())
+		})
+	}
+}
+
+func TestPrint_RedactsSecrets(t *testing.T) {
+	tests := []struct {
+		dsn      string
+		expected string
+	}{
+		{
+			dsn:      "host=db user=crabi password=gateur dbname=crabigateur",
+			expected: "host=db user=crabi password=REDACTED dbname=crabigateur",
+		},
+		{
+			dsn:      "host=db password='with space' dbname=crabigateur",
+			expected: "host=db password=REDACTED dbname=crabigateur",
+		},
+		{
+			dsn:      "postgres://crabi:gateur@db:5432/crabigateur?sslmode=disable",
+			expected: "postgres://crabi:REDACTED@db:5432/crabigateur?sslmode=disable",
+		},
+		{
+			dsn:      "host=db user=crabi",
+			expected: "host=db user=crabi",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dsn, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Database.DSN = tt.dsn
+			cfg.Auth.HS256Secret = testSecret
+
+			var out bytes.Buffer
+			assert.NoError(t, cfg.Print(&out))
+			assert.Contains(t, out.String(), tt.expected)
+			assert.NotContains(t, out.String(), "gateur@")
+			assert.NotContains(t, out.String(), testSecret)
+			assert.Contains(t, out.String(), "hs256_secret: REDACTED")
+
+			assert.Equal(t, tt.dsn, cfg.Database.DSN, "the configuration itself is left intact")
+		})
+	}
+}
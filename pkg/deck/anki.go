@@ -0,0 +1,702 @@
+package deck
+
+import (
+	"archive/zip"
+	"context"
+	"crabigateur-api/pkg/api"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// AnkiNoteType is the name of the note type of exported decks. When importing
+// its notes, every field after the fields of a card is read as a tense.
+const AnkiNoteType = "Crabigateur"
+
+// ApkgContentType is the media type Anki packages are served with
+const ApkgContentType = "application/apkg"
+
+const (
+	ankiFieldWord         = "Word"
+	ankiFieldTranslations = "Translations"
+	ankiFieldGender       = "Gender"
+	ankiFieldWordType     = "Word type"
+	ankiFieldLevel        = "Level"
+
+	// fixed ids, so that importing a newer export in Anki updates the note
+	// type and deck of the previous one instead of duplicating them
+	ankiModelId int64 = 1735689600000
+	ankiDeckId  int64 = 1735689600001
+)
+
+var ankiCardFields = []string{ankiFieldWord, ankiFieldTranslations, ankiFieldGender, ankiFieldWordType, ankiFieldLevel}
+
+// AnkiOptions tell which note fields hold the fields of a card. Empty field
+// names are guessed from common names, e.g. Front or French for the word.
+type AnkiOptions struct {
+	WordField         string
+	TranslationsField string
+	GenderField       string
+	Level             int   // of cards without a Level field, 1 by default
+	MaxCollectionSize int64 // extracted size of the collection, 256 MiB by default
+}
+
+// DefaultMaxCollectionSize bounds the extracted collection of a package when
+// AnkiOptions leave it out
+const DefaultMaxCollectionSize = 256 << 20
+
+var (
+	ankiWordFields         = []string{ankiFieldWord, "Front", "French", "Français"}
+	ankiTranslationsFields = []string{ankiFieldTranslations, "Back", "English", "Meaning", "Translation"}
+	ankiGenderFields       = []string{ankiFieldGender, "Genre"}
+)
+
+type AnkiDeck struct {
+	Cards []api.Card
+	// History holds the reviews of each card, by index in Cards. Their CardId
+	// is set once the card is stored, see ImportAnkiHistory.
+	History [][]api.Review
+}
+
+// ReadApkg reads the notes of an Anki package, a zip holding the SQLite
+// database of a collection, as cards, one per note, with the review history of
+// their Anki cards. Notes without a word are skipped. Anki 2.1.50 and later
+// only write a collection this can read when exporting with "Support older
+// Anki versions".
+func ReadApkg(r io.ReaderAt, size int64, options AnkiOptions) (AnkiDeck, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return AnkiDeck{}, fmt.Errorf("deck - ReadApkg: %w", err)
+	}
+
+	var collection *zip.File
+	for _, name := range []string{"collection.anki21", "collection.anki2"} {
+		if collection = findFile(archive, name); collection != nil {
+			break
+		}
+	}
+	if collection == nil {
+		if findFile(archive, "collection.anki21b") != nil {
+			return AnkiDeck{}, errors.New(`deck - ReadApkg: unsupported collection format, export the deck again with "Support older Anki versions"`)
+		}
+		return AnkiDeck{}, errors.New("deck - ReadApkg: no collection in the package")
+	}
+
+	dir, err := os.MkdirTemp("", "crabi-apkg-")
+	if err != nil {
+		return AnkiDeck{}, fmt.Errorf("deck - ReadApkg: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	maxSize := options.MaxCollectionSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxCollectionSize
+	}
+	path := filepath.Join(dir, "collection.anki2")
+	if err := extractFile(collection, path, maxSize); err != nil {
+		return AnkiDeck{}, fmt.Errorf("deck - ReadApkg: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return AnkiDeck{}, fmt.Errorf("deck - ReadApkg: %w", err)
+	}
+	defer db.Close()
+
+	deck, err := readCollection(db, options)
+	if err != nil {
+		return AnkiDeck{}, fmt.Errorf("deck - ReadApkg: %w", err)
+	}
+	return deck, nil
+}
+
+func findFile(archive *zip.Reader, name string) *zip.File {
+	for _, file := range archive.File {
+		if file.Name == name {
+			return file
+		}
+	}
+	return nil
+}
+
+// extractFile writes the content of file to path, refusing content larger than
+// maxSize, whatever size the archive declares
+func extractFile(file *zip.File, path string, maxSize int64) error {
+	if file.UncompressedSize64 > uint64(maxSize) {
+		return fmt.Errorf("%s is larger than %d bytes", file.Name, maxSize)
+	}
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	written, err := io.CopyN(dst, src, maxSize+1)
+	if err != nil && err != io.EOF {
+		dst.Close()
+		return err
+	}
+	if written > maxSize {
+		dst.Close()
+		return fmt.Errorf("%s is larger than %d bytes", file.Name, maxSize)
+	}
+	return dst.Close()
+}
+
+type ankiModel struct {
+	Name   string      `json:"name"`
+	Fields []ankiField `json:"flds"`
+}
+
+type ankiField struct {
+	Name string `json:"name"`
+	Ord  int    `json:"ord"`
+}
+
+func readCollection(db *sql.DB, options AnkiOptions) (AnkiDeck, error) {
+	var modelsJSON string
+	if err := db.QueryRow("SELECT models FROM col").Scan(&modelsJSON); err != nil {
+		return AnkiDeck{}, fmt.Errorf("collection: %w", err)
+	}
+	var models map[string]ankiModel
+	if err := json.Unmarshal([]byte(modelsJSON), &models); err != nil {
+		return AnkiDeck{}, fmt.Errorf("note types: %w", err)
+	}
+
+	rows, err := db.Query("SELECT id, mid, flds FROM notes ORDER BY id")
+	if err != nil {
+		return AnkiDeck{}, fmt.Errorf("notes: %w", err)
+	}
+	defer rows.Close()
+
+	var deck AnkiDeck
+	noteIndex := make(map[int64]int)
+	for rows.Next() {
+		var noteId, modelId int64
+		var fields string
+		if err := rows.Scan(&noteId, &modelId, &fields); err != nil {
+			return AnkiDeck{}, fmt.Errorf("notes: %w", err)
+		}
+
+		model, ok := models[strconv.FormatInt(modelId, 10)]
+		if !ok {
+			return AnkiDeck{}, fmt.Errorf("note %d: unknown note type %d", noteId, modelId)
+		}
+
+		card := noteCard(model, strings.Split(fields, "\x1f"), options)
+		if card.Word == "" {
+			continue
+		}
+		noteIndex[noteId] = len(deck.Cards)
+		deck.Cards = append(deck.Cards, card)
+	}
+	if err := rows.Err(); err != nil {
+		return AnkiDeck{}, fmt.Errorf("notes: %w", err)
+	}
+
+	deck.History = make([][]api.Review, len(deck.Cards))
+	if err := readHistory(db, noteIndex, deck.History); err != nil {
+		return AnkiDeck{}, fmt.Errorf("review log: %w", err)
+	}
+	return deck, nil
+}
+
+// noteCard maps the fields of a note, ordered as the fields of its model, to a card
+func noteCard(model ankiModel, values []string, options AnkiOptions) api.Card {
+	byName := make(map[string]string, len(model.Fields))
+	names := make([]string, len(model.Fields))
+	for _, field := range model.Fields {
+		if field.Ord < len(values) && field.Ord < len(names) {
+			byName[field.Name] = fieldText(values[field.Ord])
+			names[field.Ord] = field.Name
+		}
+	}
+
+	wordField := pickField(names, options.WordField, ankiWordFields, 0)
+	translationsField := pickField(names, options.TranslationsField, ankiTranslationsFields, 1)
+	genderField := pickField(names, options.GenderField, ankiGenderFields, -1)
+
+	card := api.Card{
+		Word:        byName[wordField],
+		Translation: splitTranslations(byName[translationsField]),
+		Gender:      normalizeGender(byName[genderField]),
+		WordType:    byName[ankiFieldWordType],
+		Level:       options.Level,
+	}
+	if level, err := strconv.Atoi(byName[ankiFieldLevel]); err == nil {
+		card.Level = level
+	}
+	if card.Level == 0 {
+		card.Level = 1
+	}
+
+	hasFlexions, hasTenses := false, false
+	for _, name := range names {
+		value := byName[name]
+		if value == "" || name == wordField || name == translationsField || name == genderField || slices.Contains(ankiCardFields, name) {
+			continue
+		}
+
+		switch {
+		case slices.Contains(flexionColumns, name):
+			hasFlexions = true
+			card.Forms = addForm(card.Forms, name, []string{value})
+		case model.Name == AnkiNoteType:
+			hasTenses = true
+			card.Forms = addForm(card.Forms, name, splitLines(value))
+		}
+	}
+
+	if card.WordType == "" {
+		switch {
+		case hasTenses:
+			card.WordType = string(api.Verb)
+		case hasFlexions:
+			card.WordType = string(api.Irregular)
+		default:
+			card.WordType = string(api.Regular)
+		}
+	}
+	return card
+}
+
+// pickField returns name, or else the first of candidates the note has, or
+// else the field at fallback
+func pickField(names []string, name string, candidates []string, fallback int) string {
+	if name != "" {
+		return name
+	}
+	for _, candidate := range candidates {
+		for _, field := range names {
+			if strings.EqualFold(field, candidate) {
+				return field
+			}
+		}
+	}
+	if fallback >= 0 && fallback < len(names) {
+		return names[fallback]
+	}
+	return ""
+}
+
+func addForm(forms map[string][]string, key string, value []string) map[string][]string {
+	if forms == nil {
+		forms = make(map[string][]string)
+	}
+	forms[key] = value
+	return forms
+}
+
+var (
+	htmlBreak = regexp.MustCompile(`(?i)<br\s*/?>|</?(div|p|li)[^>]*>`)
+	htmlTag   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// fieldText turns the HTML of a note field into plain text, block elements
+// and line breaks becoming new lines
+func fieldText(value string) string {
+	value = htmlBreak.ReplaceAllString(value, "\n")
+	value = htmlTag.ReplaceAllString(value, "")
+	value = strings.ReplaceAll(html.UnescapeString(value), "\u00a0", " ")
+
+	lines := strings.Split(value, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+func splitTranslations(value string) []string {
+	return splitFunc(value, func(r rune) bool { return r == '\n' || r == ';' || r == ',' })
+}
+
+func splitLines(value string) []string {
+	return splitFunc(value, func(r rune) bool { return r == '\n' || r == '|' })
+}
+
+func splitFunc(value string, separator func(rune) bool) []string {
+	var items []string
+	for _, item := range strings.FieldsFunc(value, separator) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// normalizeGender maps the usual ways of writing a gender to "m" or "f",
+// other values are kept for validation to reject
+func normalizeGender(value string) string {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "m", "m.", "masc", "masc.", "masculine", "masculin", "le", "un":
+		return string(api.Masc)
+	case "f", "f.", "fem", "fém", "fem.", "fém.", "feminine", "féminin", "la", "une":
+		return string(api.Fem)
+	}
+	return value
+}
+
+// readHistory adds the answers of the review log to the history of the card
+// of their note, oldest first. Answers of filtered decks and manual
+// rescheduling are left out, they are not reviews of the card.
+func readHistory(db *sql.DB, noteIndex map[int64]int, history [][]api.Review) error {
+	rows, err := db.Query(`
+		SELECT r.id, r.cid, r.ease, c.nid
+		FROM revlog r
+		JOIN cards c ON c.id = r.cid
+		WHERE r.ease > 0 AND r.type IN (0, 1, 2)
+		ORDER BY r.id
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reviewId, ankiCardId, noteId int64
+		var ease int
+		if err := rows.Scan(&reviewId, &ankiCardId, &ease, &noteId); err != nil {
+			return err
+		}
+		i, ok := noteIndex[noteId]
+		if !ok {
+			continue
+		}
+
+		// ease 1 is "Again", a failed recall
+		success := ease > 1
+		incorrectCount := 0
+		if !success {
+			incorrectCount = 1
+		}
+		history[i] = append(history[i], api.Review{
+			ReviewId:       ankiReviewId(ankiCardId, reviewId),
+			ReviewDate:     time.UnixMilli(reviewId).UTC(),
+			Success:        &success,
+			IncorrectCount: &incorrectCount,
+		})
+	}
+	return rows.Err()
+}
+
+// ankiReviewId derives a UUID from an entry of the review log, so importing
+// the same history twice applies each review once
+func ankiReviewId(ankiCardId, reviewId int64) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("anki-revlog:%d:%d", ankiCardId, reviewId)))
+	sum[6] = (sum[6] & 0x0f) | 0x50 // version 5, name based with SHA-1
+	sum[8] = (sum[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	id := hex.EncodeToString(sum[:16])
+	return id[:8] + "-" + id[8:12] + "-" + id[12:16] + "-" + id[16:20] + "-" + id[20:]
+}
+
+type HistoryReport struct {
+	LessonsStarted int
+	ReviewsApplied int
+	ReviewsFailed  int
+}
+
+// ImportAnkiHistory replays the review history of the cards imported from an
+// Anki deck for the user, report being the outcome of importing deck.Cards.
+// Cards not learnt by the user yet are started as lessons first. Reviews
+// already applied are skipped, and reviews older than the last review of
+// their card are counted as failed.
+func ImportAnkiHistory(ctx context.Context, userService api.UserService, userId string, deck AnkiDeck, report api.ImportReport) (HistoryReport, error) {
+	var historyReport HistoryReport
+
+	for _, result := range report.Results {
+		if result.CardId == 0 || result.Index >= len(deck.History) || len(deck.History[result.Index]) == 0 {
+			continue
+		}
+
+		_, err := userService.AddReviews(ctx, userId, []int{result.CardId})
+		if err == nil {
+			historyReport.LessonsStarted++
+		} else if !errors.Is(err, api.ErrDuplicate) {
+			return historyReport, err
+		}
+
+		reviews := make([]api.Review, len(deck.History[result.Index]))
+		for i, review := range deck.History[result.Index] {
+			review.CardId = result.CardId
+			reviews[i] = review
+		}
+
+		results, err := userService.UpdateReviews(ctx, userId, reviews)
+		if err != nil {
+			return historyReport, err
+		}
+		for _, reviewResult := range results {
+			if reviewResult.Error != "" {
+				slog.WarnContext(ctx, "deck - Anki review not applied", "card_id", result.CardId, "index", reviewResult.Index, "error", reviewResult.Error)
+				historyReport.ReviewsFailed++
+			} else {
+				historyReport.ReviewsApplied++
+			}
+		}
+	}
+
+	return historyReport, nil
+}
+
+// WriteApkg writes the cards as an Anki package of a single deck, named
+// AnkiNoteType like its note type, with one note per card
+func WriteApkg(w io.Writer, cards []api.Card) error {
+	dir, err := os.MkdirTemp("", "crabi-apkg-")
+	if err != nil {
+		return fmt.Errorf("deck - WriteApkg: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "collection.anki2")
+	if err := writeCollection(path, cards, time.Now()); err != nil {
+		return fmt.Errorf("deck - WriteApkg: %w", err)
+	}
+
+	collection, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("deck - WriteApkg: %w", err)
+	}
+	defer collection.Close()
+
+	// the collection is copied from disk, so that large decks are not held in memory
+	archive := zip.NewWriter(w)
+	for _, file := range []struct {
+		name    string
+		content io.Reader
+	}{
+		{"collection.anki2", collection},
+		{"media", strings.NewReader("{}")}, // no media files
+	} {
+		entry, err := archive.Create(file.name)
+		if err != nil {
+			return fmt.Errorf("deck - WriteApkg: %w", err)
+		}
+		if _, err := io.Copy(entry, file.content); err != nil {
+			return fmt.Errorf("deck - WriteApkg: %w", err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("deck - WriteApkg: %w", err)
+	}
+	return nil
+}
+
+// ankiSchema is version 11 of the collection schema, read by every Anki
+// release since 2.0
+const ankiSchema = `
+CREATE TABLE col (id integer primary key, crt integer not null, mod integer not null, scm integer not null, ver integer not null, dty integer not null, usn integer not null, ls integer not null, conf text not null, models text not null, decks text not null, dconf text not null, tags text not null);
+CREATE TABLE notes (id integer primary key, guid text not null, mid integer not null, mod integer not null, usn integer not null, tags text not null, flds text not null, sfld integer not null, csum integer not null, flags integer not null, data text not null);
+CREATE TABLE cards (id integer primary key, nid integer not null, did integer not null, ord integer not null, mod integer not null, usn integer not null, type integer not null, queue integer not null, due integer not null, ivl integer not null, factor integer not null, reps integer not null, lapses integer not null, left integer not null, odue integer not null, odid integer not null, flags integer not null, data text not null);
+CREATE TABLE revlog (id integer primary key, cid integer not null, usn integer not null, ease integer not null, ivl integer not null, lastIvl integer not null, factor integer not null, time integer not null, type integer not null);
+CREATE TABLE graves (usn integer not null, oid integer not null, type integer not null);
+CREATE INDEX ix_notes_usn ON notes (usn);
+CREATE INDEX ix_cards_usn ON cards (usn);
+CREATE INDEX ix_revlog_usn ON revlog (usn);
+CREATE INDEX ix_cards_nid ON cards (nid);
+CREATE INDEX ix_cards_sched ON cards (did, queue, due);
+CREATE INDEX ix_revlog_cid ON revlog (cid);
+CREATE INDEX ix_notes_csum ON notes (csum);
+`
+
+func writeCollection(path string, cards []api.Card, now time.Time) error {
+	db, err := sql.Open("sqlite3", "file:"+path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(ankiSchema); err != nil {
+		return err
+	}
+
+	fields := append(slices.Clone(ankiCardFields), flexionColumns...)
+	fields = append(fields, exportedTenses(cards)...)
+
+	models, decks, dconf, conf, err := collectionConfig(fields, len(cards), now)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO col VALUES (1, ?, ?, ?, 11, 0, 0, 0, ?, ?, ?, ?, '{}')`,
+		now.Unix(), now.UnixMilli(), now.UnixMilli(), conf, models, decks, dconf)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// ids of notes and cards are creation times in milliseconds, kept unique by
+	// counting from the time of the export
+	base := now.UnixMilli()
+	for i, card := range cards {
+		values := noteValues(fields, card)
+		sortField := fieldText(values[0])
+		tags := " " + card.WordType + " level-" + strconv.Itoa(card.Level) + " "
+
+		noteId := base + int64(i)
+		_, err := tx.Exec(`INSERT INTO notes VALUES (?, ?, ?, ?, -1, ?, ?, ?, ?, 0, '')`,
+			noteId, "crabi-"+strconv.Itoa(card.CardId), ankiModelId, now.Unix(), tags, strings.Join(values, "\x1f"), sortField, fieldChecksum(sortField))
+		if err != nil {
+			return err
+		}
+
+		// a new card, due in the order of the deck
+		_, err = tx.Exec(`INSERT INTO cards VALUES (?, ?, ?, 0, ?, -1, 0, 0, ?, 0, 0, 0, 0, 0, 0, 0, 0, '')`,
+			noteId, noteId, ankiDeckId, now.Unix(), i+1)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// exportedTenses lists the tenses of the verbs in cards, in alphabetical order
+func exportedTenses(cards []api.Card) []string {
+	var tenses []string
+	for _, card := range cards {
+		if card.WordType != string(api.Verb) {
+			continue
+		}
+		for tense := range card.Forms {
+			if !slices.Contains(tenses, tense) {
+				tenses = append(tenses, tense)
+			}
+		}
+	}
+	slices.Sort(tenses)
+	return tenses
+}
+
+func noteValues(fields []string, card api.Card) []string {
+	values := make([]string, len(fields))
+	for i, field := range fields {
+		switch field {
+		case ankiFieldWord:
+			values[i] = html.EscapeString(card.Word)
+		case ankiFieldTranslations:
+			values[i] = html.EscapeString(strings.Join(card.Translation, ", "))
+		case ankiFieldGender:
+			values[i] = card.Gender
+		case ankiFieldWordType:
+			values[i] = card.WordType
+		case ankiFieldLevel:
+			values[i] = strconv.Itoa(card.Level)
+		default:
+			forms := make([]string, len(card.Forms[field]))
+			for j, form := range card.Forms[field] {
+				forms[j] = html.EscapeString(form)
+			}
+			values[i] = strings.Join(forms, "<br>")
+		}
+	}
+	return values
+}
+
+// fieldChecksum is the checksum Anki uses to find duplicates: the first 8
+// hex digits of the SHA-1 of the sort field
+func fieldChecksum(text string) int64 {
+	sum := sha1.Sum([]byte(text))
+	checksum, _ := strconv.ParseInt(hex.EncodeToString(sum[:4]), 16, 64)
+	return checksum
+}
+
+func collectionConfig(fields []string, numCards int, now time.Time) (models, decks, dconf, conf string, err error) {
+	modelFields := make([]map[string]any, len(fields))
+	answer := `{{FrontSide}}<hr id="answer"><div class="translations">{{` + ankiFieldTranslations + `}}</div>`
+	for i, field := range fields {
+		modelFields[i] = map[string]any{"name": field, "ord": i, "sticky": false, "rtl": false, "font": "Arial", "size": 20, "media": []any{}}
+		if i >= len(ankiCardFields) {
+			answer += `{{#` + field + `}}<div class="form"><b>` + html.EscapeString(field) + `</b><br>{{` + field + `}}</div>{{/` + field + `}}`
+		}
+	}
+
+	model := map[string]any{
+		"id":    ankiModelId,
+		"name":  AnkiNoteType,
+		"type":  0,
+		"mod":   now.Unix(),
+		"usn":   -1,
+		"sortf": 0,
+		"did":   ankiDeckId,
+		"tmpls": []map[string]any{{
+			"name":  "Recognition",
+			"ord":   0,
+			"qfmt":  `<div class="word">{{` + ankiFieldWord + `}}</div>{{#` + ankiFieldGender + `}}<div class="gender">{{` + ankiFieldGender + `}}</div>{{/` + ankiFieldGender + `}}`,
+			"afmt":  answer,
+			"did":   nil,
+			"bqfmt": "",
+			"bafmt": "",
+		}},
+		"flds":      modelFields,
+		"css":       ".card { font-family: arial; font-size: 20px; text-align: center; color: black; background-color: white; }\n.word { font-size: 32px; }\n.gender, .form b { color: grey; }\n.form { margin-top: 12px; }",
+		"latexPre":  "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
+		"latexPost": "\\end{document}",
+		"tags":      []any{},
+		"vers":      []any{},
+		"req":       []any{[]any{0, "any", []int{0}}},
+	}
+
+	deck := func(id int64, name string) map[string]any {
+		return map[string]any{
+			"id": id, "name": name, "mod": now.Unix(), "usn": -1, "desc": "", "dyn": 0, "conf": 1, "collapsed": false,
+			"newToday": []int{0, 0}, "revToday": []int{0, 0}, "lrnToday": []int{0, 0}, "timeToday": []int{0, 0},
+			"extendNew": 10, "extendRev": 50,
+		}
+	}
+
+	deckOptions := map[string]any{
+		"id": 1, "name": "Default", "mod": 0, "usn": 0, "maxTaken": 60, "timer": 0, "autoplay": true, "replayq": true, "dyn": false,
+		"new":   map[string]any{"delays": []int{1, 10}, "ints": []int{1, 4, 7}, "initialFactor": 2500, "order": 1, "perDay": 20, "bury": true, "separate": true},
+		"rev":   map[string]any{"perDay": 200, "ease4": 1.3, "fuzz": 0.05, "ivlFct": 1, "maxIvl": 36500, "bury": true, "minSpace": 1},
+		"lapse": map[string]any{"delays": []int{10}, "mult": 0, "minInt": 1, "leechFails": 8, "leechAction": 0},
+	}
+
+	collection := map[string]any{
+		"nextPos": numCards + 1, "estTimes": true, "activeDecks": []int64{ankiDeckId}, "sortType": "noteFld", "timeLim": 0,
+		"sortBackwards": false, "addToCur": true, "curDeck": ankiDeckId, "newBury": true, "newSpread": 0, "dueCounts": true,
+		"curModel": strconv.FormatInt(ankiModelId, 10), "collapseTime": 1200,
+	}
+
+	for _, value := range []struct {
+		target *string
+		value  any
+	}{
+		{&models, map[string]any{strconv.FormatInt(ankiModelId, 10): model}},
+		{&decks, map[string]any{"1": deck(1, "Default"), strconv.FormatInt(ankiDeckId, 10): deck(ankiDeckId, AnkiNoteType)}},
+		{&dconf, map[string]any{"1": deckOptions}},
+		{&conf, collection},
+	} {
+		encoded, err := json.Marshal(value.value)
+		if err != nil {
+			return "", "", "", "", err
+		}
+		*value.target = string(encoded)
+	}
+	return models, decks, dconf, conf, nil
+}
@@ -0,0 +1,242 @@
+package deck_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crabigateur-api/pkg/api"
+	"crabigateur-api/pkg/deck"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApkgRoundTrip(t *testing.T) {
+	cards := []api.Card{
+		{CardId: 1, Level: 1, Word: "chat", WordType: "regular", Gender: "m", Translation: []string{"cat"}},
+		{CardId: 2, Level: 2, Word: "beau", WordType: "irregular", Gender: "m", Translation: []string{"beautiful", "handsome"},
+			Forms: map[string][]string{"m.s.": {"beau"}, "m.p.": {"beaux"}, "f.s.": {"belle"}, "f.p.": {"belles"}}},
+		{CardId: 3, Level: 1, Word: "aller", WordType: "verb", Translation: []string{"to go"}, IrregularVerb: true,
+			Forms: map[string][]string{"présent": {"vais", "vas", "va", "allons", "allez", "vont"}}},
+		{CardId: 4, Level: 3, Word: "l'été", WordType: "regular", Gender: "m", Translation: []string{"summer"}},
+	}
+
+	var buffer bytes.Buffer
+	check(t, deck.WriteApkg(&buffer, cards))
+
+	archive, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	check(t, err)
+	var names []string
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	assert.Equal(t, []string{"collection.anki2", "media"}, names)
+
+	imported, err := deck.ReadApkg(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()), deck.AnkiOptions{})
+	check(t, err)
+
+	// card ids and the irregular flag of verbs are not part of the deck
+	for i := range cards {
+		cards[i].CardId = 0
+		cards[i].IrregularVerb = false
+	}
+	assert.Equal(t, cards, imported.Cards)
+	assert.Equal(t, make([][]api.Review, len(cards)), imported.History)
+}
+
+func TestReadApkg(t *testing.T) {
+	models := `{"1600000000000": {"name": "Basic", "flds": [{"name": "Front", "ord": 0}, {"name": "Back", "ord": 1}, {"name": "Genre", "ord": 2}, {"name": "f.s.", "ord": 3}]}}`
+	notes := []ankiNote{
+		{id: 10, fields: []string{"la&nbsp;maison", "house<br>home", "féminin", ""}},
+		{id: 11, fields: []string{"<b>vert</b>", "green", "", "<div>verte</div>"}},
+		{id: 12, fields: []string{"", "nothing", "", ""}},
+	}
+	path := writeAnkiCollection(t, models, notes, []string{
+		"INSERT INTO cards VALUES (100, 10)",
+		"INSERT INTO cards VALUES (101, 11)",
+		"INSERT INTO revlog VALUES (1700000000000, 100, 1, 0)",
+		"INSERT INTO revlog VALUES (1700086400000, 100, 3, 1)",
+		"INSERT INTO revlog VALUES (1700172800000, 100, 0, 4)", // rescheduled by hand
+		"INSERT INTO revlog VALUES (1700000000000, 101, 4, 3)", // studied in a filtered deck
+	})
+
+	file, err := os.Open(path)
+	check(t, err)
+	defer file.Close()
+	info, err := file.Stat()
+	check(t, err)
+
+	imported, err := deck.ReadApkg(file, info.Size(), deck.AnkiOptions{Level: 2})
+	check(t, err)
+
+	assert.Equal(t, []api.Card{
+		{Level: 2, Word: "la maison", WordType: "regular", Gender: "f", Translation: []string{"house", "home"}},
+		{Level: 2, Word: "vert", WordType: "irregular", Translation: []string{"green"}, Forms: map[string][]string{"f.s.": {"verte"}}},
+	}, imported.Cards)
+
+	if !assert.Len(t, imported.History, 2) || !assert.Len(t, imported.History[0], 2) {
+		return
+	}
+	assert.Empty(t, imported.History[1])
+
+	failed, passed := imported.History[0][0], imported.History[0][1]
+	assert.Equal(t, time.UnixMilli(1700000000000).UTC(), failed.ReviewDate)
+	assert.False(t, *failed.Success)
+	assert.Equal(t, 1, *failed.IncorrectCount)
+	assert.True(t, *passed.Success)
+	assert.Equal(t, 0, *passed.IncorrectCount)
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, failed.ReviewId)
+	assert.NotEqual(t, failed.ReviewId, passed.ReviewId)
+
+	// the same log gives the same review ids
+	again, err := deck.ReadApkg(file, info.Size(), deck.AnkiOptions{})
+	check(t, err)
+	assert.Equal(t, failed.ReviewId, again.History[0][0].ReviewId)
+}
+
+func TestReadApkg_UnsupportedPackage(t *testing.T) {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	_, err := archive.Create("collection.anki21b")
+	check(t, err)
+	check(t, archive.Close())
+
+	_, err = deck.ReadApkg(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()), deck.AnkiOptions{})
+	assert.ErrorContains(t, err, "Support older Anki versions")
+}
+
+func TestReadApkg_CollectionTooLarge(t *testing.T) {
+	var buffer bytes.Buffer
+	check(t, deck.WriteApkg(&buffer, []api.Card{{Level: 1, Word: "chat", WordType: "regular", Gender: "m", Translation: []string{"cat"}}}))
+
+	_, err := deck.ReadApkg(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()), deck.AnkiOptions{MaxCollectionSize: 1024})
+	assert.ErrorContains(t, err, "collection.anki2 is larger than 1024 bytes")
+
+	_, err = deck.ReadApkg(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()), deck.AnkiOptions{})
+	assert.NoError(t, err)
+}
+
+// check stops the test on errors of its setup
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+type ankiNote struct {
+	id     int64
+	fields []string
+}
+
+// writeAnkiCollection packages a collection holding the columns read by
+// ReadApkg: the note types models, notes of the first note type and the rows
+// inserted by statements
+func writeAnkiCollection(t *testing.T, models string, notes []ankiNote, statements []string) string {
+	dir := t.TempDir()
+	collection := filepath.Join(dir, "collection.anki2")
+
+	db, err := sql.Open("sqlite3", collection)
+	check(t, err)
+	for _, statement := range append([]string{
+		"CREATE TABLE col (models text)",
+		"CREATE TABLE notes (id integer, mid integer, flds text)",
+		"CREATE TABLE cards (id integer, nid integer)",
+		"CREATE TABLE revlog (id integer, cid integer, ease integer, type integer)",
+	}, statements...) {
+		_, err := db.Exec(statement)
+		check(t, err)
+	}
+	_, err = db.Exec("INSERT INTO col VALUES (?)", models)
+	check(t, err)
+	for _, note := range notes {
+		_, err = db.Exec("INSERT INTO notes VALUES (?, 1600000000000, ?)", note.id, strings.Join(note.fields, "\x1f"))
+		check(t, err)
+	}
+	check(t, db.Close())
+
+	content, err := os.ReadFile(collection)
+	check(t, err)
+
+	path := filepath.Join(dir, "deck.apkg")
+	file, err := os.Create(path)
+	check(t, err)
+	archive := zip.NewWriter(file)
+	entry, err := archive.Create("collection.anki2")
+	check(t, err)
+	_, err = entry.Write(content)
+	check(t, err)
+	check(t, archive.Close())
+	check(t, file.Close())
+
+	return path
+}
+
+type stubUserService struct {
+	api.UserService
+	learnt  map[int]bool
+	reviews []api.Review
+}
+
+func (s *stubUserService) AddReviews(ctx context.Context, userId string, cardIds []int) ([]api.ReviewResult, error) {
+	if s.learnt[cardIds[0]] {
+		return nil, fmt.Errorf("storage - InsertReview: %w", api.ErrDuplicate)
+	}
+	s.learnt[cardIds[0]] = true
+	return []api.ReviewResult{{CardId: cardIds[0]}}, nil
+}
+
+func (s *stubUserService) UpdateReviews(ctx context.Context, userId string, reviews []api.Review) ([]api.BatchReviewResult, error) {
+	results := make([]api.BatchReviewResult, len(reviews))
+	for i, review := range reviews {
+		results[i] = api.BatchReviewResult{Index: i, CardId: review.CardId}
+		if review.ReviewDate.Before(time.UnixMilli(1700000000000)) {
+			results[i].Error = api.ErrStaleReview.Error()
+			continue
+		}
+		s.reviews = append(s.reviews, review)
+	}
+	return results, nil
+}
+
+func TestImportAnkiHistory(t *testing.T) {
+	success := true
+	incorrectCount := 0
+	review := func(date int64) api.Review {
+		return api.Review{ReviewId: fmt.Sprint(date), ReviewDate: time.UnixMilli(date), Success: &success, IncorrectCount: &incorrectCount}
+	}
+
+	ankiDeck := deck.AnkiDeck{
+		Cards: make([]api.Card, 4),
+		History: [][]api.Review{
+			{review(1700000000000), review(1700086400000)},
+			{review(1600000000000)},
+			{},
+			{review(1700000000000)},
+		},
+	}
+	report := api.ImportReport{Results: []api.ImportResult{
+		{Index: 0, Status: api.ImportCreated, CardId: 7},
+		{Index: 1, Status: api.ImportUpdated, CardId: 8},
+		{Index: 2, Status: api.ImportCreated, CardId: 9},
+		{Index: 3, Status: api.ImportRejected},
+	}}
+
+	userService := &stubUserService{learnt: map[int]bool{8: true}}
+	historyReport, err := deck.ImportAnkiHistory(context.Background(), userService, "123", ankiDeck, report)
+	check(t, err)
+
+	assert.Equal(t, deck.HistoryReport{LessonsStarted: 1, ReviewsApplied: 2, ReviewsFailed: 1}, historyReport)
+	assert.Equal(t, map[int]bool{7: true, 8: true}, userService.learnt)
+	if !assert.Len(t, userService.reviews, 2) {
+		return
+	}
+	assert.Equal(t, 7, userService.reviews[0].CardId)
+	assert.Empty(t, ankiDeck.History[0][0].CardId, "the history of the deck is left as is")
+}
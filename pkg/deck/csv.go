@@ -0,0 +1,257 @@
+// Package deck reads and writes cards in the file formats used to move
+// vocabulary in and out of the API.
+package deck
+
+import (
+	"crabigateur-api/pkg/api"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ListSeparator separates the items of a list in a CSV cell, e.g. the
+// translations of a word or the six persons of a tense
+const ListSeparator = "|"
+
+// Columns of a card in CSV. Any other column of the header holds the
+// conjugation of the tense it is named after, e.g. "présent".
+const (
+	ColumnWord          = "word"
+	ColumnTranslations  = "translations"
+	ColumnWordType      = "word_type"
+	ColumnGender        = "gender"
+	ColumnLevel         = "level"
+	ColumnIrregularVerb = "is_irregular_verb"
+)
+
+// CardColumns hold the fields of a card, the other columns its forms
+var CardColumns = []string{ColumnWord, ColumnTranslations, ColumnWordType, ColumnGender, ColumnLevel, ColumnIrregularVerb}
+
+// RowError is a malformed value in a row of a file
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+var flexionColumns = []string{string(api.MascSing), string(api.MascPlur), string(api.FemSing), string(api.FemPlur)}
+
+// ReadCSV reads one card per row after a header naming the columns. Empty
+// cells are left out of the card, so a row only sets the forms it fills in.
+// Rows are not validated, malformed values such as a level that is not a
+// number fail the whole file with the line they are on, as does the end of an
+// export that does not count the cards before it.
+func ReadCSV(r io.Reader) ([]api.Card, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("deck - ReadCSV: missing header")
+	} else if err != nil {
+		return nil, fmt.Errorf("deck - ReadCSV: %w", err)
+	}
+	for i, column := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")) // spreadsheets often start with a BOM
+	}
+	if !slices.Contains(header, ColumnWord) {
+		return nil, fmt.Errorf("deck - ReadCSV: missing %s column", ColumnWord)
+	}
+
+	var cards []api.Card
+	ended := false
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		// the end of an export is a single field, whatever the number of columns
+		count, isEnd := parseCSVEnd(record)
+		if err != nil && !(isEnd && errors.Is(err, csv.ErrFieldCount)) {
+			return nil, fmt.Errorf("deck - ReadCSV: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		if ended {
+			return nil, fmt.Errorf("deck - ReadCSV: %w", &RowError{Line: line, Err: errAfterEndOfExport})
+		} else if isEnd {
+			if err := checkEndOfExport(count, len(cards)); err != nil {
+				return nil, fmt.Errorf("deck - ReadCSV: %w", &RowError{Line: line, Err: err})
+			}
+			ended = true
+			continue
+		}
+
+		card, err := parseRecord(header, record)
+		if err != nil {
+			return nil, fmt.Errorf("deck - ReadCSV: %w", &RowError{Line: line, Err: err})
+		}
+		cards = append(cards, card)
+	}
+
+	return cards, nil
+}
+
+func parseRecord(header, record []string) (api.Card, error) {
+	var card api.Card
+
+	for i, column := range header {
+		value := strings.TrimSpace(record[i])
+		if value == "" || column == "" {
+			continue
+		}
+
+		switch column {
+		case ColumnWord:
+			card.Word = value
+		case ColumnTranslations:
+			card.Translation = splitList(value)
+		case ColumnWordType:
+			card.WordType = value
+		case ColumnGender:
+			card.Gender = value
+		case ColumnLevel:
+			level, err := strconv.Atoi(value)
+			if err != nil {
+				return api.Card{}, fmt.Errorf("invalid %s %q", ColumnLevel, value)
+			}
+			card.Level = level
+		case ColumnIrregularVerb:
+			irregular, err := strconv.ParseBool(value)
+			if err != nil {
+				return api.Card{}, fmt.Errorf("invalid %s %q", ColumnIrregularVerb, value)
+			}
+			card.IrregularVerb = irregular
+		default:
+			// flexions hold a single form, tenses one form per person
+			if card.Forms == nil {
+				card.Forms = make(map[string][]string)
+			}
+			if slices.Contains(flexionColumns, column) {
+				card.Forms[column] = []string{value}
+			} else {
+				card.Forms[column] = splitList(value)
+			}
+		}
+	}
+
+	return card, nil
+}
+
+// csvEnd is the last line of a CSV export, e.g. "# end of export: 12 cards"
+func csvEnd(count int) string {
+	return fmt.Sprintf("# %s: %d cards", endOfExport, count)
+}
+
+func parseCSVEnd(record []string) (int, bool) {
+	if len(record) != 1 {
+		return 0, false
+	}
+	count, ok := strings.CutPrefix(record[0], "# "+endOfExport+": ")
+	if !ok {
+		return 0, false
+	}
+	count, ok = strings.CutSuffix(count, " cards")
+	n, err := strconv.Atoi(count)
+	return n, ok && err == nil
+}
+
+type csvWriter struct {
+	writer  *csv.Writer
+	header  []string
+	started bool
+	count   int
+}
+
+// NewCSVWriter writes one card per row, under a header of CardColumns, the
+// flexions and then tenses, in the layout read by ReadCSV. Every form of a
+// card must have a column, a card conjugating another tense is refused.
+func NewCSVWriter(w io.Writer, tenses []string) CardWriter {
+	header := slices.Concat(CardColumns, flexionColumns, tenses)
+	return &csvWriter{writer: csv.NewWriter(w), header: header}
+}
+
+func (c *csvWriter) Write(card api.Card) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+
+	for key := range card.Forms {
+		if !slices.Contains(c.header[len(CardColumns):], key) {
+			return fmt.Errorf("deck - CSVWriter: card %q has no column for %q", card.Word, key)
+		}
+	}
+
+	record := make([]string, len(c.header))
+	for i, column := range c.header {
+		switch column {
+		case ColumnWord:
+			record[i] = card.Word
+		case ColumnTranslations:
+			record[i] = strings.Join(card.Translation, ListSeparator)
+		case ColumnWordType:
+			record[i] = card.WordType
+		case ColumnGender:
+			record[i] = card.Gender
+		case ColumnLevel:
+			record[i] = strconv.Itoa(card.Level)
+		case ColumnIrregularVerb:
+			if card.IrregularVerb {
+				record[i] = strconv.FormatBool(true)
+			}
+		default:
+			record[i] = strings.Join(card.Forms[column], ListSeparator)
+		}
+	}
+
+	if err := c.writer.Write(record); err != nil {
+		return fmt.Errorf("deck - CSVWriter: %w", err)
+	}
+	c.count++
+	return nil
+}
+
+// Close also writes the header of a file without cards
+func (c *csvWriter) Close() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	if err := c.writer.Write([]string{csvEnd(c.count)}); err != nil {
+		return fmt.Errorf("deck - CSVWriter: %w", err)
+	}
+	c.writer.Flush()
+	if err := c.writer.Error(); err != nil {
+		return fmt.Errorf("deck - CSVWriter: %w", err)
+	}
+	return nil
+}
+
+func (c *csvWriter) writeHeader() error {
+	if c.started {
+		return nil
+	}
+	c.started = true
+	if err := c.writer.Write(c.header); err != nil {
+		return fmt.Errorf("deck - CSVWriter: %w", err)
+	}
+	return nil
+}
+
+func splitList(value string) []string {
+	items := strings.Split(value, ListSeparator)
+	for i, item := range items {
+		items[i] = strings.TrimSpace(item)
+	}
+	return items
+}
@@ -0,0 +1,137 @@
+package deck_test
+
+import (
+	"crabigateur-api/pkg/api"
+	"crabigateur-api/pkg/deck"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		expected  []api.Card
+		expectErr string
+	}{
+		{
+			name: "Forms and tenses",
+			input: "\ufeffword,translations,word_type,gender,level,is_irregular_verb,m.s.,m.p.,f.s.,f.p.,présent,passé composé\n" +
+				"beau,beautiful | handsome,irregular,m,2,,beau,beaux,belle,belles,,\n" +
+				"aller,to go,verb,,1,true,,,,,vais|vas|va|allons|allez|vont,suis allé|es allé|est allé|sommes allés|êtes allés|sont allés\n",
+			expected: []api.Card{
+				{Word: "beau", Translation: []string{"beautiful", "handsome"}, WordType: "irregular", Gender: "m", Level: 2,
+					Forms: map[string][]string{"m.s.": {"beau"}, "m.p.": {"beaux"}, "f.s.": {"belle"}, "f.p.": {"belles"}}},
+				{Word: "aller", Translation: []string{"to go"}, WordType: "verb", Level: 1, IrregularVerb: true,
+					Forms: map[string][]string{
+						"présent":       {"vais", "vas", "va", "allons", "allez", "vont"},
+						"passé composé": {"suis allé", "es allé", "est allé", "sommes allés", "êtes allés", "sont allés"},
+					}},
+			},
+		},
+		{
+			name:     "Columns in any order",
+			input:    "level,gender,word\n3,f,maison\n",
+			expected: []api.Card{{Word: "maison", Gender: "f", Level: 3}},
+		},
+		{
+			name:      "Missing word column",
+			input:     "translations,level\ncat,1\n",
+			expectErr: "deck - ReadCSV: missing word column",
+		},
+		{
+			name:      "Level is not a number",
+			input:     "word,level\nchat,1\nchien,one\n",
+			expectErr: `deck - ReadCSV: line 3: invalid level "one"`,
+		},
+		{
+			name:      "Row with too many cells",
+			input:     "word,level\nchat,1,m\n",
+			expectErr: "deck - ReadCSV: record on line 2: wrong number of fields",
+		},
+		{
+			name:     "End of export",
+			input:    "word,level\nchat,1\n# end of export: 1 cards\n",
+			expected: []api.Card{{Word: "chat", Level: 1}},
+		},
+		{
+			name:      "Export cut short",
+			input:     "word,level\nchat,1\n# end of export: 2 cards\n",
+			expectErr: "deck - ReadCSV: line 3: end of export counts 2 cards, 1 were read",
+		},
+		{
+			name:      "Row after the end of export",
+			input:     "word,level\n# end of export: 0 cards\nchat,1\n",
+			expectErr: "deck - ReadCSV: line 3: card after the end of export",
+		},
+		{
+			name:      "Empty file",
+			expectErr: "deck - ReadCSV: missing header",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cards, err := deck.ReadCSV(strings.NewReader(tt.input))
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, cards)
+		})
+	}
+}
+
+func TestFormatOfContentType(t *testing.T) {
+	format, err := deck.FormatOfContentType("text/csv; charset=utf-8")
+	assert.NoError(t, err)
+	assert.Equal(t, deck.CSV, format)
+
+	format, err = deck.FormatOfContentType("application/json")
+	assert.NoError(t, err)
+	assert.Equal(t, deck.JSON, format)
+
+	format, err = deck.FormatOfContentType(deck.NDJSONContentType)
+	assert.NoError(t, err)
+	assert.Equal(t, deck.NDJSON, format)
+
+	_, err = deck.FormatOfContentType("application/xml")
+	assert.Error(t, err)
+}
+
+func TestCSVWriter(t *testing.T) {
+	var buffer strings.Builder
+	writer := deck.NewCSVWriter(&buffer, []string{"passé composé", "présent"})
+	for _, card := range exportedCards {
+		assert.NoError(t, writer.Write(card))
+	}
+	assert.NoError(t, writer.Close())
+
+	assert.Equal(t, "word,translations,word_type,gender,level,is_irregular_verb,m.s.,m.p.,f.s.,f.p.,passé composé,présent\n"+
+		"chat,cat,regular,m,1,,,,,,,\n"+
+		"beau,\"beautiful, handsome|fine\",irregular,m,2,,beau,beaux,belle,belles,,\n"+
+		"maison,house,irregular,f,1,,,,maison,maisons,,\n"+
+		"aller,to go,verb,,1,true,,,,,suis allé|es allé|est allé|sommes allés|êtes allés|sont allés,vais|vas|va|allons|allez|vont\n"+
+		"# end of export: 4 cards\n",
+		buffer.String())
+
+	cards, err := deck.ReadCSV(strings.NewReader(buffer.String()))
+	assert.NoError(t, err)
+	assert.Equal(t, exportedCards, cards)
+}
+
+func TestCSVWriter_NoCards(t *testing.T) {
+	var buffer strings.Builder
+	writer := deck.NewCSVWriter(&buffer, nil)
+	assert.NoError(t, writer.Close())
+	assert.Equal(t, "word,translations,word_type,gender,level,is_irregular_verb,m.s.,m.p.,f.s.,f.p.\n# end of export: 0 cards\n", buffer.String())
+}
+
+func TestCSVWriter_UnknownTense(t *testing.T) {
+	writer := deck.NewCSVWriter(&strings.Builder{}, []string{"présent"})
+	err := writer.Write(api.Card{Word: "finir", WordType: "verb", Forms: map[string][]string{"futur": {"finirai"}}})
+	assert.EqualError(t, err, `deck - CSVWriter: card "finir" has no column for "futur"`)
+}
@@ -0,0 +1,103 @@
+package deck
+
+import (
+	"bytes"
+	"crabigateur-api/pkg/api"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+type Format string
+
+const (
+	CSV    Format = "csv"
+	JSON   Format = "json"   // an array of api.Card
+	NDJSON Format = "ndjson" // one api.Card per line
+	Apkg   Format = "apkg"   // an Anki package
+)
+
+// A complete export ends with a line counting its cards, which a file cut
+// short, e.g. by a timeout, lacks. Readers check the count when the line is
+// there, files written by hand may leave it out.
+const endOfExport = "end of export"
+
+// checkEndOfExport compares the count of the end of export line with the
+// cards read before it
+func checkEndOfExport(count, read int) error {
+	if count != read {
+		return fmt.Errorf("%s counts %d cards, %d were read", endOfExport, count, read)
+	}
+	return nil
+}
+
+var errAfterEndOfExport = fmt.Errorf("card after the %s", endOfExport)
+
+// FormatOfFile tells the format of a file from its extension
+func FormatOfFile(path string) (Format, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".csv":
+		return CSV, nil
+	case ".json":
+		return JSON, nil
+	case ".ndjson", ".jsonl":
+		return NDJSON, nil
+	case ".apkg":
+		return Apkg, nil
+	default:
+		return "", fmt.Errorf("unsupported file extension %q, expected .csv, .json, .ndjson or .apkg", ext)
+	}
+}
+
+// FormatOfContentType tells the format of a request body from its Content-Type
+func FormatOfContentType(contentType string) (Format, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("invalid content type %q", contentType)
+	}
+
+	switch mediaType {
+	case "text/csv":
+		return CSV, nil
+	case "application/json":
+		return JSON, nil
+	case NDJSONContentType:
+		return NDJSON, nil
+	default:
+		return "", fmt.Errorf("unsupported content type %q, expected text/csv, application/json or %s", mediaType, NDJSONContentType)
+	}
+}
+
+// Read reads the cards of r in format. Anki packages are read in memory with
+// the default AnkiOptions, see ReadApkg to read them from a file.
+func Read(r io.Reader, format Format) ([]api.Card, error) {
+	switch format {
+	case CSV:
+		return ReadCSV(r)
+	case JSON:
+		return ReadJSON(r)
+	case NDJSON:
+		return ReadNDJSON(r)
+	case Apkg:
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("deck - Read: %w", err)
+		}
+		deck, err := ReadApkg(bytes.NewReader(content), int64(len(content)), AnkiOptions{})
+		return deck.Cards, err
+	default:
+		return nil, fmt.Errorf("deck - Read: unsupported format %q", format)
+	}
+}
+
+// ReadJSON reads a JSON array of cards
+func ReadJSON(r io.Reader) ([]api.Card, error) {
+	var cards []api.Card
+	if err := json.NewDecoder(r).Decode(&cards); err != nil {
+		return nil, fmt.Errorf("deck - ReadJSON: %w", err)
+	}
+	return cards, nil
+}
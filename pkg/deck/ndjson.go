@@ -0,0 +1,110 @@
+package deck
+
+import (
+	"bufio"
+	"bytes"
+	"crabigateur-api/pkg/api"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// NDJSONContentType is the media type of newline delimited JSON
+const NDJSONContentType = "application/x-ndjson"
+
+// maxLineSize bounds a line of NDJSON, a card and all of its conjugations
+const maxLineSize = 1 << 20
+
+// CardWriter writes cards one at a time, so that a deck can be streamed.
+// Close writes the buffered cards and the end of the export, and reports the
+// first error of any write. A file that is not closed lacks that end.
+type CardWriter interface {
+	Write(card api.Card) error
+	Close() error
+}
+
+// ndjsonEnd is the last line of an NDJSON export, e.g. {"end_of_export":true,"cards":12}
+type ndjsonEnd struct {
+	EndOfExport bool `json:"end_of_export"`
+	Cards       int  `json:"cards"`
+}
+
+var ndjsonEndPrefix = []byte(`{"end_of_export"`)
+
+// ReadNDJSON reads one card per line, blank lines are skipped. The end of an
+// export, when there, must count the cards before it.
+func ReadNDJSON(r io.Reader) ([]api.Card, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+
+	var cards []api.Card
+	ended := false
+	for line := 1; scanner.Scan(); line++ {
+		content := bytes.TrimSpace(scanner.Bytes())
+		if len(content) == 0 {
+			continue
+		} else if ended {
+			return nil, fmt.Errorf("deck - ReadNDJSON: %w", &RowError{Line: line, Err: errAfterEndOfExport})
+		}
+
+		if bytes.HasPrefix(content, ndjsonEndPrefix) {
+			var end ndjsonEnd
+			err := json.Unmarshal(content, &end)
+			if err == nil {
+				err = checkEndOfExport(end.Cards, len(cards))
+			}
+			if err != nil {
+				return nil, fmt.Errorf("deck - ReadNDJSON: %w", &RowError{Line: line, Err: err})
+			}
+			ended = true
+			continue
+		}
+
+		var card api.Card
+		if err := json.Unmarshal(content, &card); err != nil {
+			// a failed read ends the input in the middle of a line
+			if readErr := scanner.Err(); readErr != nil {
+				return nil, fmt.Errorf("deck - ReadNDJSON: %w", readErr)
+			}
+			return nil, fmt.Errorf("deck - ReadNDJSON: %w", &RowError{Line: line, Err: err})
+		}
+		cards = append(cards, card)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("deck - ReadNDJSON: %w", err)
+	}
+
+	return cards, nil
+}
+
+type ndjsonWriter struct {
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	count   int
+}
+
+// NewNDJSONWriter writes each card as a JSON object on its own line
+func NewNDJSONWriter(w io.Writer) CardWriter {
+	writer := bufio.NewWriter(w)
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+	return &ndjsonWriter{writer: writer, encoder: encoder}
+}
+
+func (n *ndjsonWriter) Write(card api.Card) error {
+	if err := n.encoder.Encode(card); err != nil {
+		return fmt.Errorf("deck - NDJSONWriter: %w", err)
+	}
+	n.count++
+	return nil
+}
+
+func (n *ndjsonWriter) Close() error {
+	if err := n.encoder.Encode(ndjsonEnd{EndOfExport: true, Cards: n.count}); err != nil {
+		return fmt.Errorf("deck - NDJSONWriter: %w", err)
+	}
+	if err := n.writer.Flush(); err != nil {
+		return fmt.Errorf("deck - NDJSONWriter: %w", err)
+	}
+	return nil
+}
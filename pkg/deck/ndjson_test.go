@@ -0,0 +1,94 @@
+package deck_test
+
+import (
+	"crabigateur-api/pkg/api"
+	"crabigateur-api/pkg/deck"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// exportedCards are cards as the storage exports them, ids left out
+var exportedCards = []api.Card{
+	{Level: 1, Word: "chat", WordType: "regular", Gender: "m", Translation: []string{"cat"}},
+	{Level: 2, Word: "beau", WordType: "irregular", Gender: "m", Translation: []string{"beautiful, handsome", "fine"},
+		Forms: map[string][]string{"m.s.": {"beau"}, "m.p.": {"beaux"}, "f.s.": {"belle"}, "f.p.": {"belles"}}},
+	{Level: 1, Word: "maison", WordType: "irregular", Gender: "f", Translation: []string{"house"},
+		Forms: map[string][]string{"f.s.": {"maison"}, "f.p.": {"maisons"}}},
+	{Level: 1, Word: "aller", WordType: "verb", Translation: []string{"to go"}, IrregularVerb: true,
+		Forms: map[string][]string{
+			"présent":       {"vais", "vas", "va", "allons", "allez", "vont"},
+			"passé composé": {"suis allé", "es allé", "est allé", "sommes allés", "êtes allés", "sont allés"},
+		}},
+}
+
+func TestNDJSONRoundTrip(t *testing.T) {
+	var buffer strings.Builder
+	writer := deck.NewNDJSONWriter(&buffer)
+	for _, card := range exportedCards {
+		assert.NoError(t, writer.Write(card))
+	}
+	assert.NoError(t, writer.Close())
+
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	if !assert.Len(t, lines, len(exportedCards)+1) {
+		return
+	}
+	assert.Equal(t, `{"card_id":0,"level":1,"word_type":"regular","translations":["cat"],"word":"chat","gender":"m","forms":null,"is_irregular_verb":false}`, lines[0])
+	assert.Equal(t, `{"end_of_export":true,"cards":4}`, lines[len(lines)-1])
+
+	cards, err := deck.ReadNDJSON(strings.NewReader(buffer.String()))
+	assert.NoError(t, err)
+	assert.Equal(t, exportedCards, cards)
+}
+
+func TestReadNDJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		expected  []api.Card
+		expectErr string
+	}{
+		{
+			name:     "Blank lines are skipped",
+			input:    "{\"word\": \"chat\", \"level\": 1}\n\n  \r\n{\"word\": \"chien\", \"level\": 2}",
+			expected: []api.Card{{Word: "chat", Level: 1}, {Word: "chien", Level: 2}},
+		},
+		{
+			name:      "Malformed line",
+			input:     "{\"word\": \"chat\"}\n{\"word\": \"chien\", \"level\": \"one\"}\n",
+			expectErr: "deck - ReadNDJSON: line 2: json: cannot unmarshal string into Go struct field Card.level of type int",
+		},
+		{
+			name:     "End of export",
+			input:    "{\"word\": \"chat\", \"level\": 1}\n{\"end_of_export\":true,\"cards\":1}\n\n",
+			expected: []api.Card{{Word: "chat", Level: 1}},
+		},
+		{
+			name:      "Export cut short",
+			input:     "{\"word\": \"chat\", \"level\": 1}\n{\"end_of_export\":true,\"cards\":2}\n",
+			expectErr: "deck - ReadNDJSON: line 2: end of export counts 2 cards, 1 were read",
+		},
+		{
+			name:      "Card after the end of export",
+			input:     "{\"end_of_export\":true,\"cards\":0}\n{\"word\": \"chat\", \"level\": 1}\n",
+			expectErr: "deck - ReadNDJSON: line 2: card after the end of export",
+		},
+		{
+			name: "Empty input",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cards, err := deck.ReadNDJSON(strings.NewReader(tt.input))
+			if tt.expectErr != "" {
+				assert.EqualError(t, err, tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, cards)
+		})
+	}
+}
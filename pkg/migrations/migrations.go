@@ -0,0 +1,313 @@
+// Package migrations applies the versioned database schema embedded in the binary.
+//
+// Each migration is a pair of files in sql/ named <version>_<name>.up.sql and
+// <version>_<name>.down.sql. Applied versions are recorded in schema_migrations,
+// and every step runs in its own transaction so a failing migration leaves the
+// schema at the previous version.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+//go:embed sql/*.sql
+var embedded embed.FS
+
+// lockId is the advisory lock key taken by every migration step, so that two
+// servers started with -migrate do not apply the same version concurrently
+const lockId = 7_400_113
+
+const (
+	createMigrationsTable = `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`
+	lockMigrations    = `SELECT pg_advisory_xact_lock($1)`
+	currentVersion    = `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`
+	insertVersion     = `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`
+	deleteVersion     = `DELETE FROM schema_migrations WHERE version = $1`
+	deleteAllVersions = `DELETE FROM schema_migrations`
+)
+
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Embedded returns the migrations compiled into the binary, ordered by version
+func Embedded() ([]Migration, error) {
+	return Load(embedded, "sql")
+}
+
+// Load reads the migrations in dir of fsys, ordered by version. Every version
+// needs an up file; the down file is optional but required to roll back past it.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("migrations - Load: %s", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migrations - Load: unexpected file name %q", entry.Name())
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migrations - Load: invalid version in %q", entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("migrations - Load: %s", err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migrations - Load: version %d has two names: %q and %q", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migrations - Load: version %d has no up migration", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewMigrator returns a Migrator applying migrations, which must be ordered by version
+func NewMigrator(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}
+}
+
+// Latest is the highest version known to the migrator, i.e. the version the
+// database is at once Up has run
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version is the highest version recorded in schema_migrations, 0 for an empty
+// database. It only reads, so it can be polled by readiness checks.
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	var version int
+	err := m.db.QueryRowContext(ctx, currentVersion).Scan(&version)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Name() == "undefined_table" {
+		return 0, nil // schema_migrations is created by the first Up
+	} else if err != nil {
+		return 0, fmt.Errorf("migrations - Version: %w", err)
+	}
+
+	return version, nil
+}
+
+// Up applies every pending migration in order and returns the ones it applied
+func (m *Migrator) Up() ([]Migration, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for {
+		var next *Migration
+		err := m.step(func(tx *sql.Tx, version int) error {
+			for i := range m.migrations {
+				if m.migrations[i].Version > version {
+					next = &m.migrations[i]
+					break
+				}
+			}
+			if next == nil {
+				return nil
+			}
+
+			if _, err := tx.Exec(next.Up); err != nil {
+				return fmt.Errorf("migrations - Up %d_%s: %s", next.Version, next.Name, err)
+			}
+			if _, err := tx.Exec(insertVersion, next.Version, next.Name); err != nil {
+				return fmt.Errorf("migrations - Up %d_%s: %s", next.Version, next.Name, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return applied, err
+		}
+		if next == nil {
+			return applied, nil
+		}
+		applied = append(applied, *next)
+	}
+}
+
+// Down rolls back up to steps migrations, newest first, and returns the ones it rolled back
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for len(reverted) < steps {
+		var current *Migration
+		err := m.step(func(tx *sql.Tx, version int) error {
+			if version == 0 {
+				return nil
+			}
+
+			for i := range m.migrations {
+				if m.migrations[i].Version == version {
+					current = &m.migrations[i]
+				}
+			}
+			if current == nil {
+				return fmt.Errorf("migrations - Down: database is at unknown version %d", version)
+			}
+			if current.Down == "" {
+				return fmt.Errorf("migrations - Down %d_%s: no down migration", current.Version, current.Name)
+			}
+
+			if _, err := tx.Exec(current.Down); err != nil {
+				return fmt.Errorf("migrations - Down %d_%s: %s", current.Version, current.Name, err)
+			}
+			if _, err := tx.Exec(deleteVersion, current.Version); err != nil {
+				return fmt.Errorf("migrations - Down %d_%s: %s", current.Version, current.Name, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return reverted, err
+		}
+		if current == nil {
+			break
+		}
+		reverted = append(reverted, *current)
+	}
+
+	return reverted, nil
+}
+
+// Force records the database as being at version without running any migration.
+// It is meant for databases created before migrations existed, e.g. from the old
+// db/structure.sql, which match version 1.
+func (m *Migrator) Force(version int) error {
+	if version != 0 && !m.known(version) {
+		return fmt.Errorf("migrations - Force: unknown version %d", version)
+	}
+
+	if err := m.ensureTable(); err != nil {
+		return err
+	}
+
+	return m.step(func(tx *sql.Tx, _ int) error {
+		if _, err := tx.Exec(deleteAllVersions); err != nil {
+			return fmt.Errorf("migrations - Force: %s", err)
+		}
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				break
+			}
+			if _, err := tx.Exec(insertVersion, migration.Version, migration.Name); err != nil {
+				return fmt.Errorf("migrations - Force: %s", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Migrator) known(version int) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Migrator) ensureTable() error {
+	if _, err := m.db.Exec(createMigrationsTable); err != nil {
+		return fmt.Errorf("migrations - schema_migrations: %s", err)
+	}
+	return nil
+}
+
+// step runs fn in a transaction holding the migration lock, passing it the
+// version the database is at once the lock is acquired
+func (m *Migrator) step(fn func(tx *sql.Tx, version int) error) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("migrations - begin: %s", err)
+	}
+
+	if _, err := tx.Exec(lockMigrations, lockId); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("migrations - lock: %s", err)
+	}
+
+	var version int
+	if err := tx.QueryRow(currentVersion).Scan(&version); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("migrations - version: %s", err)
+	}
+
+	if err := fn(tx, version); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("migrations - commit: %s", err)
+	}
+
+	return nil
+}
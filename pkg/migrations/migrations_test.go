@@ -0,0 +1,297 @@
+package migrations_test
+
+import (
+	"context"
+	"crabigateur-api/pkg/migrations"
+	"fmt"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+var testMigrations = []migrations.Migration{
+	{Version: 1, Name: "initial", Up: "CREATE TABLE a (id INT)", Down: "DROP TABLE a"},
+	{Version: 2, Name: "add_b", Up: "CREATE TABLE b (id INT)", Down: "DROP TABLE b"},
+}
+
+func expectStep(mock sqlmock.Sqlmock, version int) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\) FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(version))
+}
+
+func TestEmbedded(t *testing.T) {
+	embedded, err := migrations.Embedded()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, embedded)
+
+	for i, migration := range embedded {
+		assert.Equal(t, i+1, migration.Version, "versions must be contiguous")
+		assert.NotEmpty(t, migration.Up, "version %d has no up migration", migration.Version)
+		assert.NotEmpty(t, migration.Down, "version %d has no down migration", migration.Version)
+	}
+
+	assert.Contains(t, embedded[0].Up, "CREATE TABLE Users")
+	assert.NotContains(t, embedded[0].Up, "DROP TABLE")
+	// version 1 is the baseline schema, later columns come in their own versions
+	assert.NotContains(t, embedded[0].Up, "schedulers")
+	assert.NotContains(t, embedded[0].Up, "client_review_id")
+	if assert.GreaterOrEqual(t, len(embedded), 6) {
+		assert.Contains(t, embedded[4].Up, "ADD COLUMN scheduler")
+		assert.Contains(t, embedded[5].Up, "ADD COLUMN client_review_id")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     fstest.MapFS
+		expected  []migrations.Migration
+		expectErr bool
+	}{
+		{
+			name: "Orders by version",
+			files: fstest.MapFS{
+				"sql/0002_add_b.up.sql":     {Data: []byte("CREATE TABLE b (id INT)")},
+				"sql/0002_add_b.down.sql":   {Data: []byte("DROP TABLE b")},
+				"sql/0001_initial.up.sql":   {Data: []byte("CREATE TABLE a (id INT)")},
+				"sql/0001_initial.down.sql": {Data: []byte("DROP TABLE a")},
+			},
+			expected:  testMigrations,
+			expectErr: false,
+		},
+		{
+			name: "Down migration is optional",
+			files: fstest.MapFS{
+				"sql/0001_initial.up.sql": {Data: []byte("CREATE TABLE a (id INT)")},
+			},
+			expected:  []migrations.Migration{{Version: 1, Name: "initial", Up: "CREATE TABLE a (id INT)"}},
+			expectErr: false,
+		},
+		{
+			name: "Missing up migration",
+			files: fstest.MapFS{
+				"sql/0001_initial.down.sql": {Data: []byte("DROP TABLE a")},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Unexpected file name",
+			files: fstest.MapFS{
+				"sql/initial.sql": {Data: []byte("CREATE TABLE a (id INT)")},
+			},
+			expectErr: true,
+		},
+		{
+			name: "Mismatched names for a version",
+			files: fstest.MapFS{
+				"sql/0001_initial.up.sql": {Data: []byte("CREATE TABLE a (id INT)")},
+				"sql/0001_other.down.sql": {Data: []byte("DROP TABLE a")},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := migrations.Load(tt.files, "sql")
+
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestUp(t *testing.T) {
+	tests := []struct {
+		name      string
+		mockSetup func(mock sqlmock.Sqlmock)
+		expected  []int
+		expectErr bool
+	}{
+		{
+			name: "Applies pending migrations in order",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				expectStep(mock, 0)
+				mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE a (id INT)")).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`INSERT INTO schema_migrations`).WithArgs(1, "initial").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+				expectStep(mock, 1)
+				mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE b (id INT)")).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`INSERT INTO schema_migrations`).WithArgs(2, "add_b").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+				expectStep(mock, 2)
+				mock.ExpectCommit()
+			},
+			expected:  []int{1, 2},
+			expectErr: false,
+		},
+		{
+			name: "Up to date",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				expectStep(mock, 2)
+				mock.ExpectCommit()
+			},
+			expected:  nil,
+			expectErr: false,
+		},
+		{
+			name: "Failing migration is rolled back",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				expectStep(mock, 1)
+				mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE b (id INT)")).WillReturnError(fmt.Errorf("syntax error"))
+				mock.ExpectRollback()
+			},
+			expected:  nil,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+			tt.mockSetup(mock)
+
+			applied, err := migrations.NewMigrator(db, testMigrations).Up()
+
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expected, versions(applied))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestDown(t *testing.T) {
+	tests := []struct {
+		name      string
+		steps     int
+		mockSetup func(mock sqlmock.Sqlmock)
+		expected  []int
+		expectErr bool
+	}{
+		{
+			name:  "Rolls back the latest migration",
+			steps: 1,
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				expectStep(mock, 2)
+				mock.ExpectExec(regexp.QuoteMeta("DROP TABLE b")).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`DELETE FROM schema_migrations WHERE version`).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			expected:  []int{2},
+			expectErr: false,
+		},
+		{
+			name:  "Stops at an empty database",
+			steps: 5,
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				expectStep(mock, 1)
+				mock.ExpectExec(regexp.QuoteMeta("DROP TABLE a")).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`DELETE FROM schema_migrations WHERE version`).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectStep(mock, 0)
+				mock.ExpectCommit()
+			},
+			expected:  []int{1},
+			expectErr: false,
+		},
+		{
+			name:  "Unknown version",
+			steps: 1,
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				expectStep(mock, 3)
+				mock.ExpectRollback()
+			},
+			expected:  nil,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+			tt.mockSetup(mock)
+
+			reverted, err := migrations.NewMigrator(db, testMigrations).Down(tt.steps)
+
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expected, versions(reverted))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestForce(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	migrator := migrations.NewMigrator(db, testMigrations)
+	assert.Error(t, migrator.Force(3))
+
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectStep(mock, 0)
+	mock.ExpectExec(`DELETE FROM schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO schema_migrations`).WithArgs(1, "initial").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, migrator.Force(1))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVersion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\) FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\) FROM schema_migrations`).
+		WillReturnError(&pq.Error{Code: "42P01"})
+
+	migrator := migrations.NewMigrator(db, testMigrations)
+	version, err := migrator.Version(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, version)
+	assert.Equal(t, 2, migrator.Latest())
+
+	version, err = migrator.Version(context.Background())
+	assert.NoError(t, err, "a database never migrated has no schema_migrations yet")
+	assert.Equal(t, 0, version)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func versions(applied []migrations.Migration) []int {
+	var result []int
+	for _, migration := range applied {
+		result = append(result, migration.Version)
+	}
+	return result
+}
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS Reviews;
+DROP TABLE IF EXISTS UserCardStatus;
+DROP TABLE IF EXISTS SRSStages;
+DROP TABLE IF EXISTS Forms;
+DROP TABLE IF EXISTS Conjugations;
+DROP INDEX IF EXISTS unique_word_gender;
+DROP TABLE IF EXISTS Cards;
+DROP TABLE IF EXISTS Users;
+
+DROP TYPE IF EXISTS grammatical_number;
+DROP TYPE IF EXISTS genders;
+DROP TYPE IF EXISTS word_types;
@@ -3,7 +3,6 @@ CREATE TYPE word_types AS ENUM ('regular', 'irregular', 'verb');
 CREATE TYPE genders AS ENUM ('m', 'f');
 CREATE TYPE grammatical_number AS ENUM ('singular', 'plural');
 
-DROP TABLE IF EXISTS Users; 
 CREATE TABLE Users (
     user_id VARCHAR(255),
     username VARCHAR (50),
@@ -13,7 +12,6 @@ CREATE TABLE Users (
     PRIMARY KEY (user_id)
 );
 
-DROP TABLE IF EXISTS Cards; 
 CREATE TABLE Cards (
     card_id SERIAL PRIMARY KEY,
     word VARCHAR(50) NOT NULL,
@@ -24,11 +22,9 @@ CREATE TABLE Cards (
 );
 
 -- Create a unique index to enforce uniqueness on (word, gender), treating NULL as '__null__'
-DROP INDEX IF EXISTS unique_word_gender;
-CREATE UNIQUE INDEX unique_word_gender 
+CREATE UNIQUE INDEX unique_word_gender
 ON Cards ((word || '|' || COALESCE(gender, '__null__')));
 
-DROP TABLE IF EXISTS Conjugations; 
 CREATE TABLE Conjugations (
     conjugation_id SERIAL,
     card_id INT not null,
@@ -40,7 +36,6 @@ CREATE TABLE Conjugations (
     UNIQUE(card_id, tense)
 );
 
-DROP TABLE IF EXISTS Forms; 
 CREATE TABLE Forms (
     form_id SERIAL,
     card_id INT not null,
@@ -52,7 +47,6 @@ CREATE TABLE Forms (
     UNIQUE(card_id, gender, number)
 );
 
-DROP TABLE IF EXISTS SRSStages; 
 CREATE TABLE SRSStages (
     stage_id INT CHECK (stage_id BETWEEN 1 AND 9),
     stage_name VARCHAR(12) not null,
@@ -61,7 +55,6 @@ CREATE TABLE SRSStages (
     PRIMARY KEY (stage_id)
 );
 
-DROP TABLE IF EXISTS UserCardStatus; 
 CREATE TABLE UserCardStatus (
     user_id VARCHAR(255),
     card_id INT,
@@ -73,7 +66,6 @@ CREATE TABLE UserCardStatus (
     FOREIGN KEY (stage_id) REFERENCES SRSStages(stage_id)
 );
 
-DROP TABLE IF EXISTS Reviews; 
 CREATE TABLE Reviews (
     review_id SERIAL,
     user_id VARCHAR(255) not null,
@@ -85,5 +77,3 @@ CREATE TABLE Reviews (
     FOREIGN KEY (user_id) REFERENCES Users(user_id),
     FOREIGN KEY (card_id) REFERENCES Cards(card_id) ON DELETE CASCADE
 );
-
-
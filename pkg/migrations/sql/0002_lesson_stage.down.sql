@@ -0,0 +1,3 @@
+-- fails while any card is still at the lesson stage
+ALTER TABLE UserCardStatus DROP CONSTRAINT usercardstatus_stage_id_check;
+ALTER TABLE UserCardStatus ADD CONSTRAINT usercardstatus_stage_id_fkey FOREIGN KEY (stage_id) REFERENCES SRSStages(stage_id);
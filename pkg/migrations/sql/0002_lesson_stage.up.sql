@@ -0,0 +1,4 @@
+-- Lessons are stored in UserCardStatus at stage 0, which has no SRSStages row
+-- (stage ids are 1 to 9), so the foreign key rejected every new lesson.
+ALTER TABLE UserCardStatus DROP CONSTRAINT usercardstatus_stage_id_fkey;
+ALTER TABLE UserCardStatus ADD CONSTRAINT usercardstatus_stage_id_check CHECK (stage_id BETWEEN 0 AND 9);
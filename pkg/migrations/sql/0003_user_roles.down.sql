@@ -0,0 +1,3 @@
+ALTER TABLE Users DROP COLUMN role;
+
+DROP TYPE roles;
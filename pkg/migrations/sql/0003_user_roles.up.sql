@@ -0,0 +1,3 @@
+CREATE TYPE roles AS ENUM ('learner', 'editor', 'admin');
+
+ALTER TABLE Users ADD COLUMN role roles NOT NULL DEFAULT 'learner';
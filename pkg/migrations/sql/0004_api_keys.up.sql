@@ -0,0 +1,13 @@
+CREATE TABLE ApiKeys (
+    key_id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    -- public part of the key, used to look it up
+    prefix VARCHAR(16) NOT NULL UNIQUE,
+    -- SHA-256 of the full key, which is never stored
+    key_hash BYTEA NOT NULL,
+    scopes TEXT[] NOT NULL,
+    created_by VARCHAR(255) REFERENCES Users(user_id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
@@ -0,0 +1,8 @@
+ALTER TABLE UserCardStatus DROP COLUMN retrievability;
+ALTER TABLE UserCardStatus DROP COLUMN stability;
+ALTER TABLE UserCardStatus DROP COLUMN difficulty;
+ALTER TABLE UserCardStatus DROP COLUMN last_review_date;
+
+ALTER TABLE Users DROP COLUMN scheduler;
+
+DROP TYPE schedulers;
@@ -0,0 +1,10 @@
+-- Scheduler per user and the FSRS memory state of each card
+CREATE TYPE schedulers AS ENUM ('stages', 'fsrs');
+
+ALTER TABLE Users ADD COLUMN scheduler schedulers NOT NULL DEFAULT 'stages';
+
+ALTER TABLE UserCardStatus ADD COLUMN last_review_date TIMESTAMPTZ;
+-- FSRS memory state, NULL until the card is scheduled by FSRS
+ALTER TABLE UserCardStatus ADD COLUMN difficulty DOUBLE PRECISION;
+ALTER TABLE UserCardStatus ADD COLUMN stability DOUBLE PRECISION;
+ALTER TABLE UserCardStatus ADD COLUMN retrievability DOUBLE PRECISION;
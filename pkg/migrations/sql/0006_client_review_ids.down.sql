@@ -0,0 +1,6 @@
+ALTER TABLE Reviews DROP CONSTRAINT reviews_user_id_client_review_id_key;
+
+-- review dates go back to days: the time of day of each review is lost
+ALTER TABLE Reviews ALTER COLUMN review_date TYPE DATE USING review_date::date;
+ALTER TABLE Reviews DROP COLUMN new_stage;
+ALTER TABLE Reviews DROP COLUMN client_review_id;
@@ -0,0 +1,7 @@
+-- Idempotent review submissions: the id a client gives a review, unique per
+-- user, the stage it moved the card to and the time it was made
+ALTER TABLE Reviews ADD COLUMN client_review_id UUID;
+ALTER TABLE Reviews ADD COLUMN new_stage INT CHECK (new_stage BETWEEN 1 AND 9);
+ALTER TABLE Reviews ALTER COLUMN review_date TYPE TIMESTAMPTZ USING review_date::timestamptz;
+
+ALTER TABLE Reviews ADD CONSTRAINT reviews_user_id_client_review_id_key UNIQUE (user_id, client_review_id);
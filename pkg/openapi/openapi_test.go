@@ -0,0 +1,71 @@
+package openapi_test
+
+import (
+	"crabigateur-api/pkg/openapi"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Lesson struct {
+	Id       int               `json:"id" binding:"required,gte=1"`
+	Title    string            `json:"title" binding:"required,max=80,slug"`
+	Kind     string            `json:"kind" binding:"omitempty,oneof=noun verb"`
+	Tags     []string          `json:"tags" binding:"max=5,dive,min=2"`
+	Starts   *time.Time        `json:"starts"`
+	Parent   *Lesson           `json:"parent,omitempty"`
+	Notes    map[string]string `json:"notes"`
+	internal string
+	Ignored  string `json:"-"`
+}
+
+type LessonQuery struct {
+	Level  *int     `form:"level" binding:"omitempty,gte=0"`
+	Sort   []string `form:"sort" binding:"required"`
+	UserId string   `uri:"user_id" binding:"required,numeric"`
+}
+
+func TestSchema(t *testing.T) {
+	doc := openapi.New(openapi.Info{Title: "test", Version: "1"})
+	doc.RegisterValidation("slug", func(schema *openapi.Schema) {
+		schema.Pattern = "^[a-z-]+$"
+	})
+
+	assert.Equal(t, &openapi.Schema{Ref: "#/components/schemas/Lesson"}, doc.Schema(Lesson{}))
+	assert.Equal(t, &openapi.Schema{Type: "array", Items: &openapi.Schema{Ref: "#/components/schemas/Lesson"}}, doc.Schema([]Lesson{}))
+
+	lesson := doc.Components.Schemas["Lesson"]
+	assert.Equal(t, []string{"id", "title"}, lesson.Required)
+	assert.Len(t, lesson.Properties, 7)
+
+	one, eighty, five, two := 1.0, 80, 5, 2
+	assert.Equal(t, &openapi.Schema{Type: "integer", Format: "int32", Minimum: &one}, lesson.Properties["id"])
+	assert.Equal(t, &openapi.Schema{Type: "string", MaxLength: &eighty, Pattern: "^[a-z-]+$"}, lesson.Properties["title"])
+	assert.Equal(t, []any{"noun", "verb"}, lesson.Properties["kind"].Enum)
+	assert.Equal(t, &openapi.Schema{Type: "array", MaxItems: &five, Items: &openapi.Schema{Type: "string", MinLength: &two}}, lesson.Properties["tags"])
+	assert.Equal(t, &openapi.Schema{Type: "string", Format: "date-time", Nullable: true}, lesson.Properties["starts"])
+	assert.Equal(t, "#/components/schemas/Lesson", lesson.Properties["parent"].Ref, "recursive types are referenced")
+	assert.Equal(t, &openapi.Schema{Type: "string"}, lesson.Properties["notes"].AdditionalProperties)
+}
+
+func TestParameters(t *testing.T) {
+	doc := openapi.New(openapi.Info{Title: "test", Version: "1"})
+
+	query := doc.Parameters("query", LessonQuery{})
+	assert.Len(t, query, 2)
+	assert.Equal(t, "level", query[0].Name)
+	assert.False(t, query[0].Required)
+	assert.False(t, query[0].Schema.Nullable)
+	assert.Equal(t, "sort", query[1].Name)
+	assert.True(t, query[1].Required)
+
+	path := doc.Parameters("path", LessonQuery{})
+	assert.Equal(t, []openapi.Parameter{{Name: "user_id", In: "path", Required: true, Schema: &openapi.Schema{Type: "string", Pattern: "^[0-9]+$"}}}, path)
+}
+
+func TestPath(t *testing.T) {
+	assert.Equal(t, "/users/{user_id}/role", openapi.Path("/users/:user_id/role"))
+	assert.Equal(t, "/files/{path}", openapi.Path("/files/*path"))
+	assert.Equal(t, "/status", openapi.Path("/status"))
+}
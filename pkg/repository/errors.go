@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"crabigateur-api/pkg/api"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// storageError wraps err, the failure of op, with the api error kind matching
+// it, e.g. api.ErrDuplicate for a unique violation. Errors of no known kind are
+// only wrapped, and end up as internal errors.
+func storageError(op string, err error) error {
+	if kind := errorKind(err); kind != nil {
+		return fmt.Errorf("storage - %s: %w: %w", op, kind, err)
+	}
+	return fmt.Errorf("storage - %s: %w", op, err)
+}
+
+func errorKind(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return api.ErrNotFound
+	}
+
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return nil
+	}
+
+	switch pqErr.Code.Class() {
+	case "22": // data exception: value too long, out of range, bad text representation...
+		return api.ErrValidation
+	case "40": // serialization failure or deadlock, the client may retry
+		return api.ErrConflict
+	}
+
+	switch pqErr.Code.Name() {
+	case "unique_violation":
+		return api.ErrDuplicate
+	case "foreign_key_violation":
+		return api.ErrConflict
+	case "not_null_violation", "check_violation":
+		return api.ErrValidation
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether err was raised by the unique constraint or index named constraint
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code.Name() == "unique_violation" && pqErr.Constraint == constraint
+}
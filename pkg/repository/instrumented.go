@@ -0,0 +1,250 @@
+package repository
+
+import (
+	"context"
+	"crabigateur-api/pkg/api"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "crabi_db_query_duration_seconds",
+		Help:    "Time taken by the Storage methods, transactions excluded.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+	queryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "crabi_db_query_errors_total",
+		Help: "Storage methods that returned an error.",
+	}, []string{"method"})
+)
+
+// instrumentedStorage times every method of the Storage it wraps. Methods
+// called inside transactions are timed as well, the transactions themselves
+// are not as their duration depends on the work of the caller.
+type instrumentedStorage struct {
+	storage Storage
+}
+
+// Instrument records the duration and errors of the methods of storage in
+// the crabi_db_query_* metrics
+func Instrument(storage Storage) Storage {
+	return &instrumentedStorage{storage: storage}
+}
+
+func observeQuery(method string, start time.Time, err *error) {
+	queryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if *err != nil {
+		queryErrors.WithLabelValues(method).Inc()
+	}
+}
+
+func (i *instrumentedStorage) WithTx(ctx context.Context, fn func(Storage) error) error {
+	return i.storage.WithTx(ctx, func(tx Storage) error {
+		return fn(&instrumentedStorage{storage: tx})
+	})
+}
+
+func (i *instrumentedStorage) WithUserTx(ctx context.Context, fn func(api.UserRepository) error) error {
+	return i.WithTx(ctx, func(tx Storage) error {
+		return fn(tx)
+	})
+}
+
+func (i *instrumentedStorage) WithCardTx(ctx context.Context, fn func(api.CardRepository) error) error {
+	return i.WithTx(ctx, func(tx Storage) error {
+		return fn(tx)
+	})
+}
+
+func (i *instrumentedStorage) GetLessons(ctx context.Context, userId string, numLessons int) (_ []api.Card, err error) {
+	defer observeQuery("GetLessons", time.Now(), &err)
+	return i.storage.GetLessons(ctx, userId, numLessons)
+}
+
+func (i *instrumentedStorage) GetReview(ctx context.Context, userId string, firstReview bool, sort []api.SortOrder) (_ []api.Card, err error) {
+	defer observeQuery("GetReview", time.Now(), &err)
+	return i.storage.GetReview(ctx, userId, firstReview, sort)
+}
+
+func (i *instrumentedStorage) InsertReview(ctx context.Context, userId string, cardId int) (_ api.ReviewResult, err error) {
+	defer observeQuery("InsertReview", time.Now(), &err)
+	return i.storage.InsertReview(ctx, userId, cardId)
+}
+
+func (i *instrumentedStorage) GetCardStatus(ctx context.Context, userId string, cardId int) (_ api.CardStatus, err error) {
+	defer observeQuery("GetCardStatus", time.Now(), &err)
+	return i.storage.GetCardStatus(ctx, userId, cardId)
+}
+
+func (i *instrumentedStorage) GetReviewResult(ctx context.Context, userId string, reviewId string) (_ api.ReviewResult, _ bool, err error) {
+	defer observeQuery("GetReviewResult", time.Now(), &err)
+	return i.storage.GetReviewResult(ctx, userId, reviewId)
+}
+
+func (i *instrumentedStorage) Ping(ctx context.Context) (err error) {
+	defer observeQuery("Ping", time.Now(), &err)
+	return i.storage.Ping(ctx)
+}
+
+func (i *instrumentedStorage) GetSRSStages(ctx context.Context) (_ api.StageTable, err error) {
+	defer observeQuery("GetSRSStages", time.Now(), &err)
+	return i.storage.GetSRSStages(ctx)
+}
+
+func (i *instrumentedStorage) InsertSRSStage(ctx context.Context, stage api.SRSStage) (_ bool, err error) {
+	defer observeQuery("InsertSRSStage", time.Now(), &err)
+	return i.storage.InsertSRSStage(ctx, stage)
+}
+
+func (i *instrumentedStorage) UpdateReview(ctx context.Context, userId string, review api.Review, schedule api.ScheduleResult) (_ api.ReviewResult, err error) {
+	defer observeQuery("UpdateReview", time.Now(), &err)
+	return i.storage.UpdateReview(ctx, userId, review, schedule)
+}
+
+func (i *instrumentedStorage) GetMostRecentReviews(ctx context.Context, userId string, numCards int) (_ []api.ReviewResult, err error) {
+	defer observeQuery("GetMostRecentReviews", time.Now(), &err)
+	return i.storage.GetMostRecentReviews(ctx, userId, numCards)
+}
+
+func (i *instrumentedStorage) CountPendingReviews(ctx context.Context, userId string) (_ int, err error) {
+	defer observeQuery("CountPendingReviews", time.Now(), &err)
+	return i.storage.CountPendingReviews(ctx, userId)
+}
+
+func (i *instrumentedStorage) GetRecentMistakes(ctx context.Context, userID string) (_ []api.CardTag, err error) {
+	defer observeQuery("GetRecentMistakes", time.Now(), &err)
+	return i.storage.GetRecentMistakes(ctx, userID)
+}
+
+func (i *instrumentedStorage) GetLevelProgress(ctx context.Context, userId string) (_ []api.CardProgress, err error) {
+	defer observeQuery("GetLevelProgress", time.Now(), &err)
+	return i.storage.GetLevelProgress(ctx, userId)
+}
+
+func (i *instrumentedStorage) GetWordStats(ctx context.Context, userId string) (_ map[string]map[string]int, err error) {
+	defer observeQuery("GetWordStats", time.Now(), &err)
+	return i.storage.GetWordStats(ctx, userId)
+}
+
+func (i *instrumentedStorage) GetUserLevel(ctx context.Context, userId string) (_ int, err error) {
+	defer observeQuery("GetUserLevel", time.Now(), &err)
+	return i.storage.GetUserLevel(ctx, userId)
+}
+
+func (i *instrumentedStorage) PromoteUser(ctx context.Context, userId string, level int) (_ bool, err error) {
+	defer observeQuery("PromoteUser", time.Now(), &err)
+	return i.storage.PromoteUser(ctx, userId, level)
+}
+
+func (i *instrumentedStorage) GetCard(ctx context.Context, id int) (_ api.Card, err error) {
+	defer observeQuery("GetCard", time.Now(), &err)
+	return i.storage.GetCard(ctx, id)
+}
+
+func (i *instrumentedStorage) FindCardId(ctx context.Context, word string, gender string) (_ int, _ bool, err error) {
+	defer observeQuery("FindCardId", time.Now(), &err)
+	return i.storage.FindCardId(ctx, word, gender)
+}
+
+func (i *instrumentedStorage) InsertCard(ctx context.Context, word string, translation []string, wordType string, gender string, level int) (_ int, err error) {
+	defer observeQuery("InsertCard", time.Now(), &err)
+	return i.storage.InsertCard(ctx, word, translation, wordType, gender, level)
+}
+
+func (i *instrumentedStorage) UpdateCard(ctx context.Context, cardId int, word string, translation []string, wordType string, gender string, level int) (err error) {
+	defer observeQuery("UpdateCard", time.Now(), &err)
+	return i.storage.UpdateCard(ctx, cardId, word, translation, wordType, gender, level)
+}
+
+func (i *instrumentedStorage) InsertOrUpdateConjugation(ctx context.Context, isUpdate bool, cardId int, tense string, forms []string, isIrregular bool) (err error) {
+	defer observeQuery("InsertOrUpdateConjugation", time.Now(), &err)
+	return i.storage.InsertOrUpdateConjugation(ctx, isUpdate, cardId, tense, forms, isIrregular)
+}
+
+func (i *instrumentedStorage) InsertOrUpdateForm(ctx context.Context, isUpdate bool, cardId int, gender string, number string, form string) (err error) {
+	defer observeQuery("InsertOrUpdateForm", time.Now(), &err)
+	return i.storage.InsertOrUpdateForm(ctx, isUpdate, cardId, gender, number, form)
+}
+
+func (i *instrumentedStorage) DeleteCard(ctx context.Context, cardId int) (err error) {
+	defer observeQuery("DeleteCard", time.Now(), &err)
+	return i.storage.DeleteCard(ctx, cardId)
+}
+
+func (i *instrumentedStorage) SearchCards(ctx context.Context, query api.CardQueryParams) (_ []api.Card, err error) {
+	defer observeQuery("SearchCards", time.Now(), &err)
+	return i.storage.SearchCards(ctx, query)
+}
+
+func (i *instrumentedStorage) ExportCards(ctx context.Context, fn func(api.Card) error) (err error) {
+	defer observeQuery("ExportCards", time.Now(), &err)
+	return i.storage.ExportCards(ctx, fn)
+}
+
+func (i *instrumentedStorage) GetTenses(ctx context.Context) (_ []string, err error) {
+	defer observeQuery("GetTenses", time.Now(), &err)
+	return i.storage.GetTenses(ctx)
+}
+
+func (i *instrumentedStorage) GetUser(ctx context.Context, userId string) (_ api.User, err error) {
+	defer observeQuery("GetUser", time.Now(), &err)
+	return i.storage.GetUser(ctx, userId)
+}
+
+func (i *instrumentedStorage) InsertUser(ctx context.Context, user api.User) (_ api.User, err error) {
+	defer observeQuery("InsertUser", time.Now(), &err)
+	return i.storage.InsertUser(ctx, user)
+}
+
+func (i *instrumentedStorage) UpdateUser(ctx context.Context, userId string, update api.UserUpdate) (_ api.User, err error) {
+	defer observeQuery("UpdateUser", time.Now(), &err)
+	return i.storage.UpdateUser(ctx, userId, update)
+}
+
+func (i *instrumentedStorage) DeleteUser(ctx context.Context, userId string) (_ bool, err error) {
+	defer observeQuery("DeleteUser", time.Now(), &err)
+	return i.storage.DeleteUser(ctx, userId)
+}
+
+func (i *instrumentedStorage) UpdateUserRole(ctx context.Context, userId string, role api.Role) (_ api.User, err error) {
+	defer observeQuery("UpdateUserRole", time.Now(), &err)
+	return i.storage.UpdateUserRole(ctx, userId, role)
+}
+
+func (i *instrumentedStorage) UpdateUserLevel(ctx context.Context, userId string, level int) (_ api.User, err error) {
+	defer observeQuery("UpdateUserLevel", time.Now(), &err)
+	return i.storage.UpdateUserLevel(ctx, userId, level)
+}
+
+func (i *instrumentedStorage) GetUsersByRole(ctx context.Context, role api.Role) (_ []api.User, err error) {
+	defer observeQuery("GetUsersByRole", time.Now(), &err)
+	return i.storage.GetUsersByRole(ctx, role)
+}
+
+func (i *instrumentedStorage) InsertApiKey(ctx context.Context, key api.ApiKey, hash []byte) (_ api.ApiKey, err error) {
+	defer observeQuery("InsertApiKey", time.Now(), &err)
+	return i.storage.InsertApiKey(ctx, key, hash)
+}
+
+func (i *instrumentedStorage) GetApiKeys(ctx context.Context) (_ []api.ApiKey, err error) {
+	defer observeQuery("GetApiKeys", time.Now(), &err)
+	return i.storage.GetApiKeys(ctx)
+}
+
+func (i *instrumentedStorage) GetApiKeyByPrefix(ctx context.Context, prefix string) (_ api.ApiKey, _ []byte, err error) {
+	defer observeQuery("GetApiKeyByPrefix", time.Now(), &err)
+	return i.storage.GetApiKeyByPrefix(ctx, prefix)
+}
+
+func (i *instrumentedStorage) RevokeApiKey(ctx context.Context, keyId int) (_ bool, err error) {
+	defer observeQuery("RevokeApiKey", time.Now(), &err)
+	return i.storage.RevokeApiKey(ctx, keyId)
+}
+
+func (i *instrumentedStorage) TouchApiKey(ctx context.Context, keyId int, usedAt time.Time) (err error) {
+	defer observeQuery("TouchApiKey", time.Now(), &err)
+	return i.storage.TouchApiKey(ctx, keyId, usedAt)
+}
@@ -5,7 +5,9 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 type Card struct {
@@ -17,6 +19,30 @@ type Card struct {
 	Gender      sql.NullString
 }
 
+type User struct {
+	UserId     string
+	Username   sql.NullString
+	Email      string
+	Level      sql.NullInt64
+	Scheduler  string
+	Role       string
+	DateJoined sql.NullTime
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+type CardStatus struct {
+	Stage          int
+	Scheduler      string
+	Difficulty     sql.NullFloat64
+	Stability      sql.NullFloat64
+	Retrievability sql.NullFloat64
+	LastReview     sql.NullTime
+}
+
 type Verb struct {
 	Tense     sql.NullString
 	Forms     *json.RawMessage
@@ -69,11 +95,20 @@ func getConjugationForms(f *json.RawMessage) ([]string, error) {
 	return []string{}, nil
 }
 
+// addFormToCard skips the NULL form the join yields for a card without forms
 func addFormToCard(card api.Card, form Form) {
+	if !form.Form.Valid {
+		return
+	}
 	card.Forms[getFormKey(form)] = []string{nullStringToString(form.Form)}
 }
 
+// addConjugationToCard skips the NULL tense the join yields for a verb
+// without conjugations
 func addConjugationToCard(card api.Card, verb Verb) error {
+	if !verb.Tense.Valid {
+		return nil
+	}
 	var err error
 	card.Forms[getConjugationKey(verb)], err = getConjugationForms(verb.Forms)
 	if err != nil {
@@ -120,8 +155,13 @@ func parseNewCardFromRow(card Card, verb Verb, form Form) (api.Card, error) {
 	case "regular":
 		newCard.Gender = nullStringToString(card.Gender)
 	case "irregular":
+		newCard.Gender = nullStringToString(card.Gender)
 		newCard.Forms = make(map[string][]string)
-		newCard.Forms["m.s."] = []string{card.Word}
+		// the word is the masculine singular unless the card says otherwise,
+		// a feminine noun has no masculine forms
+		if newCard.Gender != string(api.Fem) {
+			newCard.Forms["m.s."] = []string{card.Word}
+		}
 		addFormToCard(newCard, form)
 	case "verb":
 		newCard.Forms = make(map[string][]string)
@@ -146,8 +186,21 @@ func addMoreFormsToExistingCard(card api.Card, verb Verb, form Form) error {
 }
 
 func parseAllCardsFromQuery(rows *sql.Rows) ([]api.Card, error) {
-	var newCard api.Card
 	cards := []api.Card{}
+	err := eachCardFromQuery(rows, func(card api.Card) error {
+		cards = append(cards, card)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cards, nil
+}
+
+// eachCardFromQuery calls fn with each card of rows selected by CardSelector,
+// once all of its rows are read. The rows of a card must be next to each other.
+func eachCardFromQuery(rows *sql.Rows, fn func(api.Card) error) error {
+	var newCard api.Card
 	lastCardId := 0  // impossible card id to make sure uninitialized newCard isn't added to cards
 	hasRows := false // flag that ensures cards are only appended if query has results
 
@@ -159,31 +212,121 @@ func parseAllCardsFromQuery(rows *sql.Rows) ([]api.Card, error) {
 
 		err := rows.Scan(&card.CardId, &card.Word, &card.Translation, &card.WordType, &card.Level, &card.Gender, &verb.Tense, &verb.Forms, &verb.Irregular, &form.Gender, &form.Number, &form.Form)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		if card.CardId == lastCardId {
 			if err = addMoreFormsToExistingCard(newCard, verb, form); err != nil {
-				log.Printf("storage - Error unmarshalling JSONB: %v", err)
-				return nil, err
+				return fmt.Errorf("unmarshalling JSONB: %w", err)
 			}
 			continue
 		}
 		if lastCardId != 0 {
-			cards = append(cards, newCard)
+			if err := fn(newCard); err != nil {
+				return err
+			}
 		}
 
 		if newCard, err = parseNewCardFromRow(card, verb, form); err != nil {
-			log.Printf("storage - Error unmarshalling JSONB: %v", err)
-			return nil, err
+			return fmt.Errorf("unmarshalling JSONB: %w", err)
 		}
 
 		lastCardId = card.CardId
 	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
 
 	if hasRows {
-		cards = append(cards, newCard)
+		return fn(newCard)
 	}
+	return nil
+}
 
-	return cards, nil
+func scanUser(row scanner) (api.User, error) {
+	var user User
+	err := row.Scan(&user.UserId, &user.Username, &user.Email, &user.Level, &user.Scheduler, &user.Role, &user.DateJoined)
+	if err != nil {
+		return api.User{}, err
+	}
+
+	return api.User{
+		UserId:     user.UserId,
+		Username:   nullStringToString(user.Username),
+		Email:      user.Email,
+		Level:      int(user.Level.Int64),
+		Scheduler:  api.SchedulerType(user.Scheduler),
+		Role:       api.Role(user.Role),
+		DateJoined: user.DateJoined.Time,
+	}, nil
+}
+
+func scanCardStatus(row *sql.Row) (api.CardStatus, error) {
+	var status CardStatus
+	err := row.Scan(&status.Stage, &status.Scheduler, &status.Difficulty, &status.Stability, &status.Retrievability, &status.LastReview)
+	if err != nil {
+		return api.CardStatus{}, err
+	}
+
+	return api.CardStatus{
+		Stage:     status.Stage,
+		Scheduler: api.SchedulerType(status.Scheduler),
+		Memory: api.MemoryState{
+			Difficulty:     status.Difficulty.Float64,
+			Stability:      status.Stability.Float64,
+			Retrievability: status.Retrievability.Float64,
+			LastReview:     status.LastReview.Time,
+		},
+	}, nil
+}
+
+type ApiKey struct {
+	KeyId      int
+	Name       string
+	Prefix     string
+	Scopes     []string
+	CreatedBy  string
+	CreatedAt  time.Time
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+// scanApiKey reads the columns of apiKeyColumns, followed by extra when given
+func scanApiKey(row scanner, extra ...interface{}) (api.ApiKey, error) {
+	var key ApiKey
+	dest := []interface{}{&key.KeyId, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.CreatedBy, &key.CreatedAt, &key.LastUsedAt, &key.RevokedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return api.ApiKey{}, err
+	}
+
+	scopes := make([]api.Permission, len(key.Scopes))
+	for i, scope := range key.Scopes {
+		scopes[i] = api.Permission(scope)
+	}
+
+	return api.ApiKey{
+		KeyId:      key.KeyId,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     scopes,
+		CreatedBy:  key.CreatedBy,
+		CreatedAt:  key.CreatedAt,
+		LastUsedAt: nullTimeToPointer(key.LastUsedAt),
+		RevokedAt:  nullTimeToPointer(key.RevokedAt),
+	}, nil
+}
+
+func nullTimeToPointer(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func permissionsToStrings(permissions []api.Permission) []string {
+	result := make([]string, len(permissions))
+	for i, permission := range permissions {
+		result[i] = string(permission)
+	}
+	return result
 }
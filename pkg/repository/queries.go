@@ -1,11 +1,15 @@
 package repository
 
 import (
+	"context"
 	"crabigateur-api/pkg/api"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 const CardSelector = `
@@ -18,7 +22,7 @@ const CardSelector = `
 	ON c.card_id = f.card_id
 `
 
-func (s *storage) LessonsQuery(userId string, numLessons int) (*sql.Rows, error) {
+func (s *storage) LessonsQuery(ctx context.Context, userId string, numLessons int) (*sql.Rows, error) {
 	limit := ""
 	if numLessons > 0 {
 		limit = fmt.Sprintf("LIMIT %d", numLessons)
@@ -47,10 +51,10 @@ func (s *storage) LessonsQuery(userId string, numLessons int) (*sql.Rows, error)
 		ORDER BY c.card_id;
 	`, limit, CardSelector)
 
-	return s.db.Query(lessonCardsQuery, userId)
+	return s.db.QueryContext(ctx, lessonCardsQuery, userId)
 }
 
-func (s *storage) ReviewQuery(userId string, firstReview bool, sort []api.SortOrder) (*sql.Rows, error) {
+func (s *storage) ReviewQuery(ctx context.Context, userId string, firstReview bool, sort []api.SortOrder) (*sql.Rows, error) {
 	sortOrder := ""
 	for _, value := range sort {
 		switch value {
@@ -91,12 +95,12 @@ func (s *storage) ReviewQuery(userId string, firstReview bool, sort []api.SortOr
 		JOIN PendingReviews pr ON c.card_id = pr.card_id;
 	`, sortOrder, CardSelector)
 
-	return s.db.Query(reviewsQuery, userId, firstReview)
+	return s.db.QueryContext(ctx, reviewsQuery, userId, firstReview)
 }
 
-func (s *storage) ReviewsInsert(userId string, review api.Review) (sql.Result, error) {
+func (s *storage) ReviewsInsert(ctx context.Context, userId string, review api.Review, newStage int) (sql.Result, error) {
 	reviewsInsert := `
-		INSERT INTO Reviews (user_id, card_id, review_date, success, previous_stage)
+		INSERT INTO Reviews (user_id, card_id, review_date, success, previous_stage, client_review_id, new_stage)
 		VALUES (
 			$1::VARCHAR, 
 			$2, 
@@ -107,14 +111,32 @@ func (s *storage) ReviewsInsert(userId string, review api.Review) (sql.Result, e
 					(SELECT stage_id FROM UserCardStatus WHERE user_id = $1::VARCHAR AND card_id = $2),
 					0
 				) AS stage_id
-			)
+			),
+			$5,
+			$6
 		)
 	`
 
-	return s.db.Exec(reviewsInsert, userId, review.CardId, review.ReviewDate, review.Success)
+	var reviewId interface{}
+	if review.ReviewId != "" {
+		reviewId = review.ReviewId
+	}
+
+	return s.db.ExecContext(ctx, reviewsInsert, userId, review.CardId, review.ReviewDate, review.Success, reviewId, newStage)
+}
+
+func (s *storage) ReviewResultQuery(ctx context.Context, userId string, reviewId string) *sql.Row {
+	query := `
+		SELECT r.card_id, c.word AS card_word, r.success, r.new_stage
+		FROM Reviews r
+		JOIN Cards c ON r.card_id = c.card_id
+		WHERE r.user_id = $1 AND r.client_review_id = $2;
+	`
+
+	return s.db.QueryRowContext(ctx, query, userId, reviewId)
 }
 
-func (s *storage) UserCardStatusInsert(userId string, cardId int) *sql.Row {
+func (s *storage) UserCardStatusInsert(ctx context.Context, userId string, cardId int) *sql.Row {
 	insertQuery := `
 		WITH inserted AS (
 			INSERT INTO UserCardStatus (user_id, card_id, stage_id, next_review_date)
@@ -132,49 +154,72 @@ func (s *storage) UserCardStatusInsert(userId string, cardId int) *sql.Row {
 		JOIN Cards c ON i.card_id = c.card_id;
 	`
 
-	return s.db.QueryRow(insertQuery, userId, cardId)
+	return s.db.QueryRowContext(ctx, insertQuery, userId, cardId)
 
 }
 
-func (s *storage) UserCardStatusUpdate(userId string, review api.Review) *sql.Row {
-	stageUpdate := fmt.Sprintf(`
-    CASE 
-        WHEN ucs.stage_id = 0 THEN 1  -- If stage_id is 0, always move to 1
-        WHEN %t THEN ucs.stage_id + 1  -- If success, move to next stage
-        ELSE GREATEST(
-            1,
-            ucs.stage_id - CEIL(
-                ROUND(%d / 2.0, 1)
-            ) * s.stage_penalty
-        )
-    END`, *review.Success, *review.IncorrectCount)
-
-	updateQuery := fmt.Sprintf(`
-		UPDATE UserCardStatus ucs
-		SET stage_id = cs.new_stage_id,
-			next_review_date = $3::TIMESTAMPTZ + s.stage_interval
-		FROM (
-			SELECT ucs.user_id, ucs.card_id, %s AS new_stage_id
-			FROM UserCardStatus ucs
-			LEFT JOIN SRSStages s ON ucs.stage_id = s.stage_id
-			WHERE ucs.user_id = $1 AND ucs.card_id = $2
-		) AS cs
-		JOIN SRSStages s ON cs.new_stage_id = s.stage_id
-		WHERE ucs.user_id = cs.user_id AND ucs.card_id = cs.card_id
-		RETURNING ucs.card_id, ucs.stage_id`, stageUpdate)
-
-	finalQuery := fmt.Sprintf(`
+func (s *storage) UserCardStatusUpdate(ctx context.Context, userId string, review api.Review, schedule api.ScheduleResult) *sql.Row {
+	updateQuery := `
 		WITH updated AS (
-			%s
+			UPDATE UserCardStatus
+			SET stage_id = $3,
+				next_review_date = $4,
+				last_review_date = $5,
+				difficulty = NULLIF($6::DOUBLE PRECISION, 0),
+				stability = NULLIF($7::DOUBLE PRECISION, 0),
+				retrievability = NULLIF($8::DOUBLE PRECISION, 0)
+			WHERE user_id = $1 AND card_id = $2
+			RETURNING card_id, stage_id
 		)
-		SELECT u.card_id, c.word AS card_word, %t AS success, u.stage_id
+		SELECT u.card_id, c.word AS card_word, $9::boolean AS success, u.stage_id
 		FROM updated u
-		JOIN Cards c ON u.card_id = c.card_id;`, updateQuery, *review.Success)
+		JOIN Cards c ON u.card_id = c.card_id;
+	`
+
+	// a card that is never reviewed again has no next review date
+	nextReview := sql.NullTime{Time: schedule.NextReviewDate, Valid: !schedule.NextReviewDate.IsZero()}
+	memory := schedule.Memory
+	return s.db.QueryRowContext(ctx, updateQuery, userId, review.CardId, schedule.Stage, nextReview, review.ReviewDate,
+		memory.Difficulty, memory.Stability, memory.Retrievability, *review.Success)
+}
+
+func (s *storage) CardStatusQuery(ctx context.Context, userId string, cardId int) *sql.Row {
+	query := `
+		SELECT ucs.stage_id, u.scheduler, ucs.difficulty, ucs.stability, ucs.retrievability, ucs.last_review_date
+		FROM UserCardStatus ucs
+		JOIN Users u ON u.user_id = ucs.user_id
+		WHERE ucs.user_id = $1 AND ucs.card_id = $2
+		FOR UPDATE OF ucs;
+	`
+
+	return s.db.QueryRowContext(ctx, query, userId, cardId)
+}
+
+func (s *storage) SRSStagesQuery(ctx context.Context) (*sql.Rows, error) {
+	query := `
+		SELECT stage_id, stage_name,
+			COALESCE(EXTRACT(EPOCH FROM stage_interval), 0)::BIGINT AS interval_seconds,
+			COALESCE(stage_penalty, 0) AS stage_penalty
+		FROM SRSStages
+		ORDER BY stage_id;
+	`
+
+	return s.db.QueryContext(ctx, query)
+}
 
-	return s.db.QueryRow(finalQuery, userId, review.CardId, review.ReviewDate)
+// SRSStageInsert leaves existing stages untouched, so re-seeding does not undo
+// intervals tuned by hand. An interval or penalty of 0 is stored as NULL.
+func (s *storage) SRSStageInsert(ctx context.Context, stage api.SRSStage) (sql.Result, error) {
+	query := `
+		INSERT INTO SRSStages (stage_id, stage_name, stage_interval, stage_penalty)
+		VALUES ($1, $2, make_interval(secs => NULLIF($3, 0)), NULLIF($4, 0))
+		ON CONFLICT (stage_id) DO NOTHING;
+	`
+
+	return s.db.ExecContext(ctx, query, stage.StageId, stage.Name, int64(stage.Interval.Seconds()), stage.Penalty)
 }
 
-func (s *storage) MostRecentReviewsQuery(userId string, numCards int) (*sql.Rows, error) {
+func (s *storage) MostRecentReviewsQuery(ctx context.Context, userId string, numCards int) (*sql.Rows, error) {
 	mostRecentReview := `
 		SELECT r.card_id, c.word AS card_word, r.success, ucs.stage_id
 		FROM Reviews r
@@ -187,10 +232,10 @@ func (s *storage) MostRecentReviewsQuery(userId string, numCards int) (*sql.Rows
 		LIMIT $2;
 	`
 
-	return s.db.Query(mostRecentReview, userId, numCards)
+	return s.db.QueryContext(ctx, mostRecentReview, userId, numCards)
 }
 
-func (s *storage) MostRecentMistakesQuery(userId string) (*sql.Rows, error) {
+func (s *storage) MostRecentMistakesQuery(ctx context.Context, userId string) (*sql.Rows, error) {
 	query := `
 		SELECT r.card_id, c.word, c.word_type
 		FROM Reviews r
@@ -200,10 +245,10 @@ func (s *storage) MostRecentMistakesQuery(userId string) (*sql.Rows, error) {
 		LIMIT 10;
 	`
 
-	return s.db.Query(query, userId)
+	return s.db.QueryContext(ctx, query, userId)
 }
 
-func (s *storage) LevelProgressQuery(userId string) (*sql.Rows, error) {
+func (s *storage) LevelProgressQuery(ctx context.Context, userId string) (*sql.Rows, error) {
 	query := `
 		SELECT c.card_id, c.word, COALESCE(ucs.stage_id, 0) AS stage_id
 		FROM Users u
@@ -212,10 +257,10 @@ func (s *storage) LevelProgressQuery(userId string) (*sql.Rows, error) {
 			ON ucs.card_id = c.card_id AND ucs.user_id = u.user_id
 		WHERE u.user_id = $1;
 	`
-	return s.db.Query(query, userId)
+	return s.db.QueryContext(ctx, query, userId)
 }
 
-func (s *storage) WordPerStageStatsQuery(userId string) (*sql.Rows, error) {
+func (s *storage) WordPerStageStatsQuery(ctx context.Context, userId string) (*sql.Rows, error) {
 	query := `
 		SELECT s.stage_name, c.word_type, COUNT(*)
 		FROM UserCardStatus ucs
@@ -224,19 +269,51 @@ func (s *storage) WordPerStageStatsQuery(userId string) (*sql.Rows, error) {
 		WHERE ucs.user_id = $1
 		GROUP BY s.stage_name, c.word_type;
 	`
-	return s.db.Query(query, userId)
+	return s.db.QueryContext(ctx, query, userId)
 }
 
-func (s *storage) CardQuery(id int) (*sql.Rows, error) {
+func (s *storage) CardQuery(ctx context.Context, id int) (*sql.Rows, error) {
 	cardQuery := fmt.Sprintf(`
 		%s
 		WHERE c.card_id = $1;
 	`, CardSelector)
 
-	return s.db.Query(cardQuery, id)
+	return s.db.QueryContext(ctx, cardQuery, id)
+}
+
+// AllCardsQuery selects every card in card_id order, so that the rows of a
+// card stay next to each other
+func (s *storage) AllCardsQuery(ctx context.Context) (*sql.Rows, error) {
+	query := fmt.Sprintf(`
+		%s
+		ORDER BY c.card_id;
+	`, CardSelector)
+
+	return s.db.QueryContext(ctx, query)
+}
+
+func (s *storage) TensesQuery(ctx context.Context) (*sql.Rows, error) {
+	query := `
+		SELECT DISTINCT tense
+		FROM Conjugations
+		ORDER BY tense;
+	`
+
+	return s.db.QueryContext(ctx, query)
+}
+
+// CardIdQuery matches the unique_word_gender index, a NULL gender included
+func (s *storage) CardIdQuery(ctx context.Context, word string, gender string) *sql.Row {
+	query := `
+		SELECT card_id
+		FROM Cards
+		WHERE (word || '|' || COALESCE(gender, '__null__')) = ($1 || '|' || COALESCE(NULLIF($2, ''), '__null__'));
+	`
+
+	return s.db.QueryRowContext(ctx, query, word, gender)
 }
 
-func (s *storage) CardsInsert(word string, translation []string, wordType string, gender string, level int) (*sql.Row, error) {
+func (s *storage) CardsInsert(ctx context.Context, word string, translation []string, wordType string, gender string, level int) (*sql.Row, error) {
 	translationJSON, err := json.Marshal(translation)
 	if err != nil {
 		return nil, err
@@ -255,10 +332,10 @@ func (s *storage) CardsInsert(word string, translation []string, wordType string
 		RETURNING card_id;
 	`
 
-	return s.db.QueryRow(cardsInsert, word, translationJSON, wordType, genderValue, level), nil
+	return s.db.QueryRowContext(ctx, cardsInsert, word, translationJSON, wordType, genderValue, level), nil
 }
 
-func (s *storage) ConjugationsInsert(cardId int, tense string, forms []string, isIrregular bool) (sql.Result, error) {
+func (s *storage) ConjugationsInsert(ctx context.Context, cardId int, tense string, forms []string, isIrregular bool) (sql.Result, error) {
 	formsJSON, err := json.Marshal(forms)
 	if err != nil {
 		return nil, err
@@ -269,19 +346,19 @@ func (s *storage) ConjugationsInsert(cardId int, tense string, forms []string, i
 		VALUES ($1, $2, $3::jsonb, $4)
 	`
 
-	return s.db.Exec(query, cardId, tense, formsJSON, isIrregular)
+	return s.db.ExecContext(ctx, query, cardId, tense, formsJSON, isIrregular)
 }
 
-func (s *storage) FormsInsert(cardId int, gender string, number string, form string) (sql.Result, error) {
+func (s *storage) FormsInsert(ctx context.Context, cardId int, gender string, number string, form string) (sql.Result, error) {
 	query := `
 		INSERT INTO Forms (card_id, gender, number, form)
 		VALUES ($1, $2, $3, $4)
 	`
 
-	return s.db.Exec(query, cardId, gender, number, form)
+	return s.db.ExecContext(ctx, query, cardId, gender, number, form)
 }
 
-func (s *storage) CardsUpdate(cardId int, word string, translation []string, wordType string, gender string, level int) (sql.Result, error) {
+func (s *storage) CardsUpdate(ctx context.Context, cardId int, word string, translation []string, wordType string, gender string, level int) (sql.Result, error) {
 	translationJSON, err := json.Marshal(translation)
 	if err != nil {
 		return nil, err
@@ -304,12 +381,12 @@ func (s *storage) CardsUpdate(cardId int, word string, translation []string, wor
 		WHERE card_id = $1;
 	`
 
-	return s.db.Exec(cardsInsert, cardId, word, translationJSON, wordType, genderValue, level)
+	return s.db.ExecContext(ctx, cardsInsert, cardId, word, translationJSON, wordType, genderValue, level)
 }
 
-func (s *storage) ConjugationsUpdate(cardId int, tense string, forms []string, isIrregular bool) (sql.Result, error) {
+func (s *storage) ConjugationsUpdate(ctx context.Context, cardId int, tense string, forms []string, isIrregular bool) (sql.Result, error) {
 	if len(forms) == 0 {
-		return s.db.Exec(`
+		return s.db.ExecContext(ctx, `
 			DELETE FROM Conjugations
 			WHERE card_id = $1 AND tense = $2;
 		`, cardId, tense)
@@ -328,12 +405,12 @@ func (s *storage) ConjugationsUpdate(cardId int, tense string, forms []string, i
 		DO UPDATE SET forms = EXCLUDED.forms, irregular = EXCLUDED.irregular;
 	`
 
-	return s.db.Exec(query, cardId, tense, formsJSON, isIrregular)
+	return s.db.ExecContext(ctx, query, cardId, tense, formsJSON, isIrregular)
 }
 
-func (s *storage) FormsUpdate(cardId int, gender string, number string, form string) (sql.Result, error) {
+func (s *storage) FormsUpdate(ctx context.Context, cardId int, gender string, number string, form string) (sql.Result, error) {
 	if form == "" {
-		return s.db.Exec(`
+		return s.db.ExecContext(ctx, `
 			DELETE FROM Forms
 			WHERE card_id = $1 AND gender = $2 AND number = $3;
 		`, cardId, gender, number)
@@ -346,19 +423,19 @@ func (s *storage) FormsUpdate(cardId int, gender string, number string, form str
 		DO UPDATE SET form = EXCLUDED.form;
 	`
 
-	return s.db.Exec(query, cardId, gender, number, form)
+	return s.db.ExecContext(ctx, query, cardId, gender, number, form)
 }
 
-func (s *storage) CardsDelete(cardId int) (sql.Result, error) {
+func (s *storage) CardsDelete(ctx context.Context, cardId int) (sql.Result, error) {
 	query := `
 		DELETE FROM Cards
 		WHERE card_id = $1;
 	`
 
-	return s.db.Exec(query, cardId)
+	return s.db.ExecContext(ctx, query, cardId)
 }
 
-func (s *storage) SearchCardsQuery(query api.CardQueryParams) (*sql.Rows, error) {
+func (s *storage) SearchCardsQuery(ctx context.Context, query api.CardQueryParams) (*sql.Rows, error) {
 	var args []interface{}
 	var conditions []string
 	argIndex := 1
@@ -404,5 +481,196 @@ func (s *storage) SearchCardsQuery(query api.CardQueryParams) (*sql.Rows, error)
 		argIndex++
 	}
 
-	return s.db.Query(queryStr, args...)
+	return s.db.QueryContext(ctx, queryStr, args...)
+}
+
+func (s *storage) UserQuery(ctx context.Context, userId string) *sql.Row {
+	query := `
+		SELECT user_id, username, email, level, scheduler, role, date_joined
+		FROM Users
+		WHERE user_id = $1;
+	`
+
+	return s.db.QueryRowContext(ctx, query, userId)
+}
+
+func (s *storage) UsersInsert(ctx context.Context, user api.User) *sql.Row {
+	query := `
+		INSERT INTO Users (user_id, username, email, level, scheduler, role, date_joined)
+		VALUES ($1, $2, $3, $4, $5, $6, CURRENT_DATE)
+		RETURNING user_id, username, email, level, scheduler, role, date_joined;
+	`
+
+	return s.db.QueryRowContext(ctx, query, user.UserId, user.Username, user.Email, user.Level, user.Scheduler, user.Role)
+}
+
+func (s *storage) UsersUpdate(ctx context.Context, userId string, update api.UserUpdate) *sql.Row {
+	// NULL parameters keep the current value of the column
+	query := `
+		UPDATE Users
+		SET username = COALESCE($2, username),
+		    email = COALESCE($3, email),
+		    scheduler = COALESCE($4, scheduler)
+		WHERE user_id = $1
+		RETURNING user_id, username, email, level, scheduler, role, date_joined;
+	`
+
+	return s.db.QueryRowContext(ctx, query, userId, update.Username, update.Email, update.Scheduler)
+}
+
+func (s *storage) AdminsLock(ctx context.Context) (sql.Result, error) {
+	// held until the end of the transaction, so that two requests cannot
+	// each remove an admin while seeing the other one
+	query := `
+		SELECT user_id FROM Users
+		WHERE role = 'admin'
+		ORDER BY user_id
+		FOR UPDATE;
+	`
+
+	return s.db.ExecContext(ctx, query)
+}
+
+func (s *storage) UserRoleUpdate(ctx context.Context, userId string, role api.Role) *sql.Row {
+	// an admin is only demoted while another admin remains, see AdminsLock
+	query := `
+		UPDATE Users
+		SET role = $2
+		WHERE user_id = $1
+		AND (
+			$2 = 'admin'
+			OR role <> 'admin'
+			OR EXISTS (SELECT 1 FROM Users WHERE role = 'admin' AND user_id <> $1)
+		)
+		RETURNING user_id, username, email, level, scheduler, role, date_joined;
+	`
+
+	return s.db.QueryRowContext(ctx, query, userId, role)
+}
+
+func (s *storage) UserLevelSet(ctx context.Context, userId string, level int) *sql.Row {
+	// a user cannot be moved past the cards there are to learn
+	query := `
+		UPDATE Users
+		SET level = $2
+		WHERE user_id = $1
+		AND $2 <= (SELECT COALESCE(MAX(level), 1) FROM Cards)
+		RETURNING user_id, username, email, level, scheduler, role, date_joined;
+	`
+
+	return s.db.QueryRowContext(ctx, query, userId, level)
+}
+
+func (s *storage) UsersByRoleQuery(ctx context.Context, role api.Role) (*sql.Rows, error) {
+	query := `
+		SELECT user_id, username, email, level, scheduler, role, date_joined
+		FROM Users
+		WHERE role = $1
+		ORDER BY user_id;
+	`
+
+	return s.db.QueryContext(ctx, query, role)
+}
+
+func (s *storage) UsersDelete(ctx context.Context, userId string) (sql.Result, error) {
+	// Reviews and UserCardStatus reference Users without ON DELETE CASCADE,
+	// so the user's progress is removed in the same statement. An admin is
+	// only deleted while another admin remains, see AdminsLock.
+	query := `
+		WITH target AS (
+			SELECT user_id FROM Users
+			WHERE user_id = $1
+			AND (
+				role <> 'admin'
+				OR EXISTS (SELECT 1 FROM Users WHERE role = 'admin' AND user_id <> $1)
+			)
+		), deleted_reviews AS (
+			DELETE FROM Reviews
+			WHERE user_id IN (SELECT user_id FROM target)
+		), deleted_status AS (
+			DELETE FROM UserCardStatus
+			WHERE user_id IN (SELECT user_id FROM target)
+		)
+		DELETE FROM Users
+		WHERE user_id IN (SELECT user_id FROM target);
+	`
+
+	return s.db.ExecContext(ctx, query, userId)
+}
+
+func (s *storage) UserLevelQuery(ctx context.Context, userId string) *sql.Row {
+	query := `
+		SELECT level FROM Users
+		WHERE user_id = $1;
+	`
+
+	return s.db.QueryRowContext(ctx, query, userId)
+}
+
+func (s *storage) UserLevelUpdate(ctx context.Context, userId string, level int) (sql.Result, error) {
+	// only promotes from the level the decision was made on, and only
+	// when there are cards to learn on the next level
+	query := `
+		UPDATE Users
+		SET level = level + 1
+		WHERE user_id = $1 AND level = $2
+		AND EXISTS (
+			SELECT 1 FROM Cards c
+			WHERE c.level = $2 + 1
+		);
+	`
+
+	return s.db.ExecContext(ctx, query, userId, level)
+}
+
+const apiKeyColumns = `key_id, name, prefix, scopes, COALESCE(created_by, ''), created_at, last_used_at, revoked_at`
+
+func (s *storage) ApiKeysInsert(ctx context.Context, key api.ApiKey, hash []byte) *sql.Row {
+	query := `
+		INSERT INTO ApiKeys (name, prefix, key_hash, scopes, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + apiKeyColumns + `;
+	`
+
+	return s.db.QueryRowContext(ctx, query, key.Name, key.Prefix, hash, pq.Array(permissionsToStrings(key.Scopes)), key.CreatedBy)
+}
+
+func (s *storage) ApiKeysQuery(ctx context.Context) (*sql.Rows, error) {
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM ApiKeys
+		ORDER BY key_id;
+	`
+
+	return s.db.QueryContext(ctx, query)
+}
+
+func (s *storage) ApiKeyByPrefixQuery(ctx context.Context, prefix string) *sql.Row {
+	query := `
+		SELECT ` + apiKeyColumns + `, key_hash
+		FROM ApiKeys
+		WHERE prefix = $1;
+	`
+
+	return s.db.QueryRowContext(ctx, query, prefix)
+}
+
+func (s *storage) ApiKeyRevoke(ctx context.Context, keyId int) (sql.Result, error) {
+	query := `
+		UPDATE ApiKeys
+		SET revoked_at = now()
+		WHERE key_id = $1 AND revoked_at IS NULL;
+	`
+
+	return s.db.ExecContext(ctx, query, keyId)
+}
+
+func (s *storage) ApiKeyTouch(ctx context.Context, keyId int, usedAt time.Time) (sql.Result, error) {
+	query := `
+		UPDATE ApiKeys
+		SET last_used_at = $2
+		WHERE key_id = $1;
+	`
+
+	return s.db.ExecContext(ctx, query, keyId, usedAt)
 }
@@ -1,103 +1,290 @@
 package repository
 
 import (
+	"context"
 	"crabigateur-api/pkg/api"
 	"database/sql"
+	"errors"
 	"fmt"
-	"strings"
+	"log/slog"
+	"time"
 )
 
 type Storage interface {
-	GetLessons(userId string, numLessons int) ([]api.Card, error)
-	GetReview(userId string, firstReview bool, sort []api.SortOrder) ([]api.Card, error)
-	InsertReview(userId string, cardId int) (api.ReviewResult, error)
-	UpdateReview(userId string, review api.Review) (api.ReviewResult, error)
-	GetMostRecentReviews(userId string, numCards int) ([]api.ReviewResult, error)
-	CountPendingReviews(userId string) (int, error)
-	GetRecentMistakes(userID string) ([]api.CardTag, error)
-	GetLevelProgress(userId string) ([]api.CardProgress, error)
-	GetWordStats(userId string) (map[string]map[string]int, error)
-	GetCard(id int) (api.Card, error)
-	InsertCard(word string, translation []string, wordType string, gender string, level int) (int, error)
-	UpdateCard(cardId int, word string, translation []string, wordType string, gender string, level int) error
-	InsertOrUpdateConjugation(isUpdate bool, cardId int, tense string, forms []string, isIrregular bool) error
-	InsertOrUpdateForm(isUpdate bool, cardId int, gender string, number string, form string) error
-	DeleteCard(cardId int) error
-	SearchCards(query api.CardQueryParams) ([]api.Card, error)
+	WithTx(ctx context.Context, fn func(Storage) error) error
+	WithUserTx(ctx context.Context, fn func(api.UserRepository) error) error
+	WithCardTx(ctx context.Context, fn func(api.CardRepository) error) error
+	GetLessons(ctx context.Context, userId string, numLessons int) ([]api.Card, error)
+	GetReview(ctx context.Context, userId string, firstReview bool, sort []api.SortOrder) ([]api.Card, error)
+	InsertReview(ctx context.Context, userId string, cardId int) (api.ReviewResult, error)
+	GetCardStatus(ctx context.Context, userId string, cardId int) (api.CardStatus, error)
+	GetReviewResult(ctx context.Context, userId string, reviewId string) (api.ReviewResult, bool, error)
+	Ping(ctx context.Context) error
+	GetSRSStages(ctx context.Context) (api.StageTable, error)
+	InsertSRSStage(ctx context.Context, stage api.SRSStage) (bool, error)
+	UpdateReview(ctx context.Context, userId string, review api.Review, schedule api.ScheduleResult) (api.ReviewResult, error)
+	GetMostRecentReviews(ctx context.Context, userId string, numCards int) ([]api.ReviewResult, error)
+	CountPendingReviews(ctx context.Context, userId string) (int, error)
+	GetRecentMistakes(ctx context.Context, userID string) ([]api.CardTag, error)
+	GetLevelProgress(ctx context.Context, userId string) ([]api.CardProgress, error)
+	GetWordStats(ctx context.Context, userId string) (map[string]map[string]int, error)
+	GetUserLevel(ctx context.Context, userId string) (int, error)
+	PromoteUser(ctx context.Context, userId string, level int) (bool, error)
+	GetCard(ctx context.Context, id int) (api.Card, error)
+	FindCardId(ctx context.Context, word string, gender string) (int, bool, error)
+	InsertCard(ctx context.Context, word string, translation []string, wordType string, gender string, level int) (int, error)
+	UpdateCard(ctx context.Context, cardId int, word string, translation []string, wordType string, gender string, level int) error
+	InsertOrUpdateConjugation(ctx context.Context, isUpdate bool, cardId int, tense string, forms []string, isIrregular bool) error
+	InsertOrUpdateForm(ctx context.Context, isUpdate bool, cardId int, gender string, number string, form string) error
+	DeleteCard(ctx context.Context, cardId int) error
+	SearchCards(ctx context.Context, query api.CardQueryParams) ([]api.Card, error)
+	ExportCards(ctx context.Context, fn func(api.Card) error) error
+	GetTenses(ctx context.Context) ([]string, error)
+	GetUser(ctx context.Context, userId string) (api.User, error)
+	InsertUser(ctx context.Context, user api.User) (api.User, error)
+	UpdateUser(ctx context.Context, userId string, update api.UserUpdate) (api.User, error)
+	DeleteUser(ctx context.Context, userId string) (bool, error)
+	UpdateUserRole(ctx context.Context, userId string, role api.Role) (api.User, error)
+	UpdateUserLevel(ctx context.Context, userId string, level int) (api.User, error)
+	GetUsersByRole(ctx context.Context, role api.Role) ([]api.User, error)
+	InsertApiKey(ctx context.Context, key api.ApiKey, hash []byte) (api.ApiKey, error)
+	GetApiKeys(ctx context.Context) ([]api.ApiKey, error)
+	GetApiKeyByPrefix(ctx context.Context, prefix string) (api.ApiKey, []byte, error)
+	RevokeApiKey(ctx context.Context, keyId int) (bool, error)
+	TouchApiKey(ctx context.Context, keyId int, usedAt time.Time) error
+}
+
+// dbtx is implemented by both *sql.DB and *sql.Tx, so queries run the same way
+// inside and outside of a transaction
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
 type storage struct {
-	db *sql.DB
+	db     dbtx
+	conn   *sql.DB
+	logger *slog.Logger
+	depth  int // transaction nesting level, 0 outside of a transaction
 }
 
-func NewStorage(db *sql.DB) Storage {
+func NewStorage(db *sql.DB, logger *slog.Logger) Storage {
 	return &storage{
-		db: db,
+		db:     db,
+		conn:   db,
+		logger: logger,
+	}
+}
+
+// WithTx runs fn against a Storage bound to a transaction, committing if fn succeeds
+// and rolling back otherwise. Calls nested inside fn use savepoints, so an inner
+// failure only undoes the inner work.
+func (s *storage) WithTx(ctx context.Context, fn func(Storage) error) error {
+	return s.withTx(ctx, func(tx *storage) error {
+		return fn(tx)
+	})
+}
+
+func (s *storage) withTx(ctx context.Context, fn func(*storage) error) error {
+	if s.depth > 0 {
+		return s.withSavepoint(ctx, fn)
+	}
+
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return storageError("WithTx begin", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	err = fn(&storage{db: tx, conn: s.conn, logger: s.logger, depth: 1})
+	if err != nil {
+		// a cancelled context already rolled the transaction back
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+			s.logger.ErrorContext(ctx, "storage - WithTx rollback", "error", rollbackErr, "cause", err)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return storageError("WithTx commit", err)
 	}
+	return nil
 }
 
-func (s *storage) GetLessons(userId string, numLessons int) ([]api.Card, error) {
-	rows, err := s.LessonsQuery(userId, numLessons)
+func (s *storage) withSavepoint(ctx context.Context, fn func(*storage) error) error {
+	savepoint := fmt.Sprintf("savepoint_%d", s.depth)
+
+	if _, err := s.db.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return storageError("WithTx savepoint", err)
+	}
+
+	err := fn(&storage{db: s.db, conn: s.conn, logger: s.logger, depth: s.depth + 1})
 	if err != nil {
-		return nil, fmt.Errorf("storage - Get Lesson Cards Query: %s", err)
+		if _, rollbackErr := s.db.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint); rollbackErr != nil {
+			s.logger.ErrorContext(ctx, "storage - WithTx rollback to savepoint", "savepoint", savepoint, "error", rollbackErr, "cause", err)
+		}
+		return err
+	}
+
+	if _, err := s.db.ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint); err != nil {
+		return storageError("WithTx release savepoint", err)
+	}
+	return nil
+}
+
+func (s *storage) WithUserTx(ctx context.Context, fn func(api.UserRepository) error) error {
+	return s.WithTx(ctx, func(tx Storage) error {
+		return fn(tx)
+	})
+}
+
+func (s *storage) WithCardTx(ctx context.Context, fn func(api.CardRepository) error) error {
+	return s.WithTx(ctx, func(tx Storage) error {
+		return fn(tx)
+	})
+}
+
+func (s *storage) GetLessons(ctx context.Context, userId string, numLessons int) ([]api.Card, error) {
+	rows, err := s.LessonsQuery(ctx, userId, numLessons)
+	if err != nil {
+		return nil, storageError("Get Lesson Cards Query", err)
 	}
 	defer rows.Close()
 
 	cards, err := parseAllCardsFromQuery(rows)
 	if err != nil {
-		return nil, fmt.Errorf("storage - GetLessons: %s", err)
+		return nil, storageError("GetLessons", err)
 	}
 
 	return cards, nil
 }
 
-func (s *storage) GetReview(userId string, firstReview bool, sort []api.SortOrder) ([]api.Card, error) {
-	rows, err := s.ReviewQuery(userId, firstReview, sort)
+func (s *storage) GetReview(ctx context.Context, userId string, firstReview bool, sort []api.SortOrder) ([]api.Card, error) {
+	rows, err := s.ReviewQuery(ctx, userId, firstReview, sort)
 	if err != nil {
-		return nil, fmt.Errorf("storage - Get Review Cards Query: %s", err)
+		return nil, storageError("Get Review Cards Query", err)
 	}
 	defer rows.Close()
 
 	cards, err := parseAllCardsFromQuery(rows)
 	if err != nil {
-		return nil, fmt.Errorf("storage - GetReviews: %s", err)
+		return nil, storageError("GetReviews", err)
 	}
 
 	return cards, nil
 }
 
-func (s *storage) InsertReview(userId string, cardId int) (api.ReviewResult, error) {
-	row := s.UserCardStatusInsert(userId, cardId)
+func (s *storage) InsertReview(ctx context.Context, userId string, cardId int) (api.ReviewResult, error) {
+	row := s.UserCardStatusInsert(ctx, userId, cardId)
 
 	var result api.ReviewResult
 	err := row.Scan(&result.CardId, &result.CardWord, &result.Success, &result.StageId)
 	if err != nil {
-		return api.ReviewResult{}, fmt.Errorf("storage - InsertReview: %s", err)
+		return api.ReviewResult{}, storageError("InsertReview", err)
 	}
 
 	return result, nil
 }
 
-func (s *storage) UpdateReview(userId string, review api.Review) (api.ReviewResult, error) {
-	_, err := s.ReviewsInsert(userId, review)
+func (s *storage) GetCardStatus(ctx context.Context, userId string, cardId int) (api.CardStatus, error) {
+	status, err := scanCardStatus(s.CardStatusQuery(ctx, userId, cardId))
+	if err == sql.ErrNoRows {
+		return api.CardStatus{}, fmt.Errorf("storage - GetCardStatus: card %d of user %s: %w", cardId, userId, api.ErrLessonNotFound)
+	} else if err != nil {
+		return api.CardStatus{}, storageError("GetCardStatus", err)
+	}
+	return status, nil
+}
+
+func (s *storage) GetReviewResult(ctx context.Context, userId string, reviewId string) (api.ReviewResult, bool, error) {
+	var result api.ReviewResult
+	err := s.ReviewResultQuery(ctx, userId, reviewId).Scan(&result.CardId, &result.CardWord, &result.Success, &result.StageId)
+	if err == sql.ErrNoRows {
+		return api.ReviewResult{}, false, nil
+	} else if err != nil {
+		return api.ReviewResult{}, false, storageError("GetReviewResult", err)
+	}
+	return result, true, nil
+}
+
+// Ping checks that the database can be reached, opening a connection if the pool has none
+func (s *storage) Ping(ctx context.Context) error {
+	if err := s.conn.PingContext(ctx); err != nil {
+		return storageError("Ping", err)
+	}
+	return nil
+}
+
+func (s *storage) GetSRSStages(ctx context.Context) (api.StageTable, error) {
+	rows, err := s.SRSStagesQuery(ctx)
 	if err != nil {
-		return api.ReviewResult{}, fmt.Errorf("storage - Insert into Reviews Query: %s", err)
+		return nil, storageError("Get SRS Stages Query", err)
 	}
+	defer rows.Close()
 
-	row := s.UserCardStatusUpdate(userId, review)
+	var stages api.StageTable
+	for rows.Next() {
+		var stage api.SRSStage
+		var intervalSeconds int64
+		err := rows.Scan(&stage.StageId, &stage.Name, &intervalSeconds, &stage.Penalty)
+		if err != nil {
+			return nil, storageError("GetSRSStages", err)
+		}
+		stage.Interval = time.Duration(intervalSeconds) * time.Second
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
 
+// InsertSRSStage adds stage unless its stage id already exists, reporting whether it was inserted
+func (s *storage) InsertSRSStage(ctx context.Context, stage api.SRSStage) (bool, error) {
+	result, err := s.SRSStageInsert(ctx, stage)
+	if err != nil {
+		return false, storageError("InsertSRSStage", err)
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, storageError("InsertSRSStage", err)
+	}
+
+	return inserted > 0, nil
+}
+
+func (s *storage) UpdateReview(ctx context.Context, userId string, review api.Review, schedule api.ScheduleResult) (api.ReviewResult, error) {
 	var result api.ReviewResult
-	err = row.Scan(&result.CardId, &result.CardWord, &result.Success, &result.StageId)
+
+	// the review row and the card status are written together or not at all
+	err := s.withTx(ctx, func(tx *storage) error {
+		_, err := tx.ReviewsInsert(ctx, userId, review, schedule.Stage)
+		if err != nil {
+			return storageError("Insert into Reviews Query", err)
+		}
+
+		row := tx.UserCardStatusUpdate(ctx, userId, review, schedule)
+
+		err = row.Scan(&result.CardId, &result.CardWord, &result.Success, &result.StageId)
+		if err != nil {
+			return storageError("UpdateReview", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return api.ReviewResult{}, fmt.Errorf("storage - UpdateReview: %s", err)
+		return api.ReviewResult{}, err
 	}
 	return result, nil
 }
 
-func (s *storage) GetMostRecentReviews(userId string, numCards int) ([]api.ReviewResult, error) {
-	rows, err := s.MostRecentReviewsQuery(userId, numCards)
+func (s *storage) GetMostRecentReviews(ctx context.Context, userId string, numCards int) ([]api.ReviewResult, error) {
+	rows, err := s.MostRecentReviewsQuery(ctx, userId, numCards)
 	if err != nil {
-		return nil, fmt.Errorf("storage - Get Most Recent Reviews Query: %s", err)
+		return nil, storageError("Get Most Recent Reviews Query", err)
 	}
 	defer rows.Close()
 
@@ -106,27 +293,30 @@ func (s *storage) GetMostRecentReviews(userId string, numCards int) ([]api.Revie
 		var review api.ReviewResult
 		err = rows.Scan(&review.CardId, &review.CardWord, &review.Success, &review.StageId)
 		if err != nil {
-			return nil, fmt.Errorf("storage - GetMostRecentReviews: %s", err)
+			return nil, storageError("GetMostRecentReviews", err)
 		}
 		result = append(result, review)
 	}
 	return result, nil
 }
 
-func (s *storage) CountPendingReviews(userId string) (int, error) {
+func (s *storage) CountPendingReviews(ctx context.Context, userId string) (int, error) {
 	query := `
 		SELECT COUNT(*) FROM UserCardStatus
 		WHERE user_id = $1 AND next_review_date <= NOW();
 	`
 	var count int
-	err := s.db.QueryRow(query, userId).Scan(&count)
-	return count, err
+	err := s.db.QueryRowContext(ctx, query, userId).Scan(&count)
+	if err != nil {
+		return 0, storageError("CountPendingReviews", err)
+	}
+	return count, nil
 }
 
-func (s *storage) GetRecentMistakes(userID string) ([]api.CardTag, error) {
-	rows, err := s.MostRecentMistakesQuery(userID)
+func (s *storage) GetRecentMistakes(ctx context.Context, userID string) ([]api.CardTag, error) {
+	rows, err := s.MostRecentMistakesQuery(ctx, userID)
 	if err != nil {
-		return nil, err
+		return nil, storageError("GetRecentMistakes", err)
 	}
 	defer rows.Close()
 
@@ -135,7 +325,7 @@ func (s *storage) GetRecentMistakes(userID string) ([]api.CardTag, error) {
 	for rows.Next() {
 		var m api.CardTag
 		if err := rows.Scan(&m.Id, &m.Word, &m.Type); err != nil {
-			return nil, err
+			return nil, storageError("GetRecentMistakes", err)
 		}
 		mistakes = append(mistakes, m)
 	}
@@ -143,10 +333,10 @@ func (s *storage) GetRecentMistakes(userID string) ([]api.CardTag, error) {
 	return mistakes, nil
 }
 
-func (s *storage) GetLevelProgress(userId string) ([]api.CardProgress, error) {
-	rows, err := s.LevelProgressQuery(userId)
+func (s *storage) GetLevelProgress(ctx context.Context, userId string) ([]api.CardProgress, error) {
+	rows, err := s.LevelProgressQuery(ctx, userId)
 	if err != nil {
-		return nil, err
+		return nil, storageError("GetLevelProgress", err)
 	}
 	defer rows.Close()
 
@@ -155,17 +345,17 @@ func (s *storage) GetLevelProgress(userId string) ([]api.CardProgress, error) {
 		var lp api.CardProgress
 		err := rows.Scan(&lp.CardId, &lp.CardWord, &lp.StageId)
 		if err != nil {
-			return nil, err
+			return nil, storageError("GetLevelProgress", err)
 		}
 		progress = append(progress, lp)
 	}
 	return progress, nil
 }
 
-func (s *storage) GetWordStats(userId string) (map[string]map[string]int, error) {
-	rows, err := s.WordPerStageStatsQuery(userId)
+func (s *storage) GetWordStats(ctx context.Context, userId string) (map[string]map[string]int, error) {
+	rows, err := s.WordPerStageStatsQuery(ctx, userId)
 	if err != nil {
-		return nil, err
+		return nil, storageError("GetWordStats", err)
 	}
 	defer rows.Close()
 
@@ -175,7 +365,7 @@ func (s *storage) GetWordStats(userId string) (map[string]map[string]int, error)
 		var count int
 		err := rows.Scan(&stage, &wordType, &count)
 		if err != nil {
-			return nil, err
+			return nil, storageError("GetWordStats", err)
 		}
 		if _, ok := stats[stage]; !ok {
 			stats[stage] = make(map[string]int)
@@ -185,89 +375,142 @@ func (s *storage) GetWordStats(userId string) (map[string]map[string]int, error)
 	return stats, nil
 }
 
-func (s *storage) GetCard(id int) (api.Card, error) {
-	rows, err := s.CardQuery(id)
+func (s *storage) GetUserLevel(ctx context.Context, userId string) (int, error) {
+	var level int
+	err := s.UserLevelQuery(ctx, userId).Scan(&level)
+	if err != nil {
+		return 0, storageError("GetUserLevel", err)
+	}
+	return level, nil
+}
+
+func (s *storage) PromoteUser(ctx context.Context, userId string, level int) (bool, error) {
+	result, err := s.UserLevelUpdate(ctx, userId, level)
+	if err != nil {
+		return false, storageError("PromoteUser", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, storageError("PromoteUser", err)
+	}
+	return affected > 0, nil
+}
+
+func (s *storage) GetCard(ctx context.Context, id int) (api.Card, error) {
+	rows, err := s.CardQuery(ctx, id)
 	if err == sql.ErrNoRows {
 		return api.Card{}, nil
 	} else if err != nil {
-		return api.Card{}, fmt.Errorf("storage - GetCard: %s", err)
+		return api.Card{}, storageError("GetCard", err)
 	}
 	defer rows.Close()
 
 	result, err := parseAllCardsFromQuery(rows)
 	if err != nil {
-		return api.Card{}, err
+		return api.Card{}, storageError("GetCard", err)
+	} else if len(result) == 0 {
+		return api.Card{}, nil
 	}
 
 	return result[0], nil
 }
 
-func (s *storage) InsertCard(word string, translation []string, wordType string, gender string, level int) (int, error) {
-	row, err := s.CardsInsert(word, translation, wordType, gender, level)
+// FindCardId looks a card up by its word and gender, the key of unique_word_gender
+func (s *storage) FindCardId(ctx context.Context, word string, gender string) (int, bool, error) {
+	var cardId int
+	err := s.CardIdQuery(ctx, word, gender).Scan(&cardId)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, storageError("FindCardId", err)
+	}
+
+	return cardId, true, nil
+}
+
+func (s *storage) InsertCard(ctx context.Context, word string, translation []string, wordType string, gender string, level int) (int, error) {
+	row, err := s.CardsInsert(ctx, word, translation, wordType, gender, level)
 	if err != nil {
-		return 0, fmt.Errorf("storage - CardsInsert: %s", err)
+		return 0, storageError("CardsInsert", err)
 	}
 
 	var cardId int
 	err = row.Scan(&cardId)
 	if err != nil {
-		if strings.Contains(err.Error(), "unique_word_gender") {
-			return 0, fmt.Errorf("storage - InsertCard: duplicate card: %s", err)
+		if isUniqueViolation(err, "unique_word_gender") {
+			return 0, fmt.Errorf("storage - InsertCard: %w: %w", api.ErrDuplicateCard, err)
 		}
-		return 0, fmt.Errorf("storage - InsertCard: %s", err)
+		return 0, storageError("InsertCard", err)
 	}
 	return cardId, nil
 }
 
-func (s *storage) UpdateCard(cardId int, word string, translation []string, wordType string, gender string, level int) error {
-	_, err := s.CardsUpdate(cardId, word, translation, wordType, gender, level)
+func (s *storage) UpdateCard(ctx context.Context, cardId int, word string, translation []string, wordType string, gender string, level int) error {
+	result, err := s.CardsUpdate(ctx, cardId, word, translation, wordType, gender, level)
+	if isUniqueViolation(err, "unique_word_gender") {
+		return fmt.Errorf("storage - UpdateCard: %w: %w", api.ErrDuplicateCard, err)
+	} else if err != nil {
+		return storageError("UpdateCard", err)
+	}
+
+	updated, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("storage - InsertOrUpdateCard: %s", err)
+		return storageError("UpdateCard", err)
+	} else if updated == 0 {
+		return fmt.Errorf("storage - UpdateCard: %w: %d", api.ErrCardNotFound, cardId)
 	}
 	return nil
 }
 
-func (s *storage) InsertOrUpdateConjugation(isUpdate bool, cardId int, tense string, forms []string, isIrregular bool) error {
+func (s *storage) InsertOrUpdateConjugation(ctx context.Context, isUpdate bool, cardId int, tense string, forms []string, isIrregular bool) error {
 	var err error
 
 	if isUpdate {
-		_, err = s.ConjugationsUpdate(cardId, tense, forms, isIrregular)
+		_, err = s.ConjugationsUpdate(ctx, cardId, tense, forms, isIrregular)
 	} else {
-		_, err = s.ConjugationsInsert(cardId, tense, forms, isIrregular)
+		_, err = s.ConjugationsInsert(ctx, cardId, tense, forms, isIrregular)
 	}
 	if err != nil {
-		return fmt.Errorf("storage - InsertOrUpdateConjugation: %s", err)
+		return storageError("InsertOrUpdateConjugation", err)
 	}
 
 	return nil
 }
 
-func (s *storage) InsertOrUpdateForm(isUpdate bool, cardId int, gender string, number string, form string) error {
+func (s *storage) InsertOrUpdateForm(ctx context.Context, isUpdate bool, cardId int, gender string, number string, form string) error {
 	var err error
 
 	if isUpdate {
-		_, err = s.FormsUpdate(cardId, gender, number, form)
+		_, err = s.FormsUpdate(ctx, cardId, gender, number, form)
 	} else {
-		_, err = s.FormsInsert(cardId, gender, number, form)
+		_, err = s.FormsInsert(ctx, cardId, gender, number, form)
 	}
 	if err != nil {
-		return fmt.Errorf("storage - InsertOrUpdateForm: %s", err)
+		return storageError("InsertOrUpdateForm", err)
 	}
 	return nil
 }
 
-func (s *storage) DeleteCard(cardId int) error {
-	_, err := s.CardsDelete(cardId)
+func (s *storage) DeleteCard(ctx context.Context, cardId int) error {
+	result, err := s.CardsDelete(ctx, cardId)
+	if err != nil {
+		return storageError("DeleteCard", err)
+	}
+
+	deleted, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("storage - DeleteCard: %s", err)
+		return storageError("DeleteCard", err)
+	} else if deleted == 0 {
+		return fmt.Errorf("storage - DeleteCard: %w: %d", api.ErrCardNotFound, cardId)
 	}
 	return nil
 }
 
-func (s *storage) SearchCards(query api.CardQueryParams) ([]api.Card, error) {
-	rows, err := s.SearchCardsQuery(query)
+func (s *storage) SearchCards(ctx context.Context, query api.CardQueryParams) ([]api.Card, error) {
+	rows, err := s.SearchCardsQuery(ctx, query)
 	if err != nil {
-		return nil, err
+		return nil, storageError("SearchCards", err)
 	}
 	defer rows.Close()
 
@@ -277,14 +520,242 @@ func (s *storage) SearchCards(query api.CardQueryParams) ([]api.Card, error) {
 
 		err := rows.Scan(&card.CardId, &card.Word, &card.Translation, &card.WordType, &card.Gender, &card.Level)
 		if err != nil {
-			return nil, err
+			return nil, storageError("SearchCards", err)
 		}
 		newCard, err := parseCardNoForms(card)
 		if err != nil {
-			return nil, err
+			return nil, storageError("SearchCards", err)
 		}
 		cards = append(cards, newCard)
 	}
 
 	return cards, nil
 }
+
+// ExportCards calls fn with every card, its forms and conjugations included,
+// as they are read. An error of fn stops the export and is returned as is.
+func (s *storage) ExportCards(ctx context.Context, fn func(api.Card) error) error {
+	rows, err := s.AllCardsQuery(ctx)
+	if err != nil {
+		return storageError("ExportCards", err)
+	}
+	defer rows.Close()
+
+	var fnErr error
+	err = eachCardFromQuery(rows, func(card api.Card) error {
+		fnErr = fn(card)
+		return fnErr
+	})
+	if fnErr != nil {
+		return fnErr
+	} else if err != nil {
+		return storageError("ExportCards", err)
+	}
+	return nil
+}
+
+// GetTenses lists the tenses conjugated by at least one card
+func (s *storage) GetTenses(ctx context.Context) ([]string, error) {
+	rows, err := s.TensesQuery(ctx)
+	if err != nil {
+		return nil, storageError("GetTenses", err)
+	}
+	defer rows.Close()
+
+	tenses := []string{}
+	for rows.Next() {
+		var tense string
+		if err := rows.Scan(&tense); err != nil {
+			return nil, storageError("GetTenses", err)
+		}
+		tenses = append(tenses, tense)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, storageError("GetTenses", err)
+	}
+
+	return tenses, nil
+}
+
+func (s *storage) GetUser(ctx context.Context, userId string) (api.User, error) {
+	row := s.UserQuery(ctx, userId)
+
+	user, err := scanUser(row)
+	if err == sql.ErrNoRows {
+		return api.User{}, nil
+	} else if err != nil {
+		return api.User{}, storageError("GetUser", err)
+	}
+	return user, nil
+}
+
+func (s *storage) InsertUser(ctx context.Context, user api.User) (api.User, error) {
+	row := s.UsersInsert(ctx, user)
+
+	inserted, err := scanUser(row)
+	if err != nil {
+		if isUniqueViolation(err, "users_pkey") {
+			return api.User{}, fmt.Errorf("storage - InsertUser: %w: %w", api.ErrDuplicateUser, err)
+		}
+		return api.User{}, storageError("InsertUser", err)
+	}
+	return inserted, nil
+}
+
+func (s *storage) UpdateUser(ctx context.Context, userId string, update api.UserUpdate) (api.User, error) {
+	row := s.UsersUpdate(ctx, userId, update)
+
+	updated, err := scanUser(row)
+	if err == sql.ErrNoRows {
+		return api.User{}, nil
+	} else if err != nil {
+		return api.User{}, storageError("UpdateUser", err)
+	}
+	return updated, nil
+}
+
+func (s *storage) UpdateUserRole(ctx context.Context, userId string, role api.Role) (api.User, error) {
+	var updated api.User
+
+	// the admins are locked so that concurrent demotions cannot remove the last one
+	err := s.withTx(ctx, func(tx *storage) error {
+		if _, err := tx.AdminsLock(ctx); err != nil {
+			return storageError("UpdateUserRole", err)
+		}
+
+		var err error
+		updated, err = scanUser(tx.UserRoleUpdate(ctx, userId, role))
+		if err == sql.ErrNoRows {
+			updated = api.User{}
+			return nil
+		} else if err != nil {
+			return storageError("UpdateUserRole", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return api.User{}, err
+	}
+	return updated, nil
+}
+
+func (s *storage) UpdateUserLevel(ctx context.Context, userId string, level int) (api.User, error) {
+	updated, err := scanUser(s.UserLevelSet(ctx, userId, level))
+	if err == sql.ErrNoRows {
+		return api.User{}, nil
+	} else if err != nil {
+		return api.User{}, storageError("UpdateUserLevel", err)
+	}
+	return updated, nil
+}
+
+func (s *storage) GetUsersByRole(ctx context.Context, role api.Role) ([]api.User, error) {
+	rows, err := s.UsersByRoleQuery(ctx, role)
+	if err != nil {
+		return nil, storageError("GetUsersByRole", err)
+	}
+	defer rows.Close()
+
+	users := []api.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, storageError("GetUsersByRole", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, storageError("GetUsersByRole", err)
+	}
+	return users, nil
+}
+
+func (s *storage) DeleteUser(ctx context.Context, userId string) (bool, error) {
+	var affected int64
+
+	// the admins are locked so that concurrent deletions cannot remove the last one
+	err := s.withTx(ctx, func(tx *storage) error {
+		if _, err := tx.AdminsLock(ctx); err != nil {
+			return storageError("DeleteUser", err)
+		}
+
+		result, err := tx.UsersDelete(ctx, userId)
+		if err != nil {
+			return storageError("DeleteUser", err)
+		}
+
+		affected, err = result.RowsAffected()
+		if err != nil {
+			return storageError("DeleteUser", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (s *storage) InsertApiKey(ctx context.Context, key api.ApiKey, hash []byte) (api.ApiKey, error) {
+	inserted, err := scanApiKey(s.ApiKeysInsert(ctx, key, hash))
+	if err != nil {
+		return api.ApiKey{}, storageError("InsertApiKey", err)
+	}
+	return inserted, nil
+}
+
+func (s *storage) GetApiKeys(ctx context.Context) ([]api.ApiKey, error) {
+	rows, err := s.ApiKeysQuery(ctx)
+	if err != nil {
+		return nil, storageError("GetApiKeys", err)
+	}
+	defer rows.Close()
+
+	keys := []api.ApiKey{}
+	for rows.Next() {
+		key, err := scanApiKey(rows)
+		if err != nil {
+			return nil, storageError("GetApiKeys", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, storageError("GetApiKeys", err)
+	}
+	return keys, nil
+}
+
+// GetApiKeyByPrefix returns the key with prefix and its stored hash, or an
+// empty ApiKey when there is none
+func (s *storage) GetApiKeyByPrefix(ctx context.Context, prefix string) (api.ApiKey, []byte, error) {
+	var hash []byte
+	key, err := scanApiKey(s.ApiKeyByPrefixQuery(ctx, prefix), &hash)
+	if err == sql.ErrNoRows {
+		return api.ApiKey{}, nil, nil
+	} else if err != nil {
+		return api.ApiKey{}, nil, storageError("GetApiKeyByPrefix", err)
+	}
+	return key, hash, nil
+}
+
+// RevokeApiKey reports false when no active key has keyId
+func (s *storage) RevokeApiKey(ctx context.Context, keyId int) (bool, error) {
+	result, err := s.ApiKeyRevoke(ctx, keyId)
+	if err != nil {
+		return false, storageError("RevokeApiKey", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, storageError("RevokeApiKey", err)
+	}
+	return affected > 0, nil
+}
+
+func (s *storage) TouchApiKey(ctx context.Context, keyId int, usedAt time.Time) error {
+	_, err := s.ApiKeyTouch(ctx, keyId, usedAt)
+	if err != nil {
+		return storageError("TouchApiKey", err)
+	}
+	return nil
+}
@@ -1,12 +1,20 @@
 package repository_test
 
 import (
+	"context"
 	"crabigateur-api/pkg/api"
+	"crabigateur-api/pkg/logging"
 	"crabigateur-api/pkg/repository"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -15,7 +23,7 @@ func TestGetLessons(t *testing.T) {
 	assert.NoError(t, err)
 	defer db.Close()
 
-	storage := repository.NewStorage(db)
+	storage := repository.NewStorage(db, logging.Discard())
 
 	tests := []struct {
 		name       string
@@ -96,7 +104,7 @@ func TestGetLessons(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mockSetup()
-			cards, err := storage.GetLessons(tt.userId, tt.numLessons)
+			cards, err := storage.GetLessons(context.Background(), tt.userId, tt.numLessons)
 
 			if tt.expectErr {
 				assert.Error(t, err)
@@ -116,22 +124,22 @@ func TestGetReviews(t *testing.T) {
 	assert.NoError(t, err)
 	defer db.Close()
 
-	storage := repository.NewStorage(db)
+	storage := repository.NewStorage(db, logging.Discard())
 
 	tests := []struct {
-		name       string
-		userId     string
+		name        string
+		userId      string
 		firstReview bool
-		sort       []api.SortOrder
-		mockSetup  func()
-		expected   []api.Card
-		expectErr  bool
+		sort        []api.SortOrder
+		mockSetup   func()
+		expected    []api.Card
+		expectErr   bool
 	}{
 		{
-			name:       "Success",
-			userId:     "123",
+			name:        "Success",
+			userId:      "123",
 			firstReview: false,
-			sort:       []api.SortOrder{api.DateAsc, api.LevelDesc},
+			sort:        []api.SortOrder{api.DateAsc, api.LevelDesc},
 			mockSetup: func() {
 				rows := sqlmock.NewRows([]string{
 					"card_id", "word", "translation", "word_type", "level", "gender",
@@ -150,10 +158,10 @@ func TestGetReviews(t *testing.T) {
 			expectErr: false,
 		},
 		{
-			name:       "Empty Result Set",
-			userId:     "123",
+			name:        "Empty Result Set",
+			userId:      "123",
 			firstReview: false,
-			sort:       []api.SortOrder{api.DateAsc},
+			sort:        []api.SortOrder{api.DateAsc},
 			mockSetup: func() {
 				rows := sqlmock.NewRows([]string{
 					"card_id", "word", "translation", "word_type", "level", "gender",
@@ -167,10 +175,10 @@ func TestGetReviews(t *testing.T) {
 			expectErr: false,
 		},
 		{
-			name:       "SQL Error",
-			userId:     "123",
+			name:        "SQL Error",
+			userId:      "123",
 			firstReview: false,
-			sort:       []api.SortOrder{api.DateAsc},
+			sort:        []api.SortOrder{api.DateAsc},
 			mockSetup: func() {
 				mock.ExpectQuery(`WITH PendingReviews AS .*`).
 					WithArgs("123", false).
@@ -180,10 +188,10 @@ func TestGetReviews(t *testing.T) {
 			expectErr: true,
 		},
 		{
-			name:       "Invalid Data in Columns",
-			userId:     "123",
+			name:        "Invalid Data in Columns",
+			userId:      "123",
 			firstReview: false,
-			sort:       []api.SortOrder{api.DateAsc},
+			sort:        []api.SortOrder{api.DateAsc},
 			mockSetup: func() {
 				rows := sqlmock.NewRows([]string{
 					"card_id", "word", "translation", "word_type", "level", "gender",
@@ -202,7 +210,7 @@ func TestGetReviews(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mockSetup()
-			cards, err := storage.GetReview(tt.userId, tt.firstReview, tt.sort)
+			cards, err := storage.GetReview(context.Background(), tt.userId, tt.firstReview, tt.sort)
 
 			if tt.expectErr {
 				assert.Error(t, err)
@@ -217,3 +225,1270 @@ func TestGetReviews(t *testing.T) {
 	}
 }
 
+func TestGetUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	storage := repository.NewStorage(db, logging.Discard())
+	joined := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		userId    string
+		mockSetup func()
+		expected  api.User
+		expectErr bool
+	}{
+		{
+			name:   "Success",
+			userId: "123",
+			mockSetup: func() {
+				rows := sqlmock.NewRows([]string{"user_id", "username", "email", "level", "scheduler", "role", "date_joined"}).
+					AddRow("123", "crabi", "crabi@example.com", 2, "fsrs", "editor", joined)
+				mock.ExpectQuery(`SELECT user_id, username, email, level, scheduler, role, date_joined FROM Users`).
+					WithArgs("123").
+					WillReturnRows(rows)
+			},
+			expected:  api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 2, Scheduler: api.FSRS, Role: api.Editor, DateJoined: joined},
+			expectErr: false,
+		},
+		{
+			name:   "Not Found",
+			userId: "404",
+			mockSetup: func() {
+				rows := sqlmock.NewRows([]string{"user_id", "username", "email", "level", "scheduler", "role", "date_joined"})
+				mock.ExpectQuery(`SELECT user_id, username, email, level, scheduler, role, date_joined FROM Users`).
+					WithArgs("404").
+					WillReturnRows(rows)
+			},
+			expected:  api.User{},
+			expectErr: false,
+		},
+		{
+			name:   "SQL Error",
+			userId: "123",
+			mockSetup: func() {
+				mock.ExpectQuery(`SELECT user_id, username, email, level, scheduler, role, date_joined FROM Users`).
+					WithArgs("123").
+					WillReturnError(fmt.Errorf("query error"))
+			},
+			expected:  api.User{},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			user, err := storage.GetUser(context.Background(), tt.userId)
+
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expected, user)
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestInsertUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	storage := repository.NewStorage(db, logging.Discard())
+	joined := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+	user := api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Scheduler: api.PenaltyStages, Role: api.Learner}
+
+	tests := []struct {
+		name        string
+		mockSetup   func()
+		expected    api.User
+		expectErr   bool
+		expectedErr string
+	}{
+		{
+			name: "Success",
+			mockSetup: func() {
+				rows := sqlmock.NewRows([]string{"user_id", "username", "email", "level", "scheduler", "role", "date_joined"}).
+					AddRow("123", "crabi", "crabi@example.com", 1, "stages", "learner", joined)
+				mock.ExpectQuery(`INSERT INTO Users`).
+					WithArgs("123", "crabi", "crabi@example.com", 1, "stages", api.Learner).
+					WillReturnRows(rows)
+			},
+			expected:  api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Scheduler: api.PenaltyStages, Role: api.Learner, DateJoined: joined},
+			expectErr: false,
+		},
+		{
+			name: "Duplicate User",
+			mockSetup: func() {
+				mock.ExpectQuery(`INSERT INTO Users`).
+					WithArgs("123", "crabi", "crabi@example.com", 1, "stages", api.Learner).
+					WillReturnError(&pq.Error{Code: "23505", Constraint: "users_pkey", Message: `duplicate key value violates unique constraint "users_pkey"`})
+			},
+			expected:    api.User{},
+			expectErr:   true,
+			expectedErr: "A user with this id already exists",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			inserted, err := storage.InsertUser(context.Background(), user)
+
+			if tt.expectErr {
+				assert.ErrorIs(t, err, api.ErrDuplicateUser)
+				assert.Contains(t, err.Error(), tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expected, inserted)
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	storage := repository.NewStorage(db, logging.Discard())
+	joined := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+	email := "gateur@example.com"
+
+	tests := []struct {
+		name      string
+		userId    string
+		mockSetup func()
+		expected  api.User
+		expectErr bool
+	}{
+		{
+			name:   "Success",
+			userId: "123",
+			mockSetup: func() {
+				rows := sqlmock.NewRows([]string{"user_id", "username", "email", "level", "scheduler", "role", "date_joined"}).
+					AddRow("123", "crabi", email, 1, "stages", "learner", joined)
+				mock.ExpectQuery(`UPDATE Users`).
+					WithArgs("123", nil, email, nil).
+					WillReturnRows(rows)
+			},
+			expected:  api.User{UserId: "123", Username: "crabi", Email: email, Level: 1, Scheduler: api.PenaltyStages, Role: api.Learner, DateJoined: joined},
+			expectErr: false,
+		},
+		{
+			name:   "Not Found",
+			userId: "404",
+			mockSetup: func() {
+				rows := sqlmock.NewRows([]string{"user_id", "username", "email", "level", "scheduler", "role", "date_joined"})
+				mock.ExpectQuery(`UPDATE Users`).
+					WithArgs("404", nil, email, nil).
+					WillReturnRows(rows)
+			},
+			expected:  api.User{},
+			expectErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			user, err := storage.UpdateUser(context.Background(), tt.userId, api.UserUpdate{Email: &email})
+
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expected, user)
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUpdateUserRole(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	storage := repository.NewStorage(db, logging.Discard())
+	joined := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+	columns := []string{"user_id", "username", "email", "level", "scheduler", "role", "date_joined"}
+
+	tests := []struct {
+		name      string
+		mockSetup func()
+		expected  api.User
+		expectErr bool
+	}{
+		{
+			name: "Success",
+			mockSetup: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(`SELECT user_id FROM Users\s+WHERE role = 'admin'\s+ORDER BY user_id\s+FOR UPDATE`).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectQuery(`UPDATE Users\s+SET role = \$2`).
+					WithArgs("123", api.Editor).
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("123", "crabi", "crabi@example.com", 1, "stages", "editor", joined))
+				mock.ExpectCommit()
+			},
+			expected:  api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 1, Scheduler: api.PenaltyStages, Role: api.Editor, DateJoined: joined},
+			expectErr: false,
+		},
+		{
+			name: "Not updated",
+			mockSetup: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(`SELECT user_id FROM Users\s+WHERE role = 'admin'\s+ORDER BY user_id\s+FOR UPDATE`).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectQuery(`UPDATE Users\s+SET role = \$2`).
+					WithArgs("123", api.Editor).
+					WillReturnRows(sqlmock.NewRows(columns))
+				mock.ExpectCommit()
+			},
+			expected:  api.User{},
+			expectErr: false,
+		},
+		{
+			name: "SQL Error",
+			mockSetup: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(`SELECT user_id FROM Users\s+WHERE role = 'admin'\s+ORDER BY user_id\s+FOR UPDATE`).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectQuery(`UPDATE Users\s+SET role = \$2`).
+					WithArgs("123", api.Editor).
+					WillReturnError(fmt.Errorf("query error"))
+				mock.ExpectRollback()
+			},
+			expected:  api.User{},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			user, err := storage.UpdateUserRole(context.Background(), "123", api.Editor)
+
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expected, user)
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUpdateUserLevel(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	storage := repository.NewStorage(db, logging.Discard())
+	joined := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+	columns := []string{"user_id", "username", "email", "level", "scheduler", "role", "date_joined"}
+
+	tests := []struct {
+		name      string
+		mockSetup func()
+		expected  api.User
+		expectErr bool
+	}{
+		{
+			name: "Success",
+			mockSetup: func() {
+				mock.ExpectQuery(`UPDATE Users\s+SET level = \$2\s+WHERE user_id = \$1\s+AND \$2 <= \(SELECT COALESCE\(MAX\(level\), 1\) FROM Cards\)`).
+					WithArgs("123", 3).
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("123", "crabi", "crabi@example.com", 3, "stages", "learner", joined))
+			},
+			expected:  api.User{UserId: "123", Username: "crabi", Email: "crabi@example.com", Level: 3, Scheduler: api.PenaltyStages, Role: api.Learner, DateJoined: joined},
+			expectErr: false,
+		},
+		{
+			name: "Not updated",
+			mockSetup: func() {
+				mock.ExpectQuery(`UPDATE Users\s+SET level = \$2`).
+					WithArgs("123", 3).
+					WillReturnRows(sqlmock.NewRows(columns))
+			},
+			expected:  api.User{},
+			expectErr: false,
+		},
+		{
+			name: "SQL Error",
+			mockSetup: func() {
+				mock.ExpectQuery(`UPDATE Users\s+SET level = \$2`).
+					WithArgs("123", 3).
+					WillReturnError(fmt.Errorf("query error"))
+			},
+			expected:  api.User{},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			user, err := storage.UpdateUserLevel(context.Background(), "123", 3)
+
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expected, user)
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetUsersByRole(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	storage := repository.NewStorage(db, logging.Discard())
+	joined := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	rows := sqlmock.NewRows([]string{"user_id", "username", "email", "level", "scheduler", "role", "date_joined"}).
+		AddRow("1", "admin", "admin@example.com", 3, "stages", "admin", joined).
+		AddRow("2", nil, "other@example.com", 1, "fsrs", "admin", joined)
+	mock.ExpectQuery(`SELECT user_id, username, email, level, scheduler, role, date_joined\s+FROM Users\s+WHERE role = \$1`).
+		WithArgs(api.Admin).
+		WillReturnRows(rows)
+
+	users, err := storage.GetUsersByRole(context.Background(), api.Admin)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []api.User{
+		{UserId: "1", Username: "admin", Email: "admin@example.com", Level: 3, Scheduler: api.PenaltyStages, Role: api.Admin, DateJoined: joined},
+		{UserId: "2", Username: "", Email: "other@example.com", Level: 1, Scheduler: api.FSRS, Role: api.Admin, DateJoined: joined},
+	}, users)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	storage := repository.NewStorage(db, logging.Discard())
+
+	tests := []struct {
+		name      string
+		userId    string
+		mockSetup func()
+		expected  bool
+		expectErr bool
+	}{
+		{
+			name:   "Success",
+			userId: "123",
+			mockSetup: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(`SELECT user_id FROM Users\s+WHERE role = 'admin'\s+ORDER BY user_id\s+FOR UPDATE`).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(`WITH target AS .* role <> 'admin' .* DELETE FROM Users`).
+					WithArgs("123").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			expected:  true,
+			expectErr: false,
+		},
+		{
+			name:   "Not Found",
+			userId: "404",
+			mockSetup: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(`SELECT user_id FROM Users\s+WHERE role = 'admin'\s+ORDER BY user_id\s+FOR UPDATE`).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(`WITH target AS .* role <> 'admin' .* DELETE FROM Users`).
+					WithArgs("404").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+			expected:  false,
+			expectErr: false,
+		},
+		{
+			name:   "SQL Error",
+			userId: "123",
+			mockSetup: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(`SELECT user_id FROM Users\s+WHERE role = 'admin'\s+ORDER BY user_id\s+FOR UPDATE`).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(`WITH target AS .* role <> 'admin' .* DELETE FROM Users`).
+					WithArgs("123").
+					WillReturnError(fmt.Errorf("exec error"))
+				mock.ExpectRollback()
+			},
+			expected:  false,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			deleted, err := storage.DeleteUser(context.Background(), tt.userId)
+
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expected, deleted)
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestPromoteUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	storage := repository.NewStorage(db, logging.Discard())
+
+	tests := []struct {
+		name      string
+		mockSetup func()
+		expected  bool
+		expectErr bool
+	}{
+		{
+			name: "Promoted",
+			mockSetup: func() {
+				mock.ExpectExec(`UPDATE Users SET level = level \+ 1`).
+					WithArgs("123", 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expected:  true,
+			expectErr: false,
+		},
+		{
+			name: "No next level",
+			mockSetup: func() {
+				mock.ExpectExec(`UPDATE Users SET level = level \+ 1`).
+					WithArgs("123", 1).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			expected:  false,
+			expectErr: false,
+		},
+		{
+			name: "SQL Error",
+			mockSetup: func() {
+				mock.ExpectExec(`UPDATE Users SET level = level \+ 1`).
+					WithArgs("123", 1).
+					WillReturnError(fmt.Errorf("exec error"))
+			},
+			expected:  false,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			promoted, err := storage.PromoteUser(context.Background(), "123", 1)
+
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expected, promoted)
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetSRSStages(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	storage := repository.NewStorage(db, logging.Discard())
+
+	rows := sqlmock.NewRows([]string{"stage_id", "stage_name", "interval_seconds", "stage_penalty"}).
+		AddRow(1, "Apprentice 1", 14400, 1).
+		AddRow(9, "Burned", 0, 0)
+	mock.ExpectQuery(`SELECT stage_id, stage_name, .* FROM SRSStages`).
+		WillReturnRows(rows)
+
+	stages, err := storage.GetSRSStages(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, api.StageTable{
+		{StageId: 1, Name: "Apprentice 1", Interval: 4 * time.Hour, Penalty: 1},
+		{StageId: 9, Name: "Burned", Interval: 0, Penalty: 0},
+	}, stages)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetCard(t *testing.T) {
+	columns := []string{
+		"card_id", "word", "translation", "word_type", "level", "gender",
+		"tense", "forms", "irregular", "gender", "number", "form",
+	}
+
+	tests := []struct {
+		name     string
+		rows     *sqlmock.Rows
+		expected api.Card
+	}{
+		{
+			name: "Irregular adjective",
+			rows: sqlmock.NewRows(columns).
+				AddRow(2, "beau", []byte(`["beautiful"]`), "irregular", 2, nil, nil, nil, nil, "m", "plural", "beaux").
+				AddRow(2, "beau", []byte(`["beautiful"]`), "irregular", 2, nil, nil, nil, nil, "f", "singular", "belle"),
+			expected: api.Card{CardId: 2, Word: "beau", Translation: []string{"beautiful"}, WordType: "irregular", Level: 2,
+				Forms: map[string][]string{"m.s.": {"beau"}, "m.p.": {"beaux"}, "f.s.": {"belle"}}},
+		},
+		{
+			name: "Feminine irregular noun has its gender and no masculine form",
+			rows: sqlmock.NewRows(columns).
+				AddRow(3, "maison", []byte(`["house"]`), "irregular", 1, "f", nil, nil, nil, "f", "plural", "maisons"),
+			expected: api.Card{CardId: 3, Word: "maison", Translation: []string{"house"}, WordType: "irregular", Gender: "f", Level: 1,
+				Forms: map[string][]string{"f.p.": {"maisons"}}},
+		},
+		{
+			name: "Irregular card without forms",
+			rows: sqlmock.NewRows(columns).
+				AddRow(4, "œil", []byte(`["eye"]`), "irregular", 1, "m", nil, nil, nil, nil, nil, nil),
+			expected: api.Card{CardId: 4, Word: "œil", Translation: []string{"eye"}, WordType: "irregular", Gender: "m", Level: 1,
+				Forms: map[string][]string{"m.s.": {"œil"}}},
+		},
+		{
+			name: "Verb without conjugations",
+			rows: sqlmock.NewRows(columns).
+				AddRow(5, "finir", []byte(`["to finish"]`), "verb", 2, nil, nil, nil, nil, nil, nil, nil),
+			expected: api.Card{CardId: 5, Word: "finir", Translation: []string{"to finish"}, WordType: "verb", Level: 2,
+				Forms: map[string][]string{}},
+		},
+		{
+			name:     "Card not found",
+			rows:     sqlmock.NewRows(columns),
+			expected: api.Card{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+			mock.ExpectQuery(`SELECT c.card_id, .* WHERE c.card_id = \$1`).WithArgs(tt.expected.CardId).WillReturnRows(tt.rows)
+
+			card, err := repository.NewStorage(db, logging.Discard()).GetCard(context.Background(), tt.expected.CardId)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, card)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestSearchCards(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"card_id", "word", "translation", "word_type", "gender", "level"}).
+		AddRow(3, "maison", []byte(`["house"]`), "irregular", "f", 1).
+		AddRow(6, "maisonnette", []byte(`["cottage"]`), "regular", "f", 3)
+	mock.ExpectQuery(`SELECT card_id, word, translation, word_type, gender, level FROM Cards WHERE word ILIKE \$1`).
+		WithArgs("%maison%").WillReturnRows(rows)
+
+	cards, err := repository.NewStorage(db, logging.Discard()).SearchCards(context.Background(), api.CardQueryParams{Word: "maison"})
+
+	// search results leave the forms out, whatever the word type
+	assert.NoError(t, err)
+	assert.Equal(t, []api.Card{
+		{CardId: 3, Word: "maison", Translation: []string{"house"}, WordType: "irregular", Gender: "f", Level: 1},
+		{CardId: 6, Word: "maisonnette", Translation: []string{"cottage"}, WordType: "regular", Gender: "f", Level: 3},
+	}, cards)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExportCards(t *testing.T) {
+	columns := []string{
+		"card_id", "word", "translation", "word_type", "level", "gender",
+		"tense", "forms", "irregular", "gender", "number", "form",
+	}
+	errStop := errors.New("client gone")
+
+	tests := []struct {
+		name      string
+		mockSetup func(mock sqlmock.Sqlmock)
+		stopAfter int // cards fn accepts before failing, 0 for all
+		expected  []api.Card
+		expectErr error
+	}{
+		{
+			name: "Cards with their forms and conjugations",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows(columns).
+					AddRow(1, "chat", []byte(`["cat"]`), "regular", 1, "m", nil, nil, nil, nil, nil, nil).
+					AddRow(2, "maison", []byte(`["house"]`), "irregular", 1, "f", nil, nil, nil, "f", "singular", "maison").
+					AddRow(2, "maison", []byte(`["house"]`), "irregular", 1, "f", nil, nil, nil, "f", "plural", "maisons").
+					AddRow(3, "aller", []byte(`["to go"]`), "verb", 1, nil, "présent", []byte(`["vais","vas","va","allons","allez","vont"]`), true, nil, nil, nil).
+					AddRow(3, "aller", []byte(`["to go"]`), "verb", 1, nil, "futur", []byte(`["irai","iras","ira","irons","irez","iront"]`), true, nil, nil, nil).
+					AddRow(4, "finir", []byte(`["to finish"]`), "verb", 2, nil, nil, nil, nil, nil, nil, nil)
+				mock.ExpectQuery(`SELECT c.card_id, .* ORDER BY c.card_id`).WillReturnRows(rows)
+			},
+			expected: []api.Card{
+				{CardId: 1, Word: "chat", Translation: []string{"cat"}, WordType: "regular", Gender: "m", Level: 1},
+				{CardId: 2, Word: "maison", Translation: []string{"house"}, WordType: "irregular", Gender: "f", Level: 1,
+					Forms: map[string][]string{"f.s.": {"maison"}, "f.p.": {"maisons"}}},
+				{CardId: 3, Word: "aller", Translation: []string{"to go"}, WordType: "verb", Level: 1, IrregularVerb: true,
+					Forms: map[string][]string{
+						"présent": {"vais", "vas", "va", "allons", "allez", "vont"},
+						"futur":   {"irai", "iras", "ira", "irons", "irez", "iront"},
+					}},
+				{CardId: 4, Word: "finir", Translation: []string{"to finish"}, WordType: "verb", Level: 2, Forms: map[string][]string{}},
+			},
+		},
+		{
+			name: "Error of fn stops the export",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows(columns).
+					AddRow(1, "chat", []byte(`["cat"]`), "regular", 1, "m", nil, nil, nil, nil, nil, nil).
+					AddRow(2, "chien", []byte(`["dog"]`), "regular", 1, "m", nil, nil, nil, nil, nil, nil).
+					AddRow(3, "lapin", []byte(`["rabbit"]`), "regular", 1, "m", nil, nil, nil, nil, nil, nil)
+				mock.ExpectQuery(`SELECT c.card_id, .* ORDER BY c.card_id`).WillReturnRows(rows)
+			},
+			stopAfter: 1,
+			expected:  []api.Card{{CardId: 1, Word: "chat", Translation: []string{"cat"}, WordType: "regular", Gender: "m", Level: 1}},
+			expectErr: errStop,
+		},
+		{
+			name: "SQL Error",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT c.card_id, .* ORDER BY c.card_id`).WillReturnError(fmt.Errorf("query error"))
+			},
+			expectErr: errors.New("storage - ExportCards: query error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+			tt.mockSetup(mock)
+
+			var cards []api.Card
+			err = repository.NewStorage(db, logging.Discard()).ExportCards(context.Background(), func(card api.Card) error {
+				if tt.stopAfter > 0 && len(cards) == tt.stopAfter {
+					return errStop
+				}
+				cards = append(cards, card)
+				return nil
+			})
+
+			if tt.expectErr != nil {
+				assert.EqualError(t, err, tt.expectErr.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expected, cards)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetTenses(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"tense"}).AddRow("futur").AddRow("présent")
+	mock.ExpectQuery(`SELECT DISTINCT tense FROM Conjugations`).WillReturnRows(rows)
+
+	tenses, err := repository.NewStorage(db, logging.Discard()).GetTenses(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"futur", "présent"}, tenses)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateReview(t *testing.T) {
+	success, incorrect := true, 0
+	reviewDate := time.Date(2024, 12, 1, 10, 0, 0, 0, time.UTC)
+	review := api.Review{CardId: 1, ReviewDate: reviewDate, Success: &success, IncorrectCount: &incorrect}
+	schedule := api.ScheduleResult{
+		Stage:          3,
+		NextReviewDate: reviewDate.Add(24 * time.Hour),
+		Memory:         api.MemoryState{Difficulty: 5.1618, Stability: 3.7145, Retrievability: 1, LastReview: reviewDate},
+	}
+
+	burned := api.ScheduleResult{Stage: 9, Memory: schedule.Memory}
+
+	tests := []struct {
+		name      string
+		schedule  api.ScheduleResult
+		mockSetup func(mock sqlmock.Sqlmock)
+		expected  api.ReviewResult
+		expectErr bool
+	}{
+		{
+			name:     "Success",
+			schedule: schedule,
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO Reviews`).
+					WithArgs("123", 1, reviewDate, &success, nil, 3).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery(`WITH updated AS \(\s*UPDATE UserCardStatus`).
+					WithArgs("123", 1, 3, schedule.NextReviewDate, reviewDate, 5.1618, 3.7145, 1.0, true).
+					WillReturnRows(sqlmock.NewRows([]string{"card_id", "card_word", "success", "stage_id"}).
+						AddRow(1, "chat", true, "3"))
+				mock.ExpectCommit()
+			},
+			expected:  api.ReviewResult{CardId: 1, CardWord: "chat", Success: true, StageId: "3"},
+			expectErr: false,
+		},
+		{
+			name:     "Burned card has no next review date",
+			schedule: burned,
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO Reviews`).
+					WithArgs("123", 1, reviewDate, &success, nil, 9).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery(`WITH updated AS \(\s*UPDATE UserCardStatus`).
+					WithArgs("123", 1, 9, nil, reviewDate, 5.1618, 3.7145, 1.0, true).
+					WillReturnRows(sqlmock.NewRows([]string{"card_id", "card_word", "success", "stage_id"}).
+						AddRow(1, "chat", true, "9"))
+				mock.ExpectCommit()
+			},
+			expected:  api.ReviewResult{CardId: 1, CardWord: "chat", Success: true, StageId: "9"},
+			expectErr: false,
+		},
+		{
+			name:     "Status update failure rolls back the review row",
+			schedule: schedule,
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO Reviews`).
+					WithArgs("123", 1, reviewDate, &success, nil, 3).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery(`WITH updated AS \(\s*UPDATE UserCardStatus`).
+					WillReturnError(fmt.Errorf("query error"))
+				mock.ExpectRollback()
+			},
+			expected:  api.ReviewResult{},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			storage := repository.NewStorage(db, logging.Discard())
+			tt.mockSetup(mock)
+
+			result, err := storage.UpdateReview(context.Background(), "123", review, tt.schedule)
+
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expected, result)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	tests := []struct {
+		name      string
+		mockSetup func(mock sqlmock.Sqlmock)
+		fn        func(s repository.Storage) error
+		expectErr bool
+	}{
+		{
+			name: "Commit",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE Users SET level = level \+ 1`).
+					WithArgs("123", 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			fn: func(s repository.Storage) error {
+				_, err := s.PromoteUser(context.Background(), "123", 1)
+				return err
+			},
+			expectErr: false,
+		},
+		{
+			name: "Rollback on error",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE Users SET level = level \+ 1`).
+					WithArgs("123", 1).
+					WillReturnError(fmt.Errorf("exec error"))
+				mock.ExpectRollback()
+			},
+			fn: func(s repository.Storage) error {
+				_, err := s.PromoteUser(context.Background(), "123", 1)
+				return err
+			},
+			expectErr: true,
+		},
+		{
+			name: "Nested failure rolls back to savepoint",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`SAVEPOINT savepoint_1`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`UPDATE Users SET level = level \+ 1`).
+					WithArgs("123", 1).
+					WillReturnError(fmt.Errorf("exec error"))
+				mock.ExpectExec(`ROLLBACK TO SAVEPOINT savepoint_1`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`SAVEPOINT savepoint_1`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`UPDATE Users SET level = level \+ 1`).
+					WithArgs("456", 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`RELEASE SAVEPOINT savepoint_1`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+			fn: func(s repository.Storage) error {
+				for _, userId := range []string{"123", "456"} {
+					_ = s.WithTx(context.Background(), func(item repository.Storage) error {
+						_, err := item.PromoteUser(context.Background(), userId, 1)
+						return err
+					})
+				}
+				return nil
+			},
+			expectErr: false,
+		},
+		{
+			name: "Savepoints nest",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`SAVEPOINT savepoint_1`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`SAVEPOINT savepoint_2`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`UPDATE Users SET level = level \+ 1`).
+					WithArgs("123", 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`RELEASE SAVEPOINT savepoint_2`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`RELEASE SAVEPOINT savepoint_1`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+			fn: func(s repository.Storage) error {
+				return s.WithTx(context.Background(), func(outer repository.Storage) error {
+					return outer.WithTx(context.Background(), func(inner repository.Storage) error {
+						_, err := inner.PromoteUser(context.Background(), "123", 1)
+						return err
+					})
+				})
+			},
+			expectErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			storage := repository.NewStorage(db, logging.Discard())
+			tt.mockSetup(mock)
+
+			err = storage.WithTx(context.Background(), tt.fn)
+
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCreateCardTransaction(t *testing.T) {
+	card := api.Card{
+		Word:        "manger",
+		Translation: []string{"to eat"},
+		WordType:    "verb",
+		Level:       1,
+		Forms: map[string][]string{
+			"présent": {"mange", "manges", "mange", "mangeons", "mangez", "mangent"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		mockSetup func(mock sqlmock.Sqlmock)
+		expectErr bool
+	}{
+		{
+			name: "Commit",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO Cards`).
+					WillReturnRows(sqlmock.NewRows([]string{"card_id"}).AddRow(7))
+				// the tenses left out are generated, all are written in order
+				for _, tense := range []string{"conditionnel", "futur simple", "imparfait", "impératif", "passé composé", "présent", "subjonctif présent"} {
+					mock.ExpectExec(`INSERT INTO Conjugations`).
+						WithArgs(7, tense, sqlmock.AnyArg(), false).
+						WillReturnResult(sqlmock.NewResult(1, 1))
+				}
+				mock.ExpectCommit()
+			},
+			expectErr: false,
+		},
+		{
+			name: "Conjugation failure rolls back the card",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO Cards`).
+					WillReturnRows(sqlmock.NewRows([]string{"card_id"}).AddRow(7))
+				mock.ExpectExec(`INSERT INTO Conjugations`).
+					WithArgs(7, "conditionnel", sqlmock.AnyArg(), false).
+					WillReturnError(fmt.Errorf("exec error"))
+				mock.ExpectRollback()
+			},
+			expectErr: true,
+		},
+		{
+			name: "Card failure rolls back",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO Cards`).
+					WillReturnError(fmt.Errorf("query error"))
+				mock.ExpectRollback()
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			service := api.NewCardService(repository.NewStorage(db, logging.Discard()), logging.Discard())
+			tt.mockSetup(mock)
+
+			result, err := service.CreateCard(context.Background(), card)
+
+			if tt.expectErr {
+				assert.Error(t, err)
+				assert.True(t, result.IsEmpty())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, 7, result.CardId)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetReviewResult(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	storage := repository.NewStorage(db, logging.Discard())
+	reviewId := "4f9c7f0e-1b7e-4c8e-9a55-0c2c0d3c6a11"
+
+	tests := []struct {
+		name          string
+		mockSetup     func()
+		expected      api.ReviewResult
+		expectedFound bool
+		expectErr     bool
+	}{
+		{
+			name: "Already applied",
+			mockSetup: func() {
+				mock.ExpectQuery(`SELECT r.card_id, c.word AS card_word, r.success, r.new_stage FROM Reviews r`).
+					WithArgs("123", reviewId).
+					WillReturnRows(sqlmock.NewRows([]string{"card_id", "card_word", "success", "new_stage"}).
+						AddRow(1, "chat", true, 3))
+			},
+			expected:      api.ReviewResult{CardId: 1, CardWord: "chat", Success: true, StageId: "3"},
+			expectedFound: true,
+		},
+		{
+			name: "New review",
+			mockSetup: func() {
+				mock.ExpectQuery(`SELECT r.card_id, c.word AS card_word, r.success, r.new_stage FROM Reviews r`).
+					WithArgs("123", reviewId).
+					WillReturnRows(sqlmock.NewRows([]string{"card_id", "card_word", "success", "new_stage"}))
+			},
+			expected:      api.ReviewResult{},
+			expectedFound: false,
+		},
+		{
+			name: "SQL Error",
+			mockSetup: func() {
+				mock.ExpectQuery(`SELECT r.card_id, c.word AS card_word, r.success, r.new_stage FROM Reviews r`).
+					WithArgs("123", reviewId).
+					WillReturnError(fmt.Errorf("query error"))
+			},
+			expected:  api.ReviewResult{},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+			result, found, err := storage.GetReviewResult(context.Background(), "123", reviewId)
+
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expected, result)
+			assert.Equal(t, tt.expectedFound, found)
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestApiKeys(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	storage := repository.NewStorage(db, logging.Discard())
+	created := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+	columns := []string{"key_id", "name", "prefix", "scopes", "created_by", "created_at", "last_used_at", "revoked_at"}
+	hash := []byte{0x01, 0x02}
+
+	t.Run("InsertApiKey", func(t *testing.T) {
+		mock.ExpectQuery(`INSERT INTO ApiKeys`).
+			WithArgs("pipeline", "0a1b2c3d", hash, `{"cards:write","stats:read"}`, "123").
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(1, "pipeline", "0a1b2c3d", "{cards:write,stats:read}", "123", created, nil, nil))
+
+		key, err := storage.InsertApiKey(context.Background(), api.ApiKey{
+			Name: "pipeline", Prefix: "0a1b2c3d", Scopes: []api.Permission{api.CardsWrite, api.StatsRead}, CreatedBy: "123",
+		}, hash)
+
+		assert.NoError(t, err)
+		assert.Equal(t, api.ApiKey{
+			KeyId: 1, Name: "pipeline", Prefix: "0a1b2c3d", Scopes: []api.Permission{api.CardsWrite, api.StatsRead}, CreatedBy: "123", CreatedAt: created,
+		}, key)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("GetApiKeyByPrefix", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT key_id, .*, key_hash\s+FROM ApiKeys\s+WHERE prefix = \$1`).
+			WithArgs("0a1b2c3d").
+			WillReturnRows(sqlmock.NewRows(append(columns, "key_hash")).
+				AddRow(1, "pipeline", "0a1b2c3d", "{stats:read}", "123", created, created, created, hash))
+
+		key, storedHash, err := storage.GetApiKeyByPrefix(context.Background(), "0a1b2c3d")
+
+		assert.NoError(t, err)
+		assert.Equal(t, hash, storedHash)
+		assert.Equal(t, []api.Permission{api.StatsRead}, key.Scopes)
+		assert.Equal(t, &created, key.RevokedAt)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("GetApiKeyByPrefix - Not Found", func(t *testing.T) {
+		mock.ExpectQuery(`FROM ApiKeys\s+WHERE prefix = \$1`).
+			WithArgs("ffffffff").
+			WillReturnRows(sqlmock.NewRows(append(columns, "key_hash")))
+
+		key, storedHash, err := storage.GetApiKeyByPrefix(context.Background(), "ffffffff")
+
+		assert.NoError(t, err)
+		assert.Nil(t, storedHash)
+		assert.Equal(t, api.ApiKey{}, key)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("RevokeApiKey", func(t *testing.T) {
+		mock.ExpectExec(`UPDATE ApiKeys\s+SET revoked_at = now\(\)\s+WHERE key_id = \$1 AND revoked_at IS NULL`).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE ApiKeys\s+SET revoked_at`).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		revoked, err := storage.RevokeApiKey(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+
+		revoked, err = storage.RevokeApiKey(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.False(t, revoked, "an already revoked key is reported as not found")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestCancelledContext(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	storage := repository.NewStorage(db, logging.Discard())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = storage.GetUser(ctx, "123")
+	assert.ErrorContains(t, err, context.Canceled.Error())
+
+	err = storage.WithTx(ctx, func(tx repository.Storage) error {
+		t.Fatal("fn must not run once the context is cancelled")
+		return nil
+	})
+	assert.ErrorContains(t, err, context.Canceled.Error())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestErrorKinds(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	storage := repository.NewStorage(db, logging.Discard())
+
+	tests := []struct {
+		name      string
+		mockSetup func()
+		call      func() error
+		expected  []error
+		fromPq    bool // the pq error stays in the chain
+	}{
+		{
+			name: "Duplicate card",
+			mockSetup: func() {
+				mock.ExpectQuery(`INSERT INTO Cards`).
+					WillReturnError(&pq.Error{Code: "23505", Constraint: "unique_word_gender"})
+			},
+			call: func() error {
+				_, err := storage.InsertCard(context.Background(), "chat", []string{"cat"}, "regular", "m", 1)
+				return err
+			},
+			expected: []error{api.ErrDuplicateCard, api.ErrDuplicate},
+			fromPq:   true,
+		},
+		{
+			name: "Deleting a missing card",
+			mockSetup: func() {
+				mock.ExpectExec(`DELETE FROM Cards`).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			call: func() error {
+				return storage.DeleteCard(context.Background(), 7)
+			},
+			expected: []error{api.ErrCardNotFound, api.ErrNotFound},
+		},
+		{
+			name: "Check violation",
+			mockSetup: func() {
+				mock.ExpectQuery(`UPDATE Users`).
+					WillReturnError(&pq.Error{Code: "23514", Constraint: "users_level_check"})
+			},
+			call: func() error {
+				_, err := storage.UpdateUserLevel(context.Background(), "123", 0)
+				return err
+			},
+			expected: []error{api.ErrValidation},
+			fromPq:   true,
+		},
+		{
+			name: "Value too long",
+			mockSetup: func() {
+				mock.ExpectQuery(`INSERT INTO Users`).
+					WillReturnError(&pq.Error{Code: "22001"})
+			},
+			call: func() error {
+				_, err := storage.InsertUser(context.Background(), api.User{UserId: "123"})
+				return err
+			},
+			expected: []error{api.ErrValidation},
+			fromPq:   true,
+		},
+		{
+			name: "Serialization failure",
+			mockSetup: func() {
+				mock.ExpectExec(`UPDATE ApiKeys`).
+					WillReturnError(&pq.Error{Code: "40001"})
+			},
+			call: func() error {
+				return storage.TouchApiKey(context.Background(), 1, time.Now())
+			},
+			expected: []error{api.ErrConflict},
+			fromPq:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockSetup()
+
+			err := tt.call()
+
+			for _, expected := range tt.expected {
+				assert.ErrorIs(t, err, expected)
+			}
+			if tt.fromPq {
+				var pqErr *pq.Error
+				assert.ErrorAs(t, err, &pqErr)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	storage := repository.Instrument(repository.NewStorage(db, logging.Discard()))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT stage_id, stage_name, .* FROM SRSStages`).WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	// methods called on the transaction are timed too
+	err = storage.WithUserTx(context.Background(), func(tx api.UserRepository) error {
+		_, err := tx.GetSRSStages(context.Background())
+		return err
+	})
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	w := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, w.Body.String(), `crabi_db_query_duration_seconds_count{method="GetSRSStages"} 1`)
+	assert.Contains(t, w.Body.String(), `crabi_db_query_errors_total{method="GetSRSStages"} 1`)
+}
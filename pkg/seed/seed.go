@@ -0,0 +1,95 @@
+// Package seed installs the reference data a fresh database needs: the SRS
+// stage table and, optionally, a starter deck of French vocabulary. Seeding
+// is idempotent, rows that already exist are left untouched.
+package seed
+
+import (
+	"context"
+	"crabigateur-api/pkg/api"
+	"crabigateur-api/pkg/repository"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+)
+
+//go:embed data/starter_deck.json
+var starterDeck []byte
+
+// StarterDeck returns the embedded starter vocabulary: common words, regular
+// and irregular nouns and adjectives, and verbs with their conjugations
+func StarterDeck() ([]api.Card, error) {
+	var cards []api.Card
+	if err := json.Unmarshal(starterDeck, &cards); err != nil {
+		return nil, fmt.Errorf("seed - StarterDeck: %w", err)
+	}
+	return cards, nil
+}
+
+type Report struct {
+	StagesInserted int
+	StagesSkipped  int
+	CardsCreated   int
+	CardsSkipped   int
+}
+
+type Seeder struct {
+	storage repository.Storage
+}
+
+func NewSeeder(storage repository.Storage) *Seeder {
+	return &Seeder{
+		storage: storage,
+	}
+}
+
+// SeedStages inserts the stages missing from SRSStages in a single transaction
+func (s *Seeder) SeedStages(ctx context.Context, stages api.StageTable, report *Report) error {
+	return s.storage.WithTx(ctx, func(tx repository.Storage) error {
+		for _, stage := range stages {
+			inserted, err := tx.InsertSRSStage(ctx, stage)
+			if err != nil {
+				return err
+			}
+
+			if inserted {
+				report.StagesInserted++
+			} else {
+				report.StagesSkipped++
+			}
+		}
+		return nil
+	})
+}
+
+// SeedCards creates the cards whose word and gender are not in Cards yet, in a
+// single transaction. Existing cards are skipped rather than updated so that
+// re-seeding never overwrites edits made since.
+func (s *Seeder) SeedCards(ctx context.Context, cards []api.Card, report *Report) error {
+	for i, card := range cards {
+		if err := api.ValidateCard(card); err != nil {
+			return fmt.Errorf("seed - card %d (%s): %w", i, card.Word, err)
+		}
+	}
+
+	return s.storage.WithTx(ctx, func(tx repository.Storage) error {
+		cardService := api.NewCardService(tx, slog.Default())
+
+		for _, card := range cards {
+			_, exists, err := tx.FindCardId(ctx, card.Word, card.Gender)
+			if err != nil {
+				return err
+			}
+			if exists {
+				report.CardsSkipped++
+				continue
+			}
+
+			if _, err := cardService.CreateCard(ctx, card); err != nil {
+				return fmt.Errorf("seed - card %s: %w", card.Word, err)
+			}
+			report.CardsCreated++
+		}
+		return nil
+	})
+}
@@ -0,0 +1,161 @@
+package seed_test
+
+import (
+	"context"
+	"crabigateur-api/pkg/api"
+	"crabigateur-api/pkg/logging"
+	"crabigateur-api/pkg/repository"
+	"crabigateur-api/pkg/seed"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStarterDeck(t *testing.T) {
+	cards, err := seed.StarterDeck()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, cards)
+
+	seen := map[string]bool{}
+	for _, card := range cards {
+		assert.NoError(t, api.ValidateCard(card), card.Word)
+		assert.NotEmpty(t, card.Translation, card.Word)
+
+		key := card.Word + "|" + card.Gender
+		assert.False(t, seen[key], "duplicate card %s", key)
+		seen[key] = true
+
+		if card.WordType == string(api.Verb) {
+			for tense, forms := range card.Forms {
+				assert.Len(t, forms, 6, "%s %s", card.Word, tense)
+			}
+		}
+	}
+}
+
+func TestSeedStages(t *testing.T) {
+	tests := []struct {
+		name      string
+		mockSetup func(mock sqlmock.Sqlmock)
+		expected  seed.Report
+		expectErr bool
+	}{
+		{
+			name: "Inserts missing stages",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				for _, stage := range api.DefaultStages {
+					affected := int64(1)
+					if stage.StageId <= 2 {
+						affected = 0
+					}
+					mock.ExpectExec(`INSERT INTO SRSStages`).
+						WithArgs(stage.StageId, stage.Name, int64(stage.Interval.Seconds()), stage.Penalty).
+						WillReturnResult(sqlmock.NewResult(0, affected))
+				}
+				mock.ExpectCommit()
+			},
+			expected:  seed.Report{StagesInserted: 7, StagesSkipped: 2},
+			expectErr: false,
+		},
+		{
+			name: "Failure rolls back",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO SRSStages`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO SRSStages`).WillReturnError(fmt.Errorf("exec error"))
+				mock.ExpectRollback()
+			},
+			expected:  seed.Report{StagesInserted: 1},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			tt.mockSetup(mock)
+
+			var report seed.Report
+			err = seed.NewSeeder(repository.NewStorage(db, logging.Discard())).SeedStages(context.Background(), api.DefaultStages, &report)
+
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expected, report)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestSeedCards(t *testing.T) {
+	cards := []api.Card{
+		{Level: 1, Word: "chat", Translation: []string{"cat"}, WordType: "regular", Gender: "m"},
+		{Level: 1, Word: "oui", Translation: []string{"yes"}, WordType: "regular"},
+	}
+
+	tests := []struct {
+		name      string
+		cards     []api.Card
+		mockSetup func(mock sqlmock.Sqlmock)
+		expected  seed.Report
+		expectErr bool
+	}{
+		{
+			name:  "Skips existing cards",
+			cards: cards,
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT card_id\s+FROM Cards`).
+					WithArgs("chat", "m").
+					WillReturnRows(sqlmock.NewRows([]string{"card_id"}).AddRow(3))
+				mock.ExpectQuery(`SELECT card_id\s+FROM Cards`).
+					WithArgs("oui", "").
+					WillReturnRows(sqlmock.NewRows([]string{"card_id"}))
+				mock.ExpectExec(`SAVEPOINT savepoint_1`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`INSERT INTO Cards`).
+					WithArgs("oui", sqlmock.AnyArg(), "regular", nil, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"card_id"}).AddRow(4))
+				mock.ExpectExec(`RELEASE SAVEPOINT savepoint_1`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+			expected:  seed.Report{CardsCreated: 1, CardsSkipped: 1},
+			expectErr: false,
+		},
+		{
+			name:      "Invalid card is rejected before writing",
+			cards:     []api.Card{{Level: 1, Word: "chat", WordType: "noun"}},
+			mockSetup: func(mock sqlmock.Sqlmock) {},
+			expected:  seed.Report{},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			tt.mockSetup(mock)
+
+			var report seed.Report
+			err = seed.NewSeeder(repository.NewStorage(db, logging.Discard())).SeedCards(context.Background(), tt.cards, &report)
+
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expected, report)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}